@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"teleport-jobworker/pkg/audit"
+
+	"github.com/spf13/cobra"
+)
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Inspect the audit log",
+}
+
+var auditVerifyCmd = &cobra.Command{
+	Use:   "verify [file]",
+	Short: "Verify the hash chain of an audit log",
+	Long: `Verify that no record of an audit log was modified, removed or inserted,
+by checking the hash of every record and its chain to the previous record.
+
+Records removed from the end of the log are only detected with --anchor, the anchor
+logged by jobserver when it closed the log (or any earlier one).`,
+	Example: `jobserver audit verify
+jobserver audit verify /var/log/jobserver-audit.log --anchor 42:3f5a...`,
+	Args:         cobra.MaximumNArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path := cfg.AuditLog
+		if len(args) == 1 {
+			path = args[0]
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		var anchor audit.Anchor
+		if auditAnchor != "" {
+			anchor, err = audit.ParseAnchor(auditAnchor)
+			if err != nil {
+				return err
+			}
+		}
+
+		count, err := audit.VerifyAnchor(file, anchor)
+		if err != nil {
+			return fmt.Errorf("%s: %d valid records before: %w", path, count, err)
+		}
+
+		fmt.Fprintf(cmd.OutOrStdout(), "Audit log %s verified, %d records\n", path, count)
+		return nil
+	},
+}
+
+var auditAnchor string
+
+func init() {
+	auditVerifyCmd.Flags().StringVar(&auditAnchor, "anchor", "",
+		"Anchor seq:hash of a record the log must still hold, as logged by jobserver")
+	auditCmd.AddCommand(auditVerifyCmd)
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"teleport-jobworker/pkg/job"
+	"teleport-jobworker/pkg/pki"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	certKeyType string
+
+	caName  string
+	caTTL   time.Duration
+	caForce bool
+
+	serverSANs []string
+	serverTTL  time.Duration
+
+	clientUser    string
+	clientRole    string
+	clientTTL     time.Duration
+	clientCertOut string
+	clientKeyOut  string
+)
+
+var caCmd = &cobra.Command{
+	Use:   "ca",
+	Short: "Manage the local certificate authority",
+}
+
+var caInitCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Create the local CA",
+	Long: `Create a self-signed CA in --ca-cert and --ca-key, to issue the server certificate and client certificates.
+Clients trust the server by the CA certificate, eg. jobctl --ca jobserver-ca.pem, and the server trusts client
+certificates with --client-ca jobserver-ca.pem. The CA private key must be kept secret.`,
+	Example: `jobserver ca init
+jobserver ca init --key-type ed25519 --ttl 8760h`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// replacing the CA invalidates every certificate it issued
+		if _, err := os.Stat(cfg.TLS.CACert); err == nil && !caForce {
+			return fmt.Errorf("CA %s already exists, replace it with --force", cfg.TLS.CACert)
+		}
+
+		ca, err := pki.NewCA(caName, certKeyType, caTTL)
+		if err != nil {
+			return err
+		}
+		if err := ca.Save(cfg.TLS.CACert, cfg.TLS.CAKey); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(cmd.OutOrStdout(), "CA %q created in %s, valid until %s\n",
+			caName, cfg.TLS.CACert, ca.Certificate.NotAfter.Format(time.RFC3339))
+		return nil
+	},
+}
+
+var certsCmd = &cobra.Command{
+	Use:   "certs",
+	Short: "Issue server and client certificates with the local CA",
+}
+
+var certsIssueServerCmd = &cobra.Command{
+	Use:   "issue-server",
+	Short: "Issue the server certificate",
+	Long: `Issue the server certificate for the DNS names and IP addresses clients connect to, signed by the local CA,
+in --tls-cert and --tls-key. A running jobserver picks up the new certificate automatically.`,
+	Example: `jobserver certs issue-server
+jobserver certs issue-server --san jobs.example.com --san 10.0.0.5 --ttl 720h`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ca, err := loadCA()
+		if err != nil {
+			return err
+		}
+		pair, err := ca.IssueServer(serverSANs, certKeyType, serverTTL)
+		if err != nil {
+			return err
+		}
+		if err := pair.Save(cfg.TLS.Cert, cfg.TLS.Key); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(cmd.OutOrStdout(), "Server certificate for %v created in %s, valid until %s\n",
+			serverSANs, cfg.TLS.Cert, pair.Certificate.NotAfter.Format(time.RFC3339))
+		return nil
+	},
+}
+
+var certsIssueClientCmd = &cobra.Command{
+	Use:   "issue-client",
+	Short: "Issue a client certificate",
+	Long: `Issue a client certificate for a user and role, signed by the local CA, for servers requiring client
+certificates (--client-ca). The certificate is written to <user>.pem and its key to <user>-key.pem by default,
+to be passed to jobctl with --cert and --key.`,
+	Example: `jobserver certs issue-client --user user1
+jobserver certs issue-client --user admin1 --role admin --ttl 24h`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if clientUser == "" {
+			return errors.New("--user is required")
+		}
+		certOut, keyOut := clientCertOut, clientKeyOut
+		if certOut == "" {
+			certOut = clientUser + ".pem"
+		}
+		if keyOut == "" {
+			keyOut = clientUser + "-key.pem"
+		}
+
+		ca, err := loadCA()
+		if err != nil {
+			return err
+		}
+		pair, err := ca.IssueClient(clientUser, clientRole, certKeyType, clientTTL)
+		if err != nil {
+			return err
+		}
+		if err := pair.Save(certOut, keyOut); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(cmd.OutOrStdout(), "Client certificate for user %s (%s) created in %s, valid until %s\n",
+			clientUser, clientRole, certOut, pair.Certificate.NotAfter.Format(time.RFC3339))
+		return nil
+	},
+}
+
+// loadCA loads the local CA created by jobserver ca init.
+func loadCA() (*pki.CA, error) {
+	ca, err := pki.LoadCA(cfg.TLS.CACert, cfg.TLS.CAKey)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("CA %s not found, create it with: jobserver ca init", cfg.TLS.CACert)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load CA: %w", err)
+	}
+	return ca, nil
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{caInitCmd, certsIssueServerCmd, certsIssueClientCmd} {
+		cmd.Flags().StringVar(&certKeyType, "key-type", pki.KeyECDSA, "Key type: ecdsa (P-256) or ed25519")
+	}
+
+	caInitCmd.Flags().StringVar(&caName, "name", "jobserver CA", "Common name of the CA")
+	caInitCmd.Flags().DurationVar(&caTTL, "ttl", pki.DefaultCATTL, "How long the CA is valid")
+	caInitCmd.Flags().BoolVar(&caForce, "force", false, "Replace an existing CA, invalidating every certificate it issued")
+
+	certsIssueServerCmd.Flags().StringSliceVar(&serverSANs, "san", []string{"localhost", "127.0.0.1", "::1"},
+		"DNS name or IP address of the server, repeated for each name")
+	certsIssueServerCmd.Flags().DurationVar(&serverTTL, "ttl", pki.DefaultServerTTL, "How long the certificate is valid")
+
+	certsIssueClientCmd.Flags().StringVar(&clientUser, "user", "", "User ID (common name) of the certificate")
+	certsIssueClientCmd.Flags().StringVar(&clientRole, "role", job.User,
+		"Role of the user (organizational unit): user, admin, or a group bound to roles by --roles")
+	certsIssueClientCmd.Flags().DurationVar(&clientTTL, "ttl", pki.DefaultClientTTL, "How long the certificate is valid")
+	certsIssueClientCmd.Flags().StringVar(&clientCertOut, "cert-out", "", "Certificate file (default <user>.pem)")
+	certsIssueClientCmd.Flags().StringVar(&clientKeyOut, "key-out", "", "Private key file (default <user>-key.pem)")
+
+	caCmd.AddCommand(caInitCmd)
+	certsCmd.AddCommand(certsIssueServerCmd)
+	certsCmd.AddCommand(certsIssueClientCmd)
+}
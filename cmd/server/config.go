@@ -0,0 +1,181 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"teleport-jobworker/pkg/config"
+	"teleport-jobworker/pkg/job"
+	"teleport-jobworker/pkg/jobserver"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// envPrefix prefixes the environment variables overriding the config file, eg. JOBSERVER_ADDR for --addr.
+const envPrefix = "JOBSERVER_"
+
+// configFlag is the flag, and JOBSERVER_CONFIG the environment variable, of the config file.
+const configFlag = "config"
+
+// cfg is the configuration of every command, resolved by loadConfig.
+var cfg = config.Default()
+
+// addConfigFlags binds the settings of cfg to persistent flags of cmd, shared with every subcommand.
+func addConfigFlags(cmd *cobra.Command) {
+	flags := cmd.PersistentFlags()
+	flags.String(configFlag, "", "YAML or JSON config file (default $"+envVar(configFlag)+")")
+
+	flags.StringVar(&cfg.Listen, "addr", cfg.Listen, "Serve the HTTPS API at this address")
+	flags.StringVar(&cfg.GRPCListen, "grpc-addr", cfg.GRPCListen,
+		"Serve the gRPC API at this address, with the TLS certificate of the HTTPS API")
+	flags.StringVar(&cfg.MetricsListen, "metrics-addr", cfg.MetricsListen,
+		"Serve /metrics on a separate plain HTTP listener at this address, instead of the API listener")
+	flags.StringVar(&cfg.DataDir, "data-dir", cfg.DataDir, "Directory of the files configured with relative paths")
+
+	flags.StringVar(&cfg.TLS.Cert, "tls-cert", cfg.TLS.Cert,
+		"PEM server certificate file, reloaded when it changes or on SIGHUP")
+	flags.StringVar(&cfg.TLS.Key, "tls-key", cfg.TLS.Key, "PEM private key file of the server certificate")
+	flags.StringVar(&cfg.TLS.CACert, "ca-cert", cfg.TLS.CACert,
+		"PEM certificate file of the local CA issuing server and client certificates")
+	flags.StringVar(&cfg.TLS.CAKey, "ca-key", cfg.TLS.CAKey, "PEM private key file of the local CA")
+	flags.StringVar(&cfg.TLS.ClientCA, "client-ca", cfg.TLS.ClientCA,
+		"Require client certificates signed by the user CA in this PEM file, instead of Bearer tokens (mutual TLS)")
+	flags.StringVar(&cfg.TLS.ClientCRL, "client-crl", cfg.TLS.ClientCRL,
+		"Reject client certificates revoked by this revocation list, signed by the user CA")
+
+	flags.StringVar(&cfg.Auth.TokenKeys, "token-keys", cfg.Auth.TokenKeys,
+		"Path of the key set signing and verifying access tokens")
+	flags.StringVar(&cfg.Auth.TokenRevocations, "token-revocations", cfg.Auth.TokenRevocations,
+		"Path of the list of revoked access tokens")
+	flags.StringVar(&cfg.Auth.TokenAudience, "token-audience", cfg.Auth.TokenAudience,
+		"Audience of the access tokens issued and accepted")
+	flags.StringVar(&cfg.Auth.Users, "users", cfg.Auth.Users,
+		"Path of the users allowed to log in, with their password hashes")
+	flags.DurationVar((*time.Duration)(&cfg.Auth.AccessTokenTTL), "access-token-ttl",
+		time.Duration(cfg.Auth.AccessTokenTTL), "How long the access tokens issued by login are valid")
+	flags.DurationVar((*time.Duration)(&cfg.Auth.RefreshTokenTTL), "refresh-token-ttl",
+		time.Duration(cfg.Auth.RefreshTokenTTL), "How long the refresh tokens issued by login are valid")
+
+	flags.StringVar(&cfg.AuditLog, "audit-log", cfg.AuditLog, "Path of the append-only audit log file")
+	flags.StringVar(&cfg.Roles, "roles", cfg.Roles,
+		"Authorize actions with the roles and bindings of this JSON file, instead of the default user and admin roles")
+
+	flags.IntVar(&cfg.Limits.MaxJobs, "max-jobs", cfg.Limits.MaxJobs,
+		"Maximum number of running jobs, 0 for no limit")
+	flags.IntVar(&cfg.Limits.MaxJobsPerUser, "max-jobs-per-user", cfg.Limits.MaxJobsPerUser,
+		"Maximum number of running jobs of each user, 0 for no limit")
+	flags.IntVar(&cfg.Limits.MaxOutputBytes, "max-output-bytes", cfg.Limits.MaxOutputBytes,
+		"Size of the output kept for each job, beyond which its oldest output is dropped")
+	flags.DurationVar((*time.Duration)(&cfg.Limits.IdempotencyWindow), "idempotency-window",
+		time.Duration(cfg.Limits.IdempotencyWindow), "How long the idempotency keys of start requests are remembered")
+
+	flags.StringVar(&cfg.Shutdown.Policy, "shutdown-policy", cfg.Shutdown.Policy,
+		"What to do with running jobs on SIGINT/SIGTERM: wait, stop or detach")
+	flags.DurationVar((*time.Duration)(&cfg.Shutdown.Timeout), "shutdown-timeout", time.Duration(cfg.Shutdown.Timeout),
+		"How long to drain running jobs, then as long to drain in-flight requests, on shutdown")
+}
+
+// envVar returns the environment variable of a config flag, eg. JOBSERVER_GRPC_ADDR for --grpc-addr.
+func envVar(flag string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flag, "-", "_"))
+}
+
+// loadConfig resolves cfg from the defaults, then the config file, then JOBSERVER_* environment variables,
+// then the flags set on the command line, and validates it.
+func loadConfig(flags *pflag.FlagSet) error {
+	// the config file overwrites the values of every flag, so those set on the command line are reapplied
+	changed := map[string]string{}
+	flags.Visit(func(flag *pflag.Flag) {
+		changed[flag.Name] = flag.Value.String()
+	})
+
+	path, _ := flags.GetString(configFlag)
+	if path == "" {
+		path = os.Getenv(envVar(configFlag))
+	}
+	if path != "" {
+		if err := cfg.Load(path); err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+	}
+
+	var errs []error
+	flags.VisitAll(func(flag *pflag.Flag) {
+		if flag.Name == configFlag {
+			return
+		}
+		if value, ok := changed[flag.Name]; ok {
+			errs = append(errs, flag.Value.Set(value))
+		} else if value, ok := os.LookupEnv(envVar(flag.Name)); ok {
+			if err := flag.Value.Set(value); err != nil {
+				errs = append(errs, fmt.Errorf("invalid %s: %w", envVar(flag.Name), err))
+			}
+		}
+	})
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid config:\n%w", err)
+	}
+	cfg.ResolvePaths()
+	return nil
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect the configuration",
+	Long: `Inspect the configuration resolved from the defaults, the config file (--config or $JOBSERVER_CONFIG),
+JOBSERVER_* environment variables (eg. JOBSERVER_ADDR for --addr), and flags, in increasing precedence.`,
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Validate the configuration and the files it refers to",
+	Long: `Validate every setting of the configuration, and load the TLS certificate and roles it refers to.
+Exits with an error describing every invalid setting.`,
+	Example:      "jobserver config validate --config /etc/jobserver/config.yaml",
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if _, err := jobserver.NewCertificateReloader(cfg.TLS.Cert, cfg.TLS.Key); err != nil {
+			return fmt.Errorf("invalid tls: %w", err)
+		}
+		if cfg.Roles != "" {
+			if _, err := job.LoadPolicy(cfg.Roles); err != nil {
+				return fmt.Errorf("invalid roles: %w", err)
+			}
+		}
+
+		fmt.Fprintln(cmd.OutOrStdout(), "Configuration is valid")
+		return nil
+	},
+}
+
+var configPrintCmd = &cobra.Command{
+	Use:          "print",
+	Short:        "Print the resolved configuration as YAML",
+	Long:         "Print the configuration resolved from the defaults, the config file, environment variables and flags, as YAML.",
+	Example:      "jobserver config print --config /etc/jobserver/config.yaml > resolved.yaml",
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		encoder := yaml.NewEncoder(cmd.OutOrStdout())
+		encoder.SetIndent(2)
+		if err := encoder.Encode(cfg); err != nil {
+			return err
+		}
+		return encoder.Close()
+	},
+}
+
+func init() {
+	configCmd.AddCommand(configValidateCmd)
+	configCmd.AddCommand(configPrintCmd)
+}
@@ -1,35 +1,51 @@
 package main
 
 import (
-	"crypto/tls"
-	"log"
-	"net/http"
+	"fmt"
+	"os"
 
-	"teleport-jobworker/pkg/job"
-	"teleport-jobworker/pkg/jobserver"
-)
+	"teleport-jobworker/pkg/version"
 
-func main() {
-	addr := jobserver.DefaultHost
+	"github.com/spf13/cobra"
+)
 
-	// create new Manager to inject into job Server
-	manager := job.NewManager()
+var rootCmd = &cobra.Command{
+	Use:   "jobserver",
+	Short: "Serve the job API over HTTPS and gRPC",
+	Long: "jobserver runs the HTTPS and gRPC API servers for job functions on Linux processes, " +
+		"and records every authenticated action in a tamper-evident audit log.\n\n" +
+		"Settings are read from the config file (--config or $JOBSERVER_CONFIG), " +
+		"overridden by JOBSERVER_* environment variables (eg. JOBSERVER_ADDR for --addr), then by flags.",
+	Args:    cobra.NoArgs,
+	Version: version.String(),
+	CompletionOptions: cobra.CompletionOptions{
+		DisableDefaultCmd: true,
+	},
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return loadConfig(cmd.Root().PersistentFlags())
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return serve()
+	},
+}
 
-	// create job Server with mux to use with HTTPS
-	jobServer := jobserver.NewServer(manager)
+func init() {
+	// settings are persistent flags, shared with the subcommands using the same files
+	addConfigFlags(rootCmd)
 
-	cert, err := jobserver.LoadTLSCertificate()
-	if err != nil {
-		log.Fatal("failed to load TLS certificate")
-	}
+	rootCmd.AddCommand(configCmd)
+	rootCmd.AddCommand(caCmd)
+	rootCmd.AddCommand(certsCmd)
+	rootCmd.AddCommand(auditCmd)
+	rootCmd.AddCommand(tokenCmd)
+	rootCmd.AddCommand(userCmd)
+}
 
-	server := &http.Server{
-		Addr:    addr,
-		Handler: jobServer,
-		TLSConfig: &tls.Config{
-			MinVersion:   tls.VersionTLS13,
-			Certificates: []tls.Certificate{cert},
-		},
+func main() {
+	if err := rootCmd.Execute(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
 	}
-	log.Fatal(server.ListenAndServeTLS("", ""))
 }
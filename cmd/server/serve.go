@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"teleport-jobworker/pkg/audit"
+	"teleport-jobworker/pkg/job"
+	"teleport-jobworker/pkg/jobserver"
+	"teleport-jobworker/pkg/metrics"
+	"teleport-jobworker/pkg/token"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// serve runs the API server until SIGINT/SIGTERM, then drains jobs and in-flight requests.
+func serve() error {
+	policy, err := job.ParseShutdownPolicy(cfg.Shutdown.Policy)
+	if err != nil {
+		return err
+	}
+
+	auditLog, err := audit.Open(cfg.AuditLog)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer auditLog.Close()
+	// the anchors allow verifying that no record was removed from the end of the log
+	log.Printf("audit log %s opened at anchor %s", cfg.AuditLog, auditLog.Anchor())
+
+	// create new Manager to inject into job Server, reporting job events to metrics
+	jobMetrics := metrics.New()
+	managerOptions := []job.ManagerOption{
+		job.WithObserver(jobMetrics),
+		job.WithJobLimits(cfg.Limits.MaxJobs, cfg.Limits.MaxJobsPerUser),
+		job.WithOutputLimit(cfg.Limits.MaxOutputBytes),
+		job.WithDetachDir(cfg.DataDir),
+	}
+	if cfg.Roles != "" {
+		rolesPolicy, err := job.LoadPolicy(cfg.Roles)
+		if err != nil {
+			return fmt.Errorf("failed to load roles: %w", err)
+		}
+		authorizer, err := job.NewRBAC(rolesPolicy)
+		if err != nil {
+			return err
+		}
+		managerOptions = append(managerOptions, job.WithAuthorizer(authorizer))
+	}
+	manager := job.NewManager(managerOptions...)
+	jobMetrics.RegisterManager(manager)
+
+	// create job Server with mux to use with HTTPS
+	serverOptions := []jobserver.ServerOption{
+		jobserver.WithMetrics(jobMetrics),
+		jobserver.WithAuditLog(auditLog),
+		jobserver.WithIdempotencyWindow(time.Duration(cfg.Limits.IdempotencyWindow)),
+		jobserver.WithReadinessCheck("dataDir", func() error { return checkWritable(cfg.DataDir) }),
+	}
+	if cfg.MetricsListen == "" {
+		serverOptions = append(serverOptions, jobserver.WithMetricsEndpoint())
+	}
+
+	var mutualTLS *jobserver.MutualTLS
+	if cfg.TLS.ClientCA != "" {
+		mutualTLS, err = jobserver.LoadMutualTLS(cfg.TLS.ClientCA, cfg.TLS.ClientCRL)
+		if err != nil {
+			return err
+		}
+		serverOptions = append(serverOptions, jobserver.WithMutualTLS(mutualTLS))
+	} else {
+		verifier, err := token.LoadVerifier(cfg.Auth.TokenKeys, cfg.Auth.TokenRevocations, cfg.Auth.TokenAudience)
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("token signing keys %s not found, create them with: jobserver token keygen", cfg.Auth.TokenKeys)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to load token signing keys: %w", err)
+		}
+		serverOptions = append(serverOptions, jobserver.WithTokenVerifier(verifier))
+
+		// login is enabled once users are added with: jobserver user set
+		if _, err := os.Stat(cfg.Auth.Users); err == nil {
+			users, err := token.LoadUsers(cfg.Auth.Users)
+			if err != nil {
+				return fmt.Errorf("failed to load users: %w", err)
+			}
+			serverOptions = append(serverOptions, jobserver.WithLogin(users,
+				time.Duration(cfg.Auth.AccessTokenTTL), time.Duration(cfg.Auth.RefreshTokenTTL)))
+		} else {
+			log.Printf("Login disabled: users file %s not found", cfg.Auth.Users)
+		}
+	}
+	jobServer := jobserver.NewServer(manager, serverOptions...)
+
+	// the certificate files are reloaded when they change (see Watch below), or on SIGHUP
+	reloader, err := jobserver.NewCertificateReloader(cfg.TLS.Cert, cfg.TLS.Key)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("TLS certificate %s not found, create it with: jobserver ca init && jobserver certs issue-server",
+			cfg.TLS.Cert)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	jobMetrics.RegisterCertificate(reloader.NotAfter)
+
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+	go reloadOnHangup(hangup, reloader, mutualTLS)
+	watchCtx, stopWatch := context.WithCancel(context.Background())
+	defer stopWatch()
+	go reloader.Watch(watchCtx, jobserver.CertificateCheckInterval)
+	if mutualTLS != nil {
+		go mutualTLS.Watch(watchCtx, jobserver.CertificateCheckInterval)
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS13,
+		GetCertificate: reloader.GetCertificate,
+	}
+	if mutualTLS != nil {
+		mutualTLS.ConfigureTLS(tlsConfig)
+	}
+
+	server := &http.Server{
+		Addr:      cfg.Listen,
+		Handler:   jobServer,
+		TLSConfig: tlsConfig,
+	}
+
+	// the gRPC API shares the Manager, TLS certificate and authentication of the HTTPS API
+	grpcServer := jobServer.NewGRPCServer(grpc.Creds(credentials.NewTLS(tlsConfig)))
+	grpcListener, err := net.Listen("tcp", cfg.GRPCListen)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 3)
+	go func() {
+		serveErr <- server.ListenAndServeTLS("", "")
+	}()
+	go func() {
+		serveErr <- grpcServer.Serve(grpcListener)
+	}()
+
+	var metricsServer *http.Server
+	if cfg.MetricsListen != "" {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("GET /metrics", jobMetrics.Handler())
+		metricsServer = &http.Server{Addr: cfg.MetricsListen, Handler: metricsMux}
+		go func() {
+			serveErr <- metricsServer.ListenAndServe()
+		}()
+	}
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+	// a second signal exits immediately
+	stop()
+
+	log.Printf("shutting down with policy %q, refusing new jobs", policy)
+	jobsCtx, cancelJobs := context.WithTimeout(context.Background(), time.Duration(cfg.Shutdown.Timeout))
+	defer cancelJobs()
+
+	// drain jobs first, while status and output requests are still served
+	summaries, err := manager.Shutdown(jobsCtx, policy)
+	for _, summary := range summaries {
+		exitCode := "n/a"
+		if summary.Status.ExitCode != nil {
+			exitCode = strconv.Itoa(*summary.Status.ExitCode)
+		}
+		log.Printf("job %s (user %s): %s, status %s, exit code %s",
+			summary.ID, summary.UserID, summary.Outcome, summary.Status.State, exitCode)
+		if len(summary.OutputFiles) > 0 {
+			log.Printf("job %s output is written to %s", summary.ID, strings.Join(summary.OutputFiles, ", "))
+		}
+	}
+	if err != nil {
+		log.Printf("failed to drain every job: %v", err)
+	}
+
+	// in-flight requests get their own deadline, even if draining jobs used up the first one
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.Shutdown.Timeout))
+	defer cancel()
+
+	grpcStopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(grpcStopped)
+	}()
+
+	if err := server.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("failed to drain in-flight requests: %v", err)
+		server.Close()
+	}
+
+	select {
+	case <-grpcStopped:
+	case <-shutdownCtx.Done():
+		log.Printf("failed to drain in-flight RPCs: %v", shutdownCtx.Err())
+		grpcServer.Stop()
+	}
+	if metricsServer != nil {
+		metricsServer.Close()
+	}
+	log.Printf("audit log %s closed at anchor %s", cfg.AuditLog, auditLog.Anchor())
+	log.Printf("shut down, %d jobs were running", len(summaries))
+	return nil
+}
+
+// checkWritable checks that files can be created in dir, eg. for the audit log and credentials.
+func checkWritable(dir string) error {
+	file, err := os.CreateTemp(dir, ".readyz-*")
+	if err != nil {
+		return fmt.Errorf("%s is not writable", dir)
+	}
+	file.Close()
+	return os.Remove(file.Name())
+}
+
+// reloadOnHangup reloads the TLS certificate files, and the client revocation list if any, on every SIGHUP.
+func reloadOnHangup(hangup <-chan os.Signal, reloader *jobserver.CertificateReloader, mutualTLS *jobserver.MutualTLS) {
+	for range hangup {
+		if mutualTLS != nil {
+			if err := mutualTLS.Reload(); err != nil {
+				log.Printf("failed to reload revocation list, keeping the previous one: %v", err)
+			}
+		}
+		if err := reloader.Reload(); err != nil {
+			log.Printf("failed to reload TLS certificate, serving the previous one: %v", err)
+			continue
+		}
+		log.Printf("reloaded TLS certificate %s, valid until %s",
+			cfg.TLS.Cert, reloader.NotAfter().Format(time.RFC3339))
+	}
+}
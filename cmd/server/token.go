@@ -0,0 +1,169 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"teleport-jobworker/pkg/job"
+	"teleport-jobworker/pkg/token"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	keyAlgorithm string
+	keyID        string
+
+	issueUser string
+	issueRole string
+	issueTTL  time.Duration
+)
+
+var tokenCmd = &cobra.Command{
+	Use:   "token",
+	Short: "Manage access tokens and their signing keys",
+}
+
+var tokenKeygenCmd = &cobra.Command{
+	Use:   "keygen",
+	Short: "Generate a new signing key",
+	Long: `Generate a new signing key and make it the active key of the key set, creating the key set if needed.
+New tokens are signed with the new key, while tokens signed by previous keys stay valid until their keys are removed.
+A running jobserver picks up the changed key set automatically.`,
+	Example: `jobserver token keygen
+jobserver token keygen --alg EdDSA --kid 2026-10`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		keys, err := token.LoadKeySet(cfg.Auth.TokenKeys)
+		if errors.Is(err, os.ErrNotExist) {
+			keys, err = &token.KeySet{}, nil
+		}
+		if err != nil {
+			return err
+		}
+
+		key, err := token.GenerateKey(keyAlgorithm, keyID)
+		if err != nil {
+			return err
+		}
+		if err := keys.Add(key); err != nil {
+			return err
+		}
+		if err := keys.Save(cfg.Auth.TokenKeys); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(cmd.OutOrStdout(), "Signing key %s (%s) is now active in %s\n", key.ID, key.Algorithm, cfg.Auth.TokenKeys)
+		return nil
+	},
+}
+
+var tokenRemoveKeyCmd = &cobra.Command{
+	Use:          "remove-key <kid>",
+	Short:        "Remove a previous signing key, invalidating the tokens it signed",
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		keys, err := token.LoadKeySet(cfg.Auth.TokenKeys)
+		if err != nil {
+			return err
+		}
+		if err := keys.Remove(args[0]); err != nil {
+			return err
+		}
+		if err := keys.Save(cfg.Auth.TokenKeys); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(cmd.OutOrStdout(), "Signing key %s removed from %s\n", args[0], cfg.Auth.TokenKeys)
+		return nil
+	},
+}
+
+var tokenIssueCmd = &cobra.Command{
+	Use:   "issue",
+	Short: "Issue an access token",
+	Long: `Issue an access token for a user and role, signed with the active signing key.
+The token is printed to stdout, to be passed to jobctl with --token or JOBCTL_TOKEN.`,
+	Example: `jobserver token issue --user user1
+jobserver token issue --user admin1 --role admin --ttl 1h`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if issueUser == "" {
+			return errors.New("--user is required")
+		}
+		if issueRole == "" {
+			return errors.New("role is empty")
+		}
+		if issueTTL <= 0 {
+			return errors.New("--ttl must be positive")
+		}
+
+		keys, err := token.LoadKeySet(cfg.Auth.TokenKeys)
+		if err != nil {
+			return err
+		}
+		signed, err := keys.Sign(token.NewClaims(issueUser, issueRole, cfg.Auth.TokenAudience, issueTTL))
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintln(cmd.OutOrStdout(), signed)
+		return nil
+	},
+}
+
+var tokenRevokeCmd = &cobra.Command{
+	Use:   "revoke <token or token ID>",
+	Short: "Revoke an access token before it expires",
+	Long: `Add an access token to the revocation list, given the token itself or its ID (jti claim).
+Revoked tokens given by ID are kept in the list forever, while those given as tokens are dropped once expired.
+A running jobserver picks up the changed revocation list automatically.`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id, expiresAt := args[0], time.Time{}
+		if strings.Count(args[0], ".") == 2 {
+			keys, err := token.LoadKeySet(cfg.Auth.TokenKeys)
+			if err != nil {
+				return err
+			}
+			claims, err := keys.Parse(args[0])
+			if err != nil {
+				return err
+			}
+			id, expiresAt = claims.ID, claims.Expiry()
+		}
+
+		revocations, err := token.LoadRevocationList(cfg.Auth.TokenRevocations)
+		if err != nil {
+			return err
+		}
+		revocations.Revoke(id, expiresAt)
+		if err := revocations.Save(cfg.Auth.TokenRevocations); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(cmd.OutOrStdout(), "Token %s revoked in %s\n", id, cfg.Auth.TokenRevocations)
+		return nil
+	},
+}
+
+func init() {
+	tokenKeygenCmd.Flags().StringVar(&keyAlgorithm, "alg", token.AlgEdDSA, "Signing algorithm: HS256 or EdDSA")
+	tokenKeygenCmd.Flags().StringVar(&keyID, "kid", "", "Key ID (default random)")
+
+	tokenIssueCmd.Flags().StringVar(&issueUser, "user", "", "User ID (subject) of the token")
+	tokenIssueCmd.Flags().StringVar(&issueRole, "role", job.User, "Role of the user: user, admin, or a group bound to roles by --roles")
+	tokenIssueCmd.Flags().DurationVar(&issueTTL, "ttl", 24*time.Hour, "How long the token is valid")
+
+	tokenCmd.AddCommand(tokenKeygenCmd)
+	tokenCmd.AddCommand(tokenRemoveKeyCmd)
+	tokenCmd.AddCommand(tokenIssueCmd)
+	tokenCmd.AddCommand(tokenRevokeCmd)
+}
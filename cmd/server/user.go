@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"teleport-jobworker/pkg/job"
+	"teleport-jobworker/pkg/token"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var (
+	userRole      string
+	passwordStdin bool
+)
+
+var userCmd = &cobra.Command{
+	Use:   "user",
+	Short: "Manage the users allowed to log in",
+}
+
+var userSetCmd = &cobra.Command{
+	Use:   "set <name>",
+	Short: "Add a user, or change its role and password",
+	Long: `Add a user allowed to log in with jobctl login, or change the role and password of an existing user.
+Passwords are stored as bcrypt hashes. The password is prompted for, or read from stdin with --password-stdin.
+A running jobserver picks up the changed users file automatically.`,
+	Example: `jobserver user set user1
+echo "$PASSWORD" | jobserver user set admin1 --role admin --password-stdin`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if userRole == "" {
+			return errors.New("role is empty")
+		}
+
+		password, err := readPassword(cmd)
+		if err != nil {
+			return err
+		}
+		if password == "" {
+			return errors.New("password is empty")
+		}
+
+		users, err := token.LoadUserFile(cfg.Auth.Users)
+		if err != nil {
+			return err
+		}
+		if err := users.Set(args[0], userRole, password); err != nil {
+			return err
+		}
+		if err := users.Save(cfg.Auth.Users); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(cmd.OutOrStdout(), "User %s (%s) saved in %s\n", args[0], userRole, cfg.Auth.Users)
+		return nil
+	},
+}
+
+var userRemoveCmd = &cobra.Command{
+	Use:          "remove <name>",
+	Short:        "Remove a user, who can no longer log in or refresh tokens",
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		users, err := token.LoadUserFile(cfg.Auth.Users)
+		if err != nil {
+			return err
+		}
+		if err := users.Remove(args[0]); err != nil {
+			return err
+		}
+		if err := users.Save(cfg.Auth.Users); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(cmd.OutOrStdout(), "User %s removed from %s\n", args[0], cfg.Auth.Users)
+		return nil
+	},
+}
+
+func init() {
+	userSetCmd.Flags().StringVar(&userRole, "role", job.User, "Role of the user: user, admin, or a group bound to roles by --roles")
+	userSetCmd.Flags().BoolVar(&passwordStdin, "password-stdin", false, "Read the password from stdin")
+
+	userCmd.AddCommand(userSetCmd)
+	userCmd.AddCommand(userRemoveCmd)
+}
+
+// readPassword prompts for the password twice without echo, or reads it from stdin.
+func readPassword(cmd *cobra.Command) (string, error) {
+	stdinFd := int(os.Stdin.Fd())
+	if !passwordStdin && term.IsTerminal(stdinFd) {
+		fmt.Fprint(cmd.ErrOrStderr(), "Password: ")
+		password, err := term.ReadPassword(stdinFd)
+		fmt.Fprintln(cmd.ErrOrStderr())
+		if err != nil {
+			return "", err
+		}
+
+		fmt.Fprint(cmd.ErrOrStderr(), "Confirm password: ")
+		confirmed, err := term.ReadPassword(stdinFd)
+		fmt.Fprintln(cmd.ErrOrStderr())
+		if err != nil {
+			return "", err
+		}
+		if string(confirmed) != string(password) {
+			return "", errors.New("passwords do not match")
+		}
+		return string(password), nil
+	}
+
+	password, err := bufio.NewReader(cmd.InOrStdin()).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	return strings.TrimRight(password, "\r\n"), nil
+}
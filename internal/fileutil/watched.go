@@ -0,0 +1,34 @@
+// Package fileutil implements file helpers shared by the packages of the job service.
+package fileutil
+
+import "os"
+
+// Watched tracks a file, to reload it when it changes.
+type Watched struct {
+	Path string
+	info os.FileInfo
+}
+
+// Changed reports whether the file was replaced, modified or removed since the last call.
+// A Watched without a path never changes.
+func (w *Watched) Changed() bool {
+	if w.Path == "" {
+		return false
+	}
+
+	info, err := os.Stat(w.Path)
+	if err != nil {
+		changed := w.info != nil
+		w.info = nil
+		return changed
+	}
+	changed := w.info == nil || !os.SameFile(w.info, info) ||
+		!info.ModTime().Equal(w.info.ModTime()) || info.Size() != w.info.Size()
+	w.info = info
+	return changed
+}
+
+// Forget reports the file as changed on the next call to Changed, eg. after it failed to load.
+func (w *Watched) Forget() {
+	w.info = nil
+}
@@ -0,0 +1,295 @@
+// Package audit writes a tamper-evident log of API actions: an append-only file of
+// JSON records, one per line, where each record includes the hash of the previous one.
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Results of an audited action
+const (
+	ResultSuccess = "success"
+	ResultDenied  = "denied"
+	ResultError   = "error"
+)
+
+// genesisHash is the previous hash of the first record of a log.
+var genesisHash = hex.EncodeToString(make([]byte, sha256.Size))
+
+// maxRecordSize bounds the length of a single record line when reading a log.
+const maxRecordSize = 1 << 20
+
+// Record is a single audited action.
+type Record struct {
+	Seq      uint64    `json:"seq"`
+	Time     time.Time `json:"time"`
+	User     string    `json:"user"`
+	Role     string    `json:"role"`
+	Action   string    `json:"action"`
+	JobID    string    `json:"jobId,omitempty"`
+	Program  string    `json:"program,omitempty"`
+	Args     []string  `json:"args,omitempty"`
+	SourceIP string    `json:"sourceIp"`
+	Result   string    `json:"result"`
+	Code     int       `json:"code"`
+
+	PrevHash string `json:"prevHash"`
+	Hash     string `json:"hash"`
+}
+
+// computeHash returns the hash of the record, covering every field but Hash itself.
+func (r Record) computeHash() (string, error) {
+	r.Hash = ""
+	data, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Anchor identifies the last record of a log by its sequence number and hash. Kept apart from the log,
+// it allows VerifyAnchor to detect records removed from the end of the log, which the hash chain cannot.
+type Anchor struct {
+	Seq  uint64
+	Hash string
+}
+
+// String formats the anchor as seq:hash, as parsed by ParseAnchor.
+func (a Anchor) String() string {
+	return fmt.Sprintf("%d:%s", a.Seq, a.Hash)
+}
+
+// ParseAnchor parses an anchor formatted as seq:hash.
+func ParseAnchor(s string) (Anchor, error) {
+	seq, hash, ok := strings.Cut(s, ":")
+	if !ok || hash == "" {
+		return Anchor{}, fmt.Errorf("invalid anchor %q, expected seq:hash", s)
+	}
+	n, err := strconv.ParseUint(seq, 10, 64)
+	if err != nil {
+		return Anchor{}, fmt.Errorf("invalid anchor %q, expected seq:hash", s)
+	}
+	return Anchor{Seq: n, Hash: hash}, nil
+}
+
+// Log appends records to an audit log file.
+type Log struct {
+	mutex    sync.Mutex
+	file     *os.File
+	path     string
+	seq      uint64
+	lastHash string
+	// size is the length of the records written, read by Query without holding the mutex
+	size int64
+}
+
+// Open opens the audit log file at path for appending, creating it if needed.
+// An existing log is verified, so new records chain from its last record.
+func Open(path string) (*Log, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	last, _, err := verify(file, Anchor{})
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("existing audit log %s: %w", path, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	log := &Log{file: file, path: path, lastHash: genesisHash, size: info.Size()}
+	if last != nil {
+		log.seq = last.Seq
+		log.lastHash = last.Hash
+	}
+	return log, nil
+}
+
+// Append chains the record to the log and writes it. Seq, PrevHash and Hash are set by Append,
+// and Time if it is zero.
+func (l *Log) Append(record Record) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if record.Time.IsZero() {
+		record.Time = time.Now()
+	}
+	record.Time = record.Time.UTC()
+	record.Seq = l.seq + 1
+	record.PrevHash = l.lastHash
+
+	hash, err := record.computeHash()
+	if err != nil {
+		return err
+	}
+	record.Hash = hash
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	n, err := l.file.Write(append(data, '\n'))
+	l.size += int64(n)
+	if err != nil {
+		return err
+	}
+
+	l.seq = record.Seq
+	l.lastHash = record.Hash
+	return nil
+}
+
+// Filter selects records in Query. Zero fields match every record.
+type Filter struct {
+	User   string
+	Action string
+	JobID  string
+	Since  time.Time
+	Until  time.Time
+	// Limit keeps the most recent records, if positive.
+	Limit int
+}
+
+func (f Filter) match(record Record) bool {
+	return (f.User == "" || record.User == f.User) &&
+		(f.Action == "" || record.Action == f.Action) &&
+		(f.JobID == "" || record.JobID == f.JobID) &&
+		(f.Since.IsZero() || !record.Time.Before(f.Since)) &&
+		(f.Until.IsZero() || record.Time.Before(f.Until))
+}
+
+// Anchor returns the anchor of the last record appended to the log.
+func (l *Log) Anchor() Anchor {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return Anchor{Seq: l.seq, Hash: l.lastHash}
+}
+
+// Query returns the records of the log matching filter, in order.
+// Records appended while the log is read are not returned.
+func (l *Log) Query(filter Filter) ([]Record, error) {
+	l.mutex.Lock()
+	size := l.size
+	l.mutex.Unlock()
+
+	// a separate read handle, read up to the records written so far, does not hold up Append
+	file, err := os.Open(l.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	records := []Record{}
+	scanner := bufio.NewScanner(io.LimitReader(file, size))
+	scanner.Buffer(nil, maxRecordSize)
+	for scanner.Scan() {
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("record %d: %w", len(records)+1, err)
+		}
+		if filter.match(record) {
+			records = append(records, record)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if filter.Limit > 0 && len(records) > filter.Limit {
+		records = records[len(records)-filter.Limit:]
+	}
+	return records, nil
+}
+
+// Close closes the log file.
+func (l *Log) Close() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.file.Close()
+}
+
+// ErrTampered is returned by Verify when the log was modified after records were written.
+var ErrTampered = errors.New("audit log tampered")
+
+// Verify reads every record of an audit log, checking each record's hash and its chain
+// to the previous record. It returns the number of valid records, and an error wrapping
+// ErrTampered at the first record that was modified, inserted, reordered, or removed before
+// the last record. Records removed from the end of the log are only detected by VerifyAnchor.
+func Verify(r io.Reader) (int, error) {
+	_, count, err := verify(r, Anchor{})
+	return count, err
+}
+
+// VerifyAnchor verifies an audit log like Verify, and checks that it still holds the record
+// of anchor, taken from Log.Anchor when the log was written, so records removed from its end
+// are detected as well.
+func VerifyAnchor(r io.Reader, anchor Anchor) (int, error) {
+	_, count, err := verify(r, anchor)
+	return count, err
+}
+
+// verify returns the last valid record of the log, if any, along with Verify's results.
+// A non-zero anchor must match the record of its sequence number.
+func verify(r io.Reader, anchor Anchor) (*Record, int, error) {
+	var last *Record
+	prevHash := genesisHash
+	count := 0
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxRecordSize)
+	for scanner.Scan() {
+		line := count + 1
+
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return last, count, fmt.Errorf("%w: line %d is not a record: %v", ErrTampered, line, err)
+		}
+		if record.Seq != uint64(line) {
+			return last, count, fmt.Errorf("%w: line %d has sequence number %d", ErrTampered, line, record.Seq)
+		}
+		if record.PrevHash != prevHash {
+			return last, count, fmt.Errorf("%w: line %d does not chain to the previous record", ErrTampered, line)
+		}
+		hash, err := record.computeHash()
+		if err != nil {
+			return last, count, err
+		}
+		if record.Hash != hash {
+			return last, count, fmt.Errorf("%w: line %d does not match its hash", ErrTampered, line)
+		}
+		if record.Seq == anchor.Seq && record.Hash != anchor.Hash {
+			return last, count, fmt.Errorf("%w: line %d does not match the anchor", ErrTampered, line)
+		}
+
+		last = &record
+		prevHash = record.Hash
+		count++
+	}
+	if err := scanner.Err(); err != nil {
+		return last, count, err
+	}
+	if uint64(count) < anchor.Seq {
+		return last, count, fmt.Errorf("%w: the log ends at record %d, before the anchor %d", ErrTampered, count, anchor.Seq)
+	}
+
+	return last, count, nil
+}
@@ -0,0 +1,119 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeRecords(t *testing.T, path string, records ...Record) {
+	log, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error: %s", err.Error())
+	}
+	defer log.Close()
+
+	for _, record := range records {
+		if err := log.Append(record); err != nil {
+			t.Fatalf("Append() error: %s", err.Error())
+		}
+	}
+}
+
+func TestAppendVerify(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	writeRecords(t, path,
+		Record{User: "user1", Action: "start", Program: "/bin/echo", Args: []string{"hello"}, Result: ResultSuccess},
+		Record{User: "user2", Action: "stop", JobID: "j-1", Result: ResultDenied})
+	// reopened logs chain from their last record
+	writeRecords(t, path, Record{User: "admin1", Action: "status", JobID: "j-1", Result: ResultSuccess})
+
+	data, _ := os.ReadFile(path)
+	count, err := Verify(bytes.NewReader(data))
+	if err != nil {
+		t.Errorf("Verify() error: %s", err.Error())
+	}
+	if count != 3 {
+		t.Errorf("Verify() expected 3 records, got %d", count)
+	}
+
+	log, _ := Open(path)
+	defer log.Close()
+
+	records, err := log.Query(Filter{JobID: "j-1"})
+	if err != nil {
+		t.Errorf("Query() error: %s", err.Error())
+	}
+	if len(records) != 2 || records[0].User != "user2" || records[1].User != "admin1" {
+		t.Errorf("Query() expected records of j-1, got %+v", records)
+	}
+
+	records, _ = log.Query(Filter{Limit: 1})
+	if len(records) != 1 || records[0].Seq != 3 {
+		t.Errorf("Query() expected the last record, got %+v", records)
+	}
+	if anchor := log.Anchor(); anchor.Seq != 3 || anchor.Hash != records[0].Hash {
+		t.Errorf("Anchor() expected the last record, got %s", anchor)
+	}
+}
+
+func TestVerifyTampered(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	writeRecords(t, path,
+		Record{User: "user1", Action: "start", Result: ResultSuccess},
+		Record{User: "user1", Action: "stop", Result: ResultDenied},
+		Record{User: "user1", Action: "status", Result: ResultSuccess})
+
+	data, _ := os.ReadFile(path)
+	lines := bytes.SplitAfter(data, []byte("\n"))
+
+	tests := []struct {
+		name string
+		log  []byte
+	}{
+		{"modified", bytes.Replace(data, []byte(ResultDenied), []byte(ResultSuccess), 1)},
+		{"removed", bytes.Join([][]byte{lines[0], lines[2]}, nil)},
+		{"reordered", bytes.Join([][]byte{lines[1], lines[0], lines[2]}, nil)},
+	}
+
+	for _, test := range tests {
+		count, err := Verify(bytes.NewReader(test.log))
+		if !errors.Is(err, ErrTampered) {
+			t.Errorf("Verify() of %s log expected error: %s, got: %v", test.name, ErrTampered, err)
+		}
+		if count > 1 {
+			t.Errorf("Verify() of %s log expected at most 1 valid record, got %d", test.name, count)
+		}
+	}
+
+	// records removed from the end are only detected with an anchor
+	truncated := bytes.Join(lines[:2], nil)
+	if _, err := Verify(bytes.NewReader(truncated)); err != nil {
+		t.Errorf("Verify() of truncated log error: %s", err.Error())
+	}
+	var last Record
+	json.Unmarshal(lines[2], &last)
+	anchor, err := ParseAnchor(Anchor{Seq: last.Seq, Hash: last.Hash}.String())
+	if err != nil {
+		t.Fatalf("ParseAnchor() error: %s", err.Error())
+	}
+	if _, err := VerifyAnchor(bytes.NewReader(data), anchor); err != nil {
+		t.Errorf("VerifyAnchor() error: %s", err.Error())
+	}
+	if _, err := VerifyAnchor(bytes.NewReader(truncated), anchor); !errors.Is(err, ErrTampered) {
+		t.Errorf("VerifyAnchor() of truncated log expected error: %s, got: %v", ErrTampered, err)
+	}
+	if _, err := VerifyAnchor(bytes.NewReader(data), Anchor{Seq: 3, Hash: genesisHash}); !errors.Is(err, ErrTampered) {
+		t.Errorf("VerifyAnchor() of mismatched anchor expected error: %s, got: %v", ErrTampered, err)
+	}
+
+	// tampered logs are not appended to
+	os.WriteFile(path, tests[0].log, 0600)
+	if _, err := Open(path); !errors.Is(err, ErrTampered) {
+		t.Errorf("Open() expected error: %s, got: %v", ErrTampered, err)
+	}
+}
@@ -0,0 +1,168 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"teleport-jobworker/pkg/jobserver"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+const defaultDetachKeys = "ctrl-p,ctrl-q"
+
+var detachKeys string
+
+var attachCmd = &cobra.Command{
+	Use:   "attach",
+	Short: "Attach to the terminal of a job by ID",
+	Long: `Attach the local terminal to a job started with --tty, by providing its job ID.
+The local terminal is put in raw mode, and its window size is kept in sync with the job's terminal.
+Type the detach key sequence (default ` + defaultDetachKeys + `) to detach; the job keeps running.`,
+	Example: `jobctl attach j-12345
+jobctl attach --detach-keys ctrl-x j-12345`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		jobID := args[0]
+
+		keys, err := parseDetachKeys(detachKeys)
+		if err != nil {
+			return usageError{err}
+		}
+
+		if transport != transportHTTPS {
+			return usageError{fmt.Errorf("attaching to a terminal requires the %s transport", transportHTTPS)}
+		}
+
+		opts, err := clientOptions()
+		if err != nil {
+			return err
+		}
+		client, err := jobserver.NewClient(opts...)
+		if err != nil {
+			return err
+		}
+
+		attachment, err := client.AttachJob(jobID)
+		if err != nil {
+			return err
+		}
+		defer attachment.Close()
+
+		// restore the local terminal before printing the session summary
+		restore := func() {}
+		stdinFd := int(os.Stdin.Fd())
+		if term.IsTerminal(stdinFd) {
+			state, err := term.MakeRaw(stdinFd)
+			if err != nil {
+				return err
+			}
+			restore = func() { term.Restore(stdinFd, state) }
+			defer restore()
+
+			// keep the job's window size in sync with the local terminal
+			resize := make(chan os.Signal, 1)
+			signal.Notify(resize, syscall.SIGWINCH)
+			defer signal.Stop(resize)
+			resize <- syscall.SIGWINCH
+			go func() {
+				for range resize {
+					if cols, rows, err := term.GetSize(stdinFd); err == nil {
+						attachment.Resize(uint16(rows), uint16(cols))
+					}
+				}
+			}()
+		}
+
+		// forward local input until the detach key sequence is typed
+		detached := make(chan struct{})
+		go func() {
+			forwardInput(attachment, os.Stdin, keys)
+			close(detached)
+			attachment.Detach()
+		}()
+
+		io.Copy(cmd.OutOrStdout(), attachment)
+		restore()
+
+		select {
+		case <-detached:
+			fmt.Fprintf(cmd.OutOrStdout(), messageJobDetached, jobID)
+		default:
+			if status, exitCode, ok := attachment.ExitStatus(); ok {
+				fmt.Fprintf(cmd.OutOrStdout(), messageJobExited, jobID, status, formatExitCode(exitCode))
+			}
+		}
+		return nil
+	},
+}
+
+func init() {
+	attachCmd.Flags().StringVar(&detachKeys, "detach-keys", defaultDetachKeys,
+		"Key sequence to detach, as comma-separated keys (eg. ctrl-p,ctrl-q)")
+}
+
+// forwardInput copies input to the attachment until the detach key sequence
+// is typed, or input ends. Detach keys are withheld until they cannot match.
+func forwardInput(w io.Writer, r io.Reader, keys []byte) {
+	buf := make([]byte, 1024)
+	matched := 0
+	for {
+		n, err := r.Read(buf)
+		if err != nil {
+			return
+		}
+
+		var out bytes.Buffer
+		for _, b := range buf[:n] {
+			if b == keys[matched] {
+				matched++
+				if matched == len(keys) {
+					w.Write(out.Bytes())
+					return
+				}
+				continue
+			}
+
+			// release withheld keys that turned out not to be a detach sequence
+			out.Write(keys[:matched])
+			matched = 0
+			if b == keys[0] {
+				matched = 1
+				continue
+			}
+			out.WriteByte(b)
+		}
+
+		if out.Len() > 0 {
+			if _, err := w.Write(out.Bytes()); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// parseDetachKeys converts a comma-separated key list into bytes,
+// where each key is a single character or ctrl-<char>.
+func parseDetachKeys(value string) ([]byte, error) {
+	var keys []byte
+	for _, key := range strings.Split(value, ",") {
+		key = strings.TrimSpace(key)
+		lower := strings.ToLower(key)
+		switch {
+		case len(key) == 1:
+			keys = append(keys, key[0])
+		case len(lower) == 6 && strings.HasPrefix(lower, "ctrl-") &&
+			(lower[5] >= 'a' && lower[5] <= 'z' || strings.IndexByte("@[\\]^_", lower[5]) >= 0):
+			keys = append(keys, lower[5]&0x1f)
+		default:
+			return nil, fmt.Errorf("invalid detach key %q", key)
+		}
+	}
+	return keys, nil
+}
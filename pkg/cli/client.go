@@ -0,0 +1,118 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"teleport-jobworker/pkg/jobserver"
+	"time"
+)
+
+// Transports of job management requests
+const (
+	transportHTTPS = "https"
+	transportGRPC  = "grpc"
+)
+
+var (
+	transport string
+	caFile    string
+	certFile  string
+	keyFile   string
+)
+
+// jobClient sends job management requests, implemented by the HTTPS and gRPC clients.
+type jobClient interface {
+	StartJobRequest(request jobserver.StartRequest) (*jobserver.StartResponse, error)
+	StopJob(jobID string) (*jobserver.StopResponse, error)
+	SignalJob(jobID, signal string) (*jobserver.SignalResponse, error)
+	GrantJob(jobID string, grant jobserver.GrantRequest) (*jobserver.GrantResponse, error)
+	WriteJobStdin(jobID string, r io.Reader) (*jobserver.StdinResponse, error)
+	CloseJobStdin(jobID string) (*jobserver.StdinResponse, error)
+	GetJobStatus(jobID string) (*jobserver.StatusResponse, error)
+	WaitJob(jobID string, timeout time.Duration) (*jobserver.StatusResponse, error)
+	GetJobOutput(jobID string) (*jobserver.OutputResponse, error)
+	GetJobLogs(jobID string, since time.Time) ([]jobserver.LogRecord, error)
+	ListJobs() ([]jobserver.JobListing, error)
+	FollowJobLogs(ctx context.Context, jobID string, since time.Time, fn func(jobserver.LogRecord) error) error
+	Close() error
+}
+
+// newClient creates a client for the transport selected with --transport.
+func newClient() (jobClient, error) {
+	opts, err := clientOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	switch transport {
+	case transportHTTPS:
+		return jobserver.NewClient(opts...)
+	case transportGRPC:
+		return jobserver.NewGRPCClient(opts...)
+	}
+	return nil, fmt.Errorf("unknown transport %q, expected %s or %s", transport, transportHTTPS, transportGRPC)
+}
+
+// clientOptions configures the access token set with --token or $JOBCTL_TOKEN, or stored by jobctl login,
+// and the client certificate set with --cert and --key, if any.
+func clientOptions() ([]jobserver.ClientOption, error) {
+	opts, err := tlsOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	token := accessToken
+	if token == "" {
+		token = os.Getenv(tokenEnv)
+	}
+	if token == "" {
+		if token, err = loginToken(opts); err != nil {
+			return nil, err
+		}
+	}
+	if token != "" {
+		opts = append(opts, jobserver.WithToken(token))
+	}
+	return opts, nil
+}
+
+// tlsOptions configures the CA trusted to sign the server certificate, set with --ca or $JOBCTL_CA,
+// or stored in ~/.config/jobctl/ca.pem, and the client certificate set with --cert and --key, if any.
+// The system CAs are trusted without CA file.
+func tlsOptions() ([]jobserver.ClientOption, error) {
+	var opts []jobserver.ClientOption
+
+	ca := caFile
+	if ca == "" {
+		ca = os.Getenv(caEnv)
+	}
+	if ca == "" {
+		path, err := defaultCAPath()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := os.Stat(path); err == nil {
+			ca = path
+		}
+	}
+	if ca != "" {
+		opts = append(opts, jobserver.WithCAFile(ca))
+	}
+
+	if certFile != "" || keyFile != "" {
+		opts = append(opts, jobserver.WithClientCertificate(certFile, keyFile))
+	}
+	return opts, nil
+}
+
+// defaultCAPath returns the path of the CA file trusted by default, under ~/.config/jobctl.
+func defaultCAPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "jobctl", "ca.pem"), nil
+}
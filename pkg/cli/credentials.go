@@ -0,0 +1,150 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"teleport-jobworker/internal/fileutil"
+	"teleport-jobworker/pkg/jobserver"
+	"time"
+)
+
+// refreshMargin is how long before it expires the stored access token is refreshed.
+const refreshMargin = time.Minute
+
+// credentials are the tokens stored by jobctl login.
+type credentials struct {
+	User             string    `json:"user"`
+	AccessToken      string    `json:"accessToken"`
+	ExpiresAt        time.Time `json:"expiresAt"`
+	RefreshToken     string    `json:"refreshToken"`
+	RefreshExpiresAt time.Time `json:"refreshExpiresAt"`
+}
+
+// newCredentials stores the tokens of a login or refresh response.
+func newCredentials(user string, response *jobserver.TokenResponse) *credentials {
+	return &credentials{
+		User:             user,
+		AccessToken:      response.AccessToken,
+		ExpiresAt:        response.ExpiresAt,
+		RefreshToken:     response.RefreshToken,
+		RefreshExpiresAt: response.RefreshExpiresAt,
+	}
+}
+
+// credentialsPath returns the path of the credentials file, under ~/.config/jobctl by default.
+func credentialsPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "jobctl", "credentials.json"), nil
+}
+
+// loadCredentials reads the credentials file. Returns nil credentials if the user is not logged in.
+// The file must be owned by the user and not accessible by anyone else.
+func loadCredentials() (*credentials, error) {
+	path, err := credentialsPath()
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok && int(stat.Uid) != os.Getuid() {
+		return nil, fmt.Errorf("credentials file %s is not owned by the current user", path)
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		return nil, fmt.Errorf("credentials file %s is accessible by other users, fix with: chmod 600 %s", path, path)
+	}
+
+	var c credentials
+	if err := json.NewDecoder(file).Decode(&c); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &c, nil
+}
+
+// save replaces the credentials file atomically, readable only by the user.
+func (c *credentials) save() error {
+	path, err := credentialsPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return fileutil.WriteAtomic(path, append(data, '\n'), 0o600)
+}
+
+// removeCredentials deletes the credentials file, if any.
+func removeCredentials() error {
+	path, err := credentialsPath()
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// loginToken returns the access token stored by jobctl login, refreshing it if it is about to expire.
+// Returns an empty token if the user is not logged in.
+func loginToken(opts []jobserver.ClientOption) (string, error) {
+	c, err := loadCredentials()
+	if err != nil || c == nil {
+		return "", err
+	}
+	if time.Until(c.ExpiresAt) > refreshMargin {
+		return c.AccessToken, nil
+	}
+	if time.Now().After(c.RefreshExpiresAt) {
+		return "", errors.New("session expired, log in again with: jobctl login")
+	}
+
+	client, err := jobserver.NewClient(opts...)
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+
+	response, err := client.RefreshToken(c.RefreshToken)
+	var apiErr *jobserver.Error
+	if errors.As(err, &apiErr) {
+		// refresh tokens are only valid once: another jobctl may have refreshed them meanwhile
+		if latest, err := loadCredentials(); err == nil && latest != nil && latest.RefreshToken != c.RefreshToken {
+			return latest.AccessToken, nil
+		}
+		return "", fmt.Errorf("failed to refresh session, log in again with: jobctl login: %w", err)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	c = newCredentials(c.User, response)
+	if err := c.save(); err != nil {
+		return "", err
+	}
+	return c.AccessToken, nil
+}
@@ -0,0 +1,80 @@
+package cli
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"teleport-jobworker/pkg/jobserver"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Exit codes of jobctl when a command fails. jobctl run and jobctl wait exit with the exit code of the job
+// once it finished.
+const (
+	// exitError is the exit code of other errors, eg. requests rejected as invalid or over quota.
+	exitError = 1
+	// exitUsage is the exit code of invalid commands, arguments or flags.
+	exitUsage = 2
+	// exitAuth is the exit code of requests which are not authenticated (401) or not allowed (403).
+	exitAuth = 3
+	// exitNotFound is the exit code of requests for jobs which do not exist, or are not visible to the user (404).
+	exitNotFound = 4
+	// exitServer is the exit code of server errors (5xx), eg. the server shutting down.
+	exitServer = 5
+	// exitNetwork is the exit code of requests which did not reach the server, or got no response.
+	exitNetwork = 6
+)
+
+// usageError is an invalid command, argument or flag.
+type usageError struct {
+	err error
+}
+
+func (e usageError) Error() string {
+	return e.err.Error()
+}
+
+func (e usageError) Unwrap() error {
+	return e.err
+}
+
+// errorExitCode returns the exit code of jobctl failing with err.
+func errorExitCode(err error) int {
+	if errors.As(err, new(usageError)) {
+		return exitUsage
+	}
+
+	var apiErr *jobserver.Error
+	if errors.As(err, &apiErr) {
+		switch {
+		case apiErr.Status == http.StatusUnauthorized || apiErr.Status == http.StatusForbidden:
+			return exitAuth
+		case apiErr.Status == http.StatusNotFound:
+			return exitNotFound
+		case apiErr.Status >= http.StatusInternalServerError:
+			return exitServer
+		}
+		return exitError
+	}
+
+	// the gRPC client reports failing to reach the server by the status of the RPC
+	if s, ok := status.FromError(err); ok {
+		switch s.Code() {
+		case codes.Unavailable, codes.DeadlineExceeded:
+			return exitNetwork
+		}
+	}
+	var netErr net.Error
+	var certErr *tls.CertificateVerificationError
+	var unknownAuthority x509.UnknownAuthorityError
+	if errors.As(err, &netErr) || errors.As(err, &certErr) || errors.As(err, &unknownAuthority) ||
+		errors.Is(err, context.DeadlineExceeded) {
+		return exitNetwork
+	}
+	return exitError
+}
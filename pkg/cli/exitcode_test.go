@@ -0,0 +1,45 @@
+package cli
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"teleport-jobworker/pkg/jobserver"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestErrorExitCode(t *testing.T) {
+	dialErr := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	tests := []struct {
+		name string
+		err  error
+		code int
+	}{
+		{"usage", usageError{errors.New("empty command in pipeline")}, exitUsage},
+		{"unauthenticated", &jobserver.Error{Code: jobserver.CodeUnauthenticated, Status: http.StatusUnauthorized}, exitAuth},
+		{"policy denied", &jobserver.Error{Code: jobserver.CodePolicyDenied, Status: http.StatusForbidden}, exitAuth},
+		{"not found", &jobserver.Error{Code: jobserver.CodeJobNotFound, Status: http.StatusNotFound}, exitNotFound},
+		{"wrapped not found", fmt.Errorf("job j-12345: %w", &jobserver.Error{Status: http.StatusNotFound}), exitNotFound},
+		{"internal", &jobserver.Error{Code: jobserver.CodeInternal, Status: http.StatusInternalServerError}, exitServer},
+		{"unavailable", &jobserver.Error{Code: jobserver.CodeUnavailable, Status: http.StatusServiceUnavailable}, exitServer},
+		{"invalid command", &jobserver.Error{Code: jobserver.CodeInvalidCommand, Status: http.StatusBadRequest}, exitError},
+		{"connection refused", &url.Error{Op: "Post", URL: "https://localhost:8443/v1/jobs/start", Err: dialErr}, exitNetwork},
+		{"unknown authority", fmt.Errorf("tls: %w", x509.UnknownAuthorityError{}), exitNetwork},
+		{"grpc unavailable", status.Error(codes.Unavailable, "connection refused"), exitNetwork},
+		{"timeout", context.DeadlineExceeded, exitNetwork},
+		{"other", errors.New("timed out waiting for job j-12345"), exitError},
+	}
+
+	for _, test := range tests {
+		if code := errorExitCode(test.err); code != test.code {
+			t.Errorf("errorExitCode(%s) = %d, expected %d", test.name, code, test.code)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"teleport-jobworker/pkg/jobserver"
+	"text/template"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// Output formats, selected with --output
+const (
+	formatText = "text"
+	formatJSON = "json"
+	formatYAML = "yaml"
+	// formatTemplate is the prefix of Go templates, eg. template={{.id}}
+	formatTemplate = "template="
+)
+
+var outputFormat string
+
+// result is the result of a command, printed as text, or as its JSON fields in the other formats.
+// The JSON fields are the schema of the json and yaml formats and the data of templates.
+type result interface {
+	text(w io.Writer)
+}
+
+// validateOutputFormat checks the format set with --output, including the syntax of templates.
+func validateOutputFormat(format string) error {
+	switch format {
+	case formatText, formatJSON, formatYAML:
+		return nil
+	}
+	if text, ok := strings.CutPrefix(format, formatTemplate); ok {
+		_, err := template.New("output").Parse(text)
+		return err
+	}
+	return fmt.Errorf("unknown output format %q, expected %s, %s, %s or %s<template>",
+		format, formatText, formatJSON, formatYAML, formatTemplate)
+}
+
+// printResult prints the result of a command to stdout, in the format set with --output.
+func printResult(cmd *cobra.Command, r result) error {
+	return writeResult(cmd.OutOrStdout(), outputFormat, r)
+}
+
+// writeResult writes r to w in format.
+func writeResult(w io.Writer, format string, r result) error {
+	if format == formatText {
+		r.text(w)
+		return nil
+	}
+	if format == formatJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(r)
+	}
+
+	value, err := genericValue(r)
+	if err != nil {
+		return err
+	}
+
+	if format == formatYAML {
+		encoder := yaml.NewEncoder(w)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(value); err != nil {
+			return err
+		}
+		return encoder.Close()
+	}
+
+	text, ok := strings.CutPrefix(format, formatTemplate)
+	if !ok {
+		return validateOutputFormat(format)
+	}
+	tmpl, err := template.New("output").Parse(text)
+	if err != nil {
+		return err
+	}
+	if err := tmpl.Execute(w, value); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w)
+	return err
+}
+
+// genericValue converts r to the maps, slices and scalars of its JSON encoding,
+// keeping integers as int64 so they are not printed as floats.
+func genericValue(r result) (any, error) {
+	encoded, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return convertNumbers(value), nil
+}
+
+// convertNumbers replaces the json.Numbers of value by int64 or float64.
+func convertNumbers(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, item := range v {
+			v[key] = convertNumbers(item)
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = convertNumbers(item)
+		}
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	}
+	return value
+}
+
+// errorResult is an error printed by jobctl: errors reported by the server have the code, request ID
+// and details of the API error, and errors of jobctl itself, eg. failing to reach the server, only a message.
+type errorResult jobserver.ErrorResponse
+
+func (r errorResult) text(w io.Writer) {
+	switch {
+	case r.Error.RequestID != "":
+		fmt.Fprintf(w, messageAPIErrorRequest, r.Error.Message, r.Error.Code, r.Error.RequestID)
+	case r.Error.Code != "":
+		fmt.Fprintf(w, messageAPIError, r.Error.Message, r.Error.Code)
+	default:
+		fmt.Fprintf(w, messageError, r.Error.Message)
+	}
+}
+
+// printError prints err to stderr, in the json or yaml format if set with --output, or as text.
+func printError(cmd *cobra.Command, err error) {
+	writeError(cmd.ErrOrStderr(), outputFormat, err)
+}
+
+// writeError writes err to w in format, as text for templates.
+func writeError(w io.Writer, format string, err error) {
+	r := errorResult{Error: jobserver.Error{Message: err.Error()}}
+	var apiErr *jobserver.Error
+	if errors.As(err, &apiErr) {
+		r.Error = *apiErr
+	}
+
+	if format != formatJSON && format != formatYAML {
+		format = formatText
+	}
+	writeResult(w, format, r)
+}
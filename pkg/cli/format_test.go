@@ -0,0 +1,122 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"teleport-jobworker/pkg/job"
+	"teleport-jobworker/pkg/jobserver"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// goldenResults are the results of every command, with a template using their fields.
+var goldenResults = func() []struct {
+	name     string
+	result   result
+	template string
+} {
+	exitCode, failedCode, stoppedCode := 0, 3, -1
+	started := time.Date(2025, 1, 2, 15, 4, 5, 0, time.UTC)
+	expires := time.Date(2099, 1, 2, 17, 4, 5, 0, time.UTC)
+	status := jobserver.StatusResponse{ID: "j-12345", Status: job.Completed, ExitCode: &failedCode, StageExitCodes: []int{0, 3}}
+
+	return []struct {
+		name     string
+		result   result
+		template string
+	}{
+		{"start", startResult{ID: "j-12345"}, "{{.id}}"},
+		{"stop", stopResult{ID: "j-12345"}, "{{.id}}"},
+		{"signal", signalResult{ID: "j-12345", Signal: "HUP"}, "{{.id}} {{.signal}}"},
+		{"status", statusResult(status), "{{.status}} {{.exitCode}}"},
+		{"wait", waitResult{Jobs: []jobserver.StatusResponse{status, {ID: "j-67890", Status: job.Stopped, ExitCode: &stoppedCode, Signal: 9}}},
+			"{{range .jobs}}{{.id}} {{.status}} {{.signal}}\n{{end}}"},
+		{"list", listResult{Jobs: []jobserver.JobListing{
+			{ID: "j-12345", Owner: "user1", Status: job.Completed, ExitCode: &exitCode, Labels: map[string]string{"team": "web", "env": "dev"}},
+			{ID: "j-67890", Owner: "user2", Status: job.Running},
+		}}, "{{range .jobs}}{{.id}} {{.owner}}\n{{end}}"},
+		{"output", outputResult{ID: "j-12345", Stdout: "hello world\n", Stderr: "<warning> & more\n"}, "{{.stdout}}"},
+		{"logs", logsResult{LogsResponse: jobserver.LogsResponse{ID: "j-12345", Records: []jobserver.LogRecord{
+			{Seq: 1, Time: started, Stream: job.Stdout, Data: "hello\n"},
+			{Seq: 2, Time: started.Add(time.Millisecond), Stream: job.Stderr, Data: "world\n"},
+		}}, timestamps: true}, "{{range .records}}{{.seq}} {{.stream}} {{.data}}{{end}}"},
+		{"share", shareResult{ID: "j-12345", Grants: []jobserver.Grant{
+			{Users: []string{"user2"}, Access: job.AccessRead, GrantedBy: "user1"},
+			{Groups: []string{"ops"}, Access: job.AccessControl, ExpiresAt: &expires, GrantedBy: "user1"},
+		}}, "{{range .grants}}{{.access}} {{end}}"},
+		{"version", versionResult{
+			Client: versionInfo{Version: "v1.2.0", Commit: "1a2b3c4d5e6f7a8b9c0d"},
+			Server: &jobserver.InfoResponse{Version: "v1.3.0", Commit: "0d9c8b7a6f5e4d3c2b1a", APIVersion: "v1", StartedAt: started,
+				UptimeSeconds: 3600, Features: []string{"grpc", "tokens"},
+				Limits: jobserver.InfoLimits{MaxRequestBody: 1 << 20, MaxArgs: 1024, MaxArgsSize: 256 << 10}},
+		}, "{{.client.version}} {{.server.version}}"},
+		{"login", loginResult{User: "user1"}, "{{.user}}"},
+		{"logout", logoutResult{}, "logged out"},
+	}
+}()
+
+// goldenErrors are errors reported by the server, and by jobctl itself.
+var goldenErrors = []struct {
+	name string
+	err  error
+}{
+	{"server error", &jobserver.Error{Code: jobserver.CodeJobNotFound, Message: "job not found", RequestID: "4f1c2a7e",
+		Details: map[string]string{"id": "j-12345"}}},
+	{"client error", errors.New("dial tcp 127.0.0.1:8443: connect: connection refused")},
+}
+
+func TestOutputFormats(t *testing.T) {
+	for _, format := range []string{formatText, formatJSON, formatYAML, formatTemplate} {
+		var output bytes.Buffer
+		for _, golden := range goldenResults {
+			fmt.Fprintf(&output, "### %s\n", golden.name)
+			resultFormat := format
+			if format == formatTemplate {
+				resultFormat += golden.template
+			}
+			if err := writeResult(&output, resultFormat, golden.result); err != nil {
+				t.Errorf("writeResult(%s, %s) error: %s", resultFormat, golden.name, err.Error())
+			}
+		}
+		for _, golden := range goldenErrors {
+			fmt.Fprintf(&output, "### %s\n", golden.name)
+			writeError(&output, format, golden.err)
+		}
+
+		name := filepath.Join("testdata", "output."+strings.TrimSuffix(format, "=")+".golden")
+		if *update {
+			if err := os.WriteFile(name, output.Bytes(), 0o644); err != nil {
+				t.Fatalf("WriteFile() error: %s", err.Error())
+			}
+		}
+
+		expected, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatalf("ReadFile() error: %s", err.Error())
+		}
+		if !bytes.Equal(output.Bytes(), expected) {
+			t.Errorf("%s output differs from %s, run go test -update to update:\n%s", format, name, output.String())
+		}
+	}
+}
+
+func TestValidateOutputFormat(t *testing.T) {
+	for _, format := range []string{formatText, formatJSON, formatYAML, "template={{.id}}"} {
+		if err := validateOutputFormat(format); err != nil {
+			t.Errorf("validateOutputFormat(%q) error: %s", format, err.Error())
+		}
+	}
+
+	for _, format := range []string{"xml", "template={{.id", "{{.id}}"} {
+		if err := validateOutputFormat(format); err == nil {
+			t.Errorf("validateOutputFormat(%q) expected error", format)
+		}
+	}
+}
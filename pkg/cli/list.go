@@ -0,0 +1,57 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"teleport-jobworker/pkg/jobserver"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+var listCmd = &cobra.Command{
+	Use:     "list",
+	Short:   "List jobs",
+	Long:    "List the jobs you may list, eg. your own jobs, or every job for admins, oldest first.",
+	Example: "jobctl list",
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		jobs, err := client.ListJobs()
+		if err != nil {
+			return err
+		}
+
+		return printResult(cmd, listResult{Jobs: jobs})
+	},
+}
+
+// listResult is the result of jobctl list, printed as a table in the text format.
+type listResult jobserver.ListResponse
+
+func (r listResult) text(w io.Writer) {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "ID\tOWNER\tSTATUS\tEXIT CODE\tLABELS")
+	for _, listed := range r.Jobs {
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\n",
+			listed.ID, listed.Owner, listed.Status, formatExitCode(listed.ExitCode), formatLabels(listed.Labels))
+	}
+	table.Flush()
+}
+
+// formatLabels formats labels as comma-separated key=value pairs, sorted by key.
+func formatLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for _, key := range slices.Sorted(maps.Keys(labels)) {
+		pairs = append(pairs, key+"="+labels[key])
+	}
+	return strings.Join(pairs, ",")
+}
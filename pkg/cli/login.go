@@ -0,0 +1,135 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"teleport-jobworker/pkg/jobserver"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+const (
+	messageLoggedIn  = "Logged in as %s\n"
+	messageLoggedOut = "Logged out\n"
+)
+
+var (
+	loginUser     string
+	passwordStdin bool
+)
+
+var loginCmd = &cobra.Command{
+	Use:   "login",
+	Short: "Log in to the job server",
+	Long: `Log in with a user name and password, and store the issued tokens in ~/.config/jobctl/credentials.json.
+Other commands then authenticate with the stored access token, refreshed automatically before it expires.
+The password is prompted for, or read from stdin with --password-stdin.`,
+	Example: `jobctl login --user user1
+echo "$PASSWORD" | jobctl login --user user1 --password-stdin`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		password, err := readPassword(cmd)
+		if err != nil {
+			return err
+		}
+
+		opts, err := tlsOptions()
+		if err != nil {
+			return err
+		}
+		client, err := jobserver.NewClient(opts...)
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		response, err := client.Login(loginUser, password)
+		if err != nil {
+			return err
+		}
+
+		if err := newCredentials(loginUser, response).save(); err != nil {
+			return err
+		}
+		return printResult(cmd, loginResult{User: loginUser})
+	},
+}
+
+var logoutCmd = &cobra.Command{
+	Use:   "logout",
+	Short: "Log out of the job server",
+	Long:  "Revoke the tokens stored by jobctl login, and delete them.",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := loadCredentials()
+		if err != nil {
+			return err
+		}
+
+		if c != nil {
+			opts, err := tlsOptions()
+			if err != nil {
+				return err
+			}
+			client, err := jobserver.NewClient(append(opts, jobserver.WithToken(c.AccessToken))...)
+			if err != nil {
+				return err
+			}
+			defer client.Close()
+
+			// the stored tokens are deleted even if the server cannot revoke them, eg. once expired
+			if err := client.Logout(c.RefreshToken); err != nil {
+				fmt.Fprintf(cmd.ErrOrStderr(), "Warning: failed to revoke tokens: %v\n", err)
+			}
+		}
+
+		if err := removeCredentials(); err != nil {
+			return err
+		}
+		return printResult(cmd, logoutResult{})
+	},
+}
+
+func init() {
+	loginCmd.Flags().StringVar(&loginUser, "user", "", "User name")
+	loginCmd.MarkFlagRequired("user")
+	loginCmd.Flags().BoolVar(&passwordStdin, "password-stdin", false, "Read the password from stdin")
+}
+
+// loginResult is the result of jobctl login.
+type loginResult struct {
+	User string `json:"user"`
+}
+
+func (r loginResult) text(w io.Writer) {
+	fmt.Fprintf(w, messageLoggedIn, r.User)
+}
+
+// logoutResult is the result of jobctl logout, without fields.
+type logoutResult struct{}
+
+func (r logoutResult) text(w io.Writer) {
+	fmt.Fprint(w, messageLoggedOut)
+}
+
+// readPassword prompts for the password without echo, or reads it from stdin.
+func readPassword(cmd *cobra.Command) (string, error) {
+	stdinFd := int(os.Stdin.Fd())
+	if !passwordStdin && term.IsTerminal(stdinFd) {
+		fmt.Fprint(cmd.ErrOrStderr(), "Password: ")
+		password, err := term.ReadPassword(stdinFd)
+		fmt.Fprintln(cmd.ErrOrStderr())
+		return string(password), err
+	}
+
+	password, err := bufio.NewReader(cmd.InOrStdin()).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	return strings.TrimRight(password, "\r\n"), nil
+}
@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"teleport-jobworker/pkg/jobserver"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	logsTimestamps bool
+	logsSince      string
+)
+
+var logsCmd = &cobra.Command{
+	Use:   "logs",
+	Short: "Get timestamped output records of job by ID",
+	Long: `Get the merged standard output and standard error records of a job by providing its job ID.
+Records are printed in the order they were written by the job.`,
+	Example: `jobctl logs --timestamps j-12345
+jobctl logs --since 2025-01-02T15:04:05Z j-12345`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		jobID := args[0]
+
+		var since time.Time
+		if logsSince != "" {
+			var err error
+			since, err = time.Parse(time.RFC3339Nano, logsSince)
+			if err != nil {
+				return usageError{fmt.Errorf("invalid --since timestamp %q, expected RFC 3339, eg. 2025-01-02T15:04:05Z", logsSince)}
+			}
+		}
+
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		records, err := client.GetJobLogs(jobID, since)
+		if err != nil {
+			return err
+		}
+
+		return printResult(cmd, logsResult{LogsResponse: jobserver.LogsResponse{ID: jobID, Records: records}, timestamps: logsTimestamps})
+	},
+}
+
+func init() {
+	logsCmd.Flags().BoolVarP(&logsTimestamps, "timestamps", "t", false, "Prefix each record with its timestamp and stream")
+	logsCmd.Flags().StringVar(&logsSince, "since", "", "Only show records written at or after an RFC 3339 timestamp")
+}
+
+// logsResult is the result of jobctl logs. The text format prints the data of each record,
+// prefixed with its timestamp and stream with --timestamps.
+type logsResult struct {
+	jobserver.LogsResponse
+	timestamps bool
+}
+
+func (r logsResult) text(w io.Writer) {
+	for _, record := range r.Records {
+		if r.timestamps {
+			fmt.Fprintf(w, messageJobLogTimestamp, record.Time.Format(time.RFC3339Nano), record.Stream)
+		}
+		fmt.Fprint(w, record.Data)
+	}
+}
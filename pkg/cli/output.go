@@ -2,6 +2,7 @@ package cli
 
 import (
 	"fmt"
+	"io"
 	"teleport-jobworker/pkg/jobserver"
 
 	"github.com/spf13/cobra"
@@ -13,31 +14,27 @@ var outputCmd = &cobra.Command{
 	Long:    "Get the standard output and standard error streams of a job by providing its job ID.",
 	Example: "jobctl output j-12345",
 	Args:    cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		if len(args) != 1 {
-			fmt.Fprint(cmd.ErrOrStderr(), errIncorrectArgs)
-			return
-		}
-
+	RunE: func(cmd *cobra.Command, args []string) error {
 		jobID := args[0]
 
-		client, err := jobserver.NewClient()
+		client, err := newClient()
 		if err != nil {
-			fmt.Fprintf(cmd.ErrOrStderr(), "Error: %v", err)
-			return
+			return err
 		}
+		defer client.Close()
 
-		response, err := client.GetJobOutput(user, jobID)
+		response, err := client.GetJobOutput(jobID)
 		if err != nil {
-			fmt.Fprintf(cmd.ErrOrStderr(), "Error: %v", err)
-			return
-		}
-
-		if response.Error != nil {
-			fmt.Fprintf(cmd.OutOrStdout(), messageJobError, *response.Error)
-			return
+			return err
 		}
 
-		fmt.Fprintf(cmd.OutOrStdout(), messageJobOutput, response.ID, response.Stdout, response.Stderr)
+		return printResult(cmd, outputResult(*response))
 	},
 }
+
+// outputResult is the result of jobctl output.
+type outputResult jobserver.OutputResponse
+
+func (r outputResult) text(w io.Writer) {
+	fmt.Fprintf(w, messageJobOutput, r.ID, r.Stdout, r.Stderr)
+}
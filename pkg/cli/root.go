@@ -8,40 +8,115 @@ import (
 )
 
 const (
-	errIncorrectArgs  = "Error: incorrect number of args"
-	messageJobStarted = "Job started with ID %s\n"
-	messageJobStopped = "Job stopped for ID %s\n"
-	messageJobStatus  = "Job status for ID %s\nStatus: %s\nExit code: %s\n"
-	messageJobOutput  = "Job output for ID %s\nstdout:\n%s\nstderr:\n%s\n"
-	messageJobError   = "Error with job: %s\n"
+	messageJobStarted  = "Job started with ID %s\n"
+	messageJobStopped  = "Job stopped for ID %s\n"
+	messageJobSignaled = "Signal %s sent to job ID %s\n"
+	messageJobStatus   = "Job status for ID %s\nStatus: %s\nExit code: %s\n"
+	messageJobOutput   = "Job output for ID %s\nstdout:\n%s\nstderr:\n%s\n"
+	messageJobShared   = "Job %s shared, grants:\n"
+
+	messageError           = "Error: %s\n"
+	messageAPIError        = "Error: %s (%s)\n"
+	messageAPIErrorRequest = "Error: %s (%s, request ID %s)\n"
+
+	messageJobLogTimestamp = "%s %s "
+	messageJobDetached     = "\nDetached from job %s\n"
+	messageJobExited       = "\nJob %s exited\nStatus: %s\nExit code: %s\n"
+	messageJobStages       = "Stage exit codes: %s\n"
+	messageJobStopping     = "\nStopping job %s, press Ctrl-C again to kill it\n"
+	messageJobKilling      = "\nKilling job %s\n"
+
+	messageClientVersion   = "Client version: %s (commit %s)\n"
+	messageServerVersion   = "Server version: %s (commit %s), API %s\n"
+	messageVersionMismatch = "Warning: client %s (API %s) may not be compatible with server %s (API %s)\n"
 )
 
-var user string
+// tokenEnv is the environment variable holding the access token, unless set with --token.
+const tokenEnv = "JOBCTL_TOKEN"
+
+// caEnv is the environment variable holding the CA file, unless set with --ca.
+const caEnv = "JOBCTL_CA"
+
+var accessToken string
+
+// exitCode is the exit code of jobctl once the command ran without error, eg. the exit code of the job
+// for jobctl run and jobctl wait.
+var exitCode int
 
 var rootCmd = &cobra.Command{
 	Use:   "jobctl",
 	Short: "Manage jobs for Linux processes",
 	Long: "jobctl allows users to perform job functions " +
-		"on Linux processes over HTTPS: start, stop, get status, get output.",
+		"on Linux processes over HTTPS or gRPC: start, stop, get status, get output.",
 	CompletionOptions: cobra.CompletionOptions{
 		DisableDefaultCmd: true,
 	},
+	SilenceErrors: true,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := validateOutputFormat(outputFormat); err != nil {
+			return usageError{err}
+		}
+		if transport != transportHTTPS && transport != transportGRPC {
+			return usageError{fmt.Errorf("unknown transport %q, expected %s or %s", transport, transportHTTPS, transportGRPC)}
+		}
+		// cobra only checks the required flags after this hook
+		if err := cmd.ValidateRequiredFlags(); err != nil {
+			return usageError{err}
+		}
+		if err := cmd.ValidateFlagGroups(); err != nil {
+			return usageError{err}
+		}
+		// the arguments and flags are valid, later errors are not usage errors
+		cmd.SilenceUsage = true
+		return nil
+	},
 }
 
 func init() {
-	// optional user flag to signify to server a different user ID
-	rootCmd.PersistentFlags().StringVarP(&user, "user", "u", "user1", "Assign a user ID to client")
+	rootCmd.PersistentFlags().StringVar(&accessToken, "token", "",
+		"Access token issued by jobserver token issue (default $"+tokenEnv+", or the token stored by jobctl login)")
+	rootCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", formatText,
+		"Output format: text, json, yaml, or a Go template of the JSON fields, eg. template={{.id}}")
+	rootCmd.PersistentFlags().StringVar(&transport, "transport", transportHTTPS,
+		"Send requests with the HTTPS JSON API (https) or the gRPC API (grpc)")
+	rootCmd.PersistentFlags().StringVar(&caFile, "ca", "",
+		"PEM CA file trusted to sign the server certificate, eg. jobserver-ca.pem "+
+			"(default $"+caEnv+", or ~/.config/jobctl/ca.pem if it exists, or the system CAs)")
+	rootCmd.PersistentFlags().StringVar(&certFile, "cert", "",
+		"PEM client certificate file, for servers requiring client certificates (mutual TLS)")
+	rootCmd.PersistentFlags().StringVar(&keyFile, "key", "", "PEM private key file of the client certificate")
 
 	cobra.EnableCommandSorting = false
 	rootCmd.AddCommand(startCmd)
+	rootCmd.AddCommand(runCmd)
 	rootCmd.AddCommand(stopCmd)
+	rootCmd.AddCommand(signalCmd)
 	rootCmd.AddCommand(statusCmd)
+	rootCmd.AddCommand(waitCmd)
+	rootCmd.AddCommand(listCmd)
 	rootCmd.AddCommand(outputCmd)
+	rootCmd.AddCommand(logsCmd)
+	rootCmd.AddCommand(attachCmd)
+	rootCmd.AddCommand(shareCmd)
+	rootCmd.AddCommand(loginCmd)
+	rootCmd.AddCommand(logoutCmd)
+	rootCmd.AddCommand(versionCmd)
 }
 
+// Execute runs the command given by the arguments, and exits with a non-zero exit code
+// if it failed (see exitcode.go).
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %s", err)
-		os.Exit(1)
+	cmd, err := rootCmd.ExecuteC()
+	if err != nil {
+		// errors returned before PersistentPreRunE validated the command, eg. unknown flags
+		// or a wrong number of arguments, are usage errors
+		if !cmd.SilenceUsage {
+			err = usageError{err}
+		}
+		printError(cmd, err)
+		exitCode = errorExitCode(err)
+	}
+	if exitCode != 0 {
+		os.Exit(exitCode)
 	}
 }
@@ -0,0 +1,110 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"teleport-jobworker/pkg/job"
+	"teleport-jobworker/pkg/jobserver"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	runPipefail bool
+	runLabels   map[string]string
+)
+
+var runCmd = &cobra.Command{
+	Use:   "run",
+	Short: "Start a job, stream its output and exit with its exit code",
+	Long: `Start a new job like jobctl start, then stream its stdout and stderr to the local stdout and stderr
+until it exits, and exit with the exit code of the job, or 128 plus the signal number if it was killed.
+The job ID is printed to stderr. Ctrl-C sends SIGTERM to the job, and a second Ctrl-C kills it.`,
+	Example: `jobctl run -- /usr/bin/make test
+jobctl run --pipefail -- /bin/cat /var/log/syslog "|" /bin/grep error`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		code, err := runJob(cmd, args)
+		exitCode = code
+		return err
+	},
+}
+
+func init() {
+	runCmd.Flags().BoolVar(&runPipefail, "pipefail", false,
+		"Report the exit code of the last pipeline stage that did not succeed")
+	runCmd.Flags().StringToStringVarP(&runLabels, "label", "l", nil,
+		"Label the job with key=value, matched by the roles of the server (repeatable)")
+}
+
+// runJob starts the job, streams its output until it exits, and returns the exit code of the job.
+func runJob(cmd *cobra.Command, args []string) (int, error) {
+	pipeline, err := parsePipeline(args)
+	if err != nil {
+		return 0, usageError{err}
+	}
+
+	startRequest := jobserver.StartRequest{Pipefail: runPipefail, Labels: runLabels}
+	if len(pipeline) == 1 {
+		startRequest.Program, startRequest.Args = pipeline[0].Program, pipeline[0].Args
+	} else {
+		startRequest.Pipeline = pipeline
+	}
+
+	client, err := newClient()
+	if err != nil {
+		return 0, err
+	}
+	defer client.Close()
+
+	response, err := client.StartJobRequest(startRequest)
+	if err != nil {
+		return 0, err
+	}
+	fmt.Fprintf(cmd.ErrOrStderr(), messageJobStarted, response.ID)
+
+	interrupts := make(chan os.Signal, 2)
+	signal.Notify(interrupts, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupts)
+	go forwardInterrupts(cmd, client, response.ID, interrupts)
+
+	// the output ends once the job exited
+	err = client.FollowJobLogs(context.Background(), response.ID, time.Time{}, func(record jobserver.LogRecord) error {
+		var w io.Writer = cmd.OutOrStdout()
+		if record.Stream == job.Stderr {
+			w = cmd.ErrOrStderr()
+		}
+		_, err := io.WriteString(w, record.Data)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	status, err := waitFinished(client, response.ID, time.Time{})
+	if err != nil {
+		return 0, err
+	}
+	return jobExitCode(status), nil
+}
+
+// forwardInterrupts stops the job on the first interrupt with SIGTERM, and kills it on the next one.
+func forwardInterrupts(cmd *cobra.Command, client jobClient, jobID string, interrupts <-chan os.Signal) {
+	<-interrupts
+	fmt.Fprintf(cmd.ErrOrStderr(), messageJobStopping, jobID)
+	if _, err := client.SignalJob(jobID, "TERM"); err != nil {
+		printError(cmd, err)
+	}
+
+	<-interrupts
+	fmt.Fprintf(cmd.ErrOrStderr(), messageJobKilling, jobID)
+	if _, err := client.StopJob(jobID); err != nil {
+		printError(cmd, err)
+	}
+}
@@ -0,0 +1,43 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+)
+
+var signalCmd = &cobra.Command{
+	Use:   "signal",
+	Short: "Send a signal to a running job by ID",
+	Long: `Send a signal to the processes of a running job by providing its job ID and a signal name:
+HUP, INT, QUIT, KILL, USR1, USR2, TERM, CONT, STOP or TSTP, with or without the SIG prefix.`,
+	Example: "jobctl signal j-12345 HUP",
+	Args:    cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		jobID, signal := args[0], args[1]
+
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		response, err := client.SignalJob(jobID, signal)
+		if err != nil {
+			return err
+		}
+
+		return printResult(cmd, signalResult{ID: response.ID, Signal: signal})
+	},
+}
+
+// signalResult is the result of jobctl signal.
+type signalResult struct {
+	ID     string `json:"id"`
+	Signal string `json:"signal"`
+}
+
+func (r signalResult) text(w io.Writer) {
+	fmt.Fprintf(w, messageJobSignaled, r.Signal, r.ID)
+}
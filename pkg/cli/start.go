@@ -2,48 +2,111 @@ package cli
 
 import (
 	"fmt"
+	"io"
+	"os"
 	"teleport-jobworker/pkg/jobserver"
 
 	"github.com/spf13/cobra"
 )
 
+var (
+	startStdin    bool
+	startTTY      bool
+	startPipefail bool
+	startLabels   map[string]string
+)
+
+// pipelineSeparator separates the commands of a pipeline, and must be quoted in the shell.
+const pipelineSeparator = "|"
+
 var startCmd = &cobra.Command{
 	Use:   "start",
 	Short: "Start a new job",
 	Long: `Start a new job by specifying the absolute path to a program and optional arguments.
+Several programs can be run as a pipeline, without a shell, by separating them with a quoted "|".
 A new job ID will be returned.`,
-	Example: `jobctl start /bin/echo "Hello world!"`,
-	Args:    cobra.MinimumNArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		if len(args) < 1 {
-			fmt.Fprint(cmd.ErrOrStderr(), errIncorrectArgs)
-			return
+	Example: `jobctl start /bin/echo "Hello world!"
+echo "Hello world!" | jobctl start --stdin /bin/cat
+jobctl start --tty /bin/bash
+jobctl start --label team=web --label env=dev /usr/bin/make test
+jobctl start --pipefail -- /bin/cat /var/log/syslog "|" /bin/grep error "|" /usr/bin/wc -l`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		pipeline, err := parsePipeline(args)
+		if err != nil {
+			return usageError{err}
 		}
 
-		program := args[0]
-		programArgs := []string{}
-
-		if len(args) > 1 {
-			programArgs = args[1:]
+		startRequest := jobserver.StartRequest{
+			Pipefail: startPipefail,
+			Stdin:    startStdin,
+			TTY:      startTTY,
+			Labels:   startLabels,
+		}
+		if len(pipeline) == 1 {
+			startRequest.Program, startRequest.Args = pipeline[0].Program, pipeline[0].Args
+		} else {
+			startRequest.Pipeline = pipeline
 		}
 
-		client, err := jobserver.NewClient()
+		client, err := newClient()
 		if err != nil {
-			fmt.Fprintf(cmd.ErrOrStderr(), "Error: %v", err)
-			return
+			return err
 		}
+		defer client.Close()
 
-		response, err := client.StartJob(user, program, programArgs)
+		response, err := client.StartJobRequest(startRequest)
 		if err != nil {
-			fmt.Fprintf(cmd.ErrOrStderr(), "Error: %v", err)
-			return
+			return err
+		}
+
+		if err := printResult(cmd, startResult(*response)); err != nil || !startStdin {
+			return err
 		}
 
-		if response.Error != nil {
-			fmt.Fprintf(cmd.OutOrStdout(), messageJobError, *response.Error)
-			return
+		// pipe local stdin to the job until EOF, then close the job's stdin
+		if _, err := client.WriteJobStdin(response.ID, os.Stdin); err != nil {
+			return err
 		}
 
-		fmt.Fprintf(cmd.OutOrStdout(), messageJobStarted, response.ID)
+		_, err = client.CloseJobStdin(response.ID)
+		return err
 	},
 }
+
+func init() {
+	startCmd.Flags().BoolVar(&startStdin, "stdin", false, "Pipe local stdin to the job until EOF")
+	startCmd.Flags().BoolVarP(&startTTY, "tty", "t", false, "Run the job on a pseudo-terminal, to use with jobctl attach")
+	startCmd.Flags().BoolVar(&startPipefail, "pipefail", false,
+		"Report the exit code of the last pipeline stage that did not succeed")
+	startCmd.Flags().StringToStringVarP(&startLabels, "label", "l", nil,
+		"Label the job with key=value, matched by the roles of the server (repeatable)")
+}
+
+// startResult is the result of jobctl start.
+type startResult jobserver.StartResponse
+
+func (r startResult) text(w io.Writer) {
+	fmt.Fprintf(w, messageJobStarted, r.ID)
+}
+
+// parsePipeline splits args into the commands of a pipeline, separated by pipelineSeparator.
+func parsePipeline(args []string) ([]jobserver.Command, error) {
+	pipeline := []jobserver.Command{}
+	start := 0
+	for i := 0; i <= len(args); i++ {
+		if i < len(args) && args[i] != pipelineSeparator {
+			continue
+		}
+
+		if i == start {
+			return nil, fmt.Errorf("empty command in pipeline")
+		}
+		pipeline = append(pipeline, jobserver.Command{
+			Program: args[start],
+			Args:    append([]string{}, args[start+1:i]...),
+		})
+		start = i + 1
+	}
+	return pipeline, nil
+}
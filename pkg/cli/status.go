@@ -2,7 +2,9 @@ package cli
 
 import (
 	"fmt"
+	"io"
 	"strconv"
+	"strings"
 	"teleport-jobworker/pkg/jobserver"
 
 	"github.com/spf13/cobra"
@@ -14,36 +16,38 @@ var statusCmd = &cobra.Command{
 	Long:    "Get the job status and exit code by providing its job ID.",
 	Example: "jobctl status j-12345",
 	Args:    cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		if len(args) != 1 {
-			fmt.Fprint(cmd.ErrOrStderr(), errIncorrectArgs)
-			return
-		}
-
+	RunE: func(cmd *cobra.Command, args []string) error {
 		jobID := args[0]
 
-		client, err := jobserver.NewClient()
+		client, err := newClient()
 		if err != nil {
-			fmt.Fprintf(cmd.ErrOrStderr(), "Error: %v", err)
-			return
+			return err
 		}
+		defer client.Close()
 
-		response, err := client.GetJobStatus(user, jobID)
+		response, err := client.GetJobStatus(jobID)
 		if err != nil {
-			fmt.Fprintf(cmd.ErrOrStderr(), "Error: %v", err)
-			return
+			return err
 		}
 
-		if response.Error != nil {
-			fmt.Fprintf(cmd.OutOrStdout(), messageJobError, *response.Error)
-			return
-		}
+		return printResult(cmd, statusResult(*response))
+	},
+}
 
-		exitCode := ""
-		if response.ExitCode != nil {
-			exitCode = strconv.Itoa(*response.ExitCode)
-		}
+// statusResult is the result of jobctl status.
+type statusResult jobserver.StatusResponse
 
-		fmt.Fprintf(cmd.OutOrStdout(), messageJobStatus, response.ID, response.Status, exitCode)
-	},
+func (r statusResult) text(w io.Writer) {
+	fmt.Fprintf(w, messageJobStatus, r.ID, r.Status, formatExitCode(r.ExitCode))
+	if len(r.StageExitCodes) > 1 {
+		fmt.Fprintf(w, messageJobStages, strings.Trim(fmt.Sprint(r.StageExitCodes), "[]"))
+	}
+}
+
+// formatExitCode formats an optional exit code, empty until the job exited.
+func formatExitCode(exitCode *int) string {
+	if exitCode == nil {
+		return ""
+	}
+	return strconv.Itoa(*exitCode)
 }
@@ -2,6 +2,7 @@ package cli
 
 import (
 	"fmt"
+	"io"
 	"teleport-jobworker/pkg/jobserver"
 
 	"github.com/spf13/cobra"
@@ -13,31 +14,27 @@ var stopCmd = &cobra.Command{
 	Long:    "Stop the execution of a running job by providing its job ID.",
 	Example: "jobctl stop j-12345",
 	Args:    cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		if len(args) != 1 {
-			fmt.Fprint(cmd.ErrOrStderr(), errIncorrectArgs)
-			return
-		}
-
+	RunE: func(cmd *cobra.Command, args []string) error {
 		jobID := args[0]
 
-		client, err := jobserver.NewClient()
+		client, err := newClient()
 		if err != nil {
-			fmt.Fprintf(cmd.ErrOrStderr(), "Error: %v", err)
-			return
+			return err
 		}
+		defer client.Close()
 
-		response, err := client.StopJob(user, jobID)
+		response, err := client.StopJob(jobID)
 		if err != nil {
-			fmt.Fprintf(cmd.ErrOrStderr(), "Error: %v", err)
-			return
-		}
-
-		if response.Error != nil {
-			fmt.Fprintf(cmd.OutOrStdout(), messageJobError, *response.Error)
-			return
+			return err
 		}
 
-		fmt.Fprintf(cmd.OutOrStdout(), messageJobStopped, response.ID)
+		return printResult(cmd, stopResult(*response))
 	},
 }
+
+// stopResult is the result of jobctl stop.
+type stopResult jobserver.StopResponse
+
+func (r stopResult) text(w io.Writer) {
+	fmt.Fprintf(w, messageJobStopped, r.ID)
+}
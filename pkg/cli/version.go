@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"teleport-jobworker/pkg/jobserver"
+	"teleport-jobworker/pkg/version"
+
+	"github.com/spf13/cobra"
+)
+
+var versionClientOnly bool
+
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Print the client and server versions",
+	Long: `Print the version of jobctl and of the server, requested with the HTTPS API whatever the --transport.
+A warning is printed when the versions are not compatible.`,
+	Example: `jobctl version
+jobctl version --client`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		result := versionResult{Client: versionInfo{Version: version.Version, Commit: version.BuildCommit()}}
+		if versionClientOnly {
+			return printResult(cmd, result)
+		}
+
+		opts, err := clientOptions()
+		if err != nil {
+			return err
+		}
+		client, err := jobserver.NewClient(opts...)
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		info, err := client.GetInfo()
+		if err != nil {
+			return err
+		}
+		result.Server = info
+		if err := printResult(cmd, result); err != nil {
+			return err
+		}
+
+		apiVersion := strings.TrimPrefix(jobserver.APIPrefix, "/")
+		if !version.Compatible(version.Version, info.Version) || info.APIVersion != apiVersion {
+			fmt.Fprintf(cmd.ErrOrStderr(), messageVersionMismatch, version.Version, apiVersion, info.Version, info.APIVersion)
+		}
+		return nil
+	},
+}
+
+func init() {
+	versionCmd.Flags().BoolVar(&versionClientOnly, "client", false, "Print the client version only, without contacting the server")
+}
+
+// versionInfo is the version of a jobctl build.
+type versionInfo struct {
+	Version string `json:"version"`
+	Commit  string `json:"commit"`
+}
+
+// versionResult is the result of jobctl version, with the server information unless --client is set.
+type versionResult struct {
+	Client versionInfo             `json:"client"`
+	Server *jobserver.InfoResponse `json:"server,omitempty"`
+}
+
+func (r versionResult) text(w io.Writer) {
+	fmt.Fprintf(w, messageClientVersion, r.Client.Version, shortCommit(r.Client.Commit))
+	if r.Server != nil {
+		fmt.Fprintf(w, messageServerVersion, r.Server.Version, shortCommit(r.Server.Commit), r.Server.APIVersion)
+	}
+}
+
+// shortCommit abbreviates a commit hash for display.
+func shortCommit(commit string) string {
+	if len(commit) > 12 {
+		return commit[:12]
+	}
+	return commit
+}
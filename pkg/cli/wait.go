@@ -0,0 +1,141 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"teleport-jobworker/pkg/job"
+	"teleport-jobworker/pkg/jobserver"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	waitAny     bool
+	waitTimeout time.Duration
+)
+
+var waitCmd = &cobra.Command{
+	Use:   "wait",
+	Short: "Wait for jobs by ID to finish",
+	Long: `Wait until every given job, or with --any the first of them, is completed, stopped or failed,
+and print its status. jobctl exits with the exit code of the job, or for several jobs the first
+non-zero exit code in the order given. Jobs killed by a signal exit with 128 plus the signal number,
+and jobs which failed to start with 1.`,
+	Example: `jobctl wait j-12345
+jobctl wait --any --timeout 10m j-12345 j-67890`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		code, err := waitJobs(cmd, args)
+		exitCode = code
+		return err
+	},
+}
+
+func init() {
+	waitCmd.Flags().BoolVar(&waitAny, "any", false, "Wait for the first of the jobs to finish, instead of every job")
+	waitCmd.Flags().DurationVar(&waitTimeout, "timeout", 0, "Stop waiting after this duration, eg. 10m (default no timeout)")
+}
+
+// waitOutcome is the final status of a waited job, or the error waiting for it.
+type waitOutcome struct {
+	index  int
+	status *jobserver.StatusResponse
+	err    error
+}
+
+// waitJobs waits for the jobs concurrently, prints their status and returns the exit code of jobctl:
+// the one of the first job which did not succeed, or of the error waiting for it.
+func waitJobs(cmd *cobra.Command, jobIDs []string) (int, error) {
+	client, err := newClient()
+	if err != nil {
+		return 0, err
+	}
+	defer client.Close()
+
+	var deadline time.Time
+	if waitTimeout > 0 {
+		deadline = time.Now().Add(waitTimeout)
+	}
+
+	outcomes := make(chan waitOutcome, len(jobIDs))
+	for i, jobID := range jobIDs {
+		go func() {
+			status, err := waitFinished(client, jobID, deadline)
+			outcomes <- waitOutcome{index: i, status: status, err: err}
+		}()
+	}
+
+	var waited []waitOutcome
+	if waitAny {
+		waited = []waitOutcome{<-outcomes}
+	} else {
+		waited = make([]waitOutcome, len(jobIDs))
+		for range jobIDs {
+			outcome := <-outcomes
+			waited[outcome.index] = outcome
+		}
+	}
+
+	result := waitResult{Jobs: []jobserver.StatusResponse{}}
+	code := 0
+	for _, outcome := range waited {
+		var jobCode int
+		if outcome.err != nil {
+			printError(cmd, outcome.err)
+			jobCode = errorExitCode(outcome.err)
+		} else {
+			result.Jobs = append(result.Jobs, *outcome.status)
+			jobCode = jobExitCode(outcome.status)
+		}
+		if code == 0 {
+			code = jobCode
+		}
+	}
+	return code, printResult(cmd, result)
+}
+
+// waitFinished long-polls the job until it reached a final state, or the deadline passed if set.
+func waitFinished(client jobClient, jobID string, deadline time.Time) (*jobserver.StatusResponse, error) {
+	for {
+		var timeout time.Duration
+		if !deadline.IsZero() {
+			timeout = time.Until(deadline)
+			if timeout <= 0 {
+				return nil, fmt.Errorf("timed out waiting for job %s", jobID)
+			}
+		}
+
+		status, err := client.WaitJob(jobID, timeout)
+		if err != nil {
+			return nil, err
+		}
+		if (job.JobStatus{State: status.Status}).Finished() {
+			return status, nil
+		}
+	}
+}
+
+// waitResult is the result of jobctl wait, with the final status of the jobs waited for.
+type waitResult struct {
+	Jobs []jobserver.StatusResponse `json:"jobs"`
+}
+
+func (r waitResult) text(w io.Writer) {
+	for _, status := range r.Jobs {
+		statusResult(status).text(w)
+	}
+}
+
+// jobExitCode returns the exit code of a finished job for jobctl to exit with, like shells:
+// 128 plus the signal number if the job was killed by a signal, or 1 if it failed to start.
+func jobExitCode(status *jobserver.StatusResponse) int {
+	if status.Signal > 0 {
+		return 128 + status.Signal
+	}
+	if status.ExitCode == nil || *status.ExitCode < 0 {
+		return 1
+	}
+	return *status.ExitCode
+}
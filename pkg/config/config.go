@@ -0,0 +1,246 @@
+// Package config defines the configuration file of jobserver, in YAML or JSON.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"teleport-jobworker/pkg/job"
+	"teleport-jobworker/pkg/jobserver"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Default file names, relative to the data directory
+const (
+	DefaultAuditLog         = "jobserver-audit.log"
+	DefaultTLSCert          = "jobserver-server.pem"
+	DefaultTLSKey           = "jobserver-server-key.pem"
+	DefaultCACert           = "jobserver-ca.pem"
+	DefaultCAKey            = "jobserver-ca-key.pem"
+	DefaultTokenKeys        = "jobserver-keys.json"
+	DefaultTokenRevocations = "jobserver-revoked.json"
+	DefaultUsers            = "jobserver-users.json"
+)
+
+// Config is the configuration of jobserver. Relative file paths are relative to DataDir.
+type Config struct {
+	// Listen is the address of the HTTPS API.
+	Listen string `yaml:"listen"`
+	// GRPCListen is the address of the gRPC API.
+	GRPCListen string `yaml:"grpcListen"`
+	// MetricsListen serves /metrics on a separate plain HTTP listener if set, instead of the HTTPS API.
+	MetricsListen string `yaml:"metricsListen"`
+	// DataDir holds the audit log, token keys, users and other files with relative paths.
+	DataDir string `yaml:"dataDir"`
+
+	TLS      TLS      `yaml:"tls"`
+	Auth     Auth     `yaml:"auth"`
+	AuditLog string   `yaml:"auditLog"`
+	Roles    string   `yaml:"roles"`
+	Limits   Limits   `yaml:"limits"`
+	Shutdown Shutdown `yaml:"shutdown"`
+}
+
+// TLS configures the server certificate, and client certificates in mutual TLS mode.
+type TLS struct {
+	// Cert and Key are the PEM server certificate and private key.
+	Cert string `yaml:"cert"`
+	Key  string `yaml:"key"`
+	// CACert and CAKey are the local CA issuing server and client certificates, with jobserver certs.
+	CACert string `yaml:"caCert"`
+	CAKey  string `yaml:"caKey"`
+	// ClientCA requires client certificates signed by the user CA instead of Bearer tokens if set.
+	ClientCA string `yaml:"clientCA"`
+	// ClientCRL rejects the client certificates it revokes.
+	ClientCRL string `yaml:"clientCRL"`
+}
+
+// Auth configures the access tokens and the users allowed to log in, unless in mutual TLS mode.
+type Auth struct {
+	TokenKeys        string   `yaml:"tokenKeys"`
+	TokenRevocations string   `yaml:"tokenRevocations"`
+	TokenAudience    string   `yaml:"tokenAudience"`
+	Users            string   `yaml:"users"`
+	AccessTokenTTL   Duration `yaml:"accessTokenTTL"`
+	RefreshTokenTTL  Duration `yaml:"refreshTokenTTL"`
+}
+
+// Limits bounds the resources used by jobs and requests. Zero job limits mean no limit.
+type Limits struct {
+	MaxJobs           int      `yaml:"maxJobs"`
+	MaxJobsPerUser    int      `yaml:"maxJobsPerUser"`
+	MaxOutputBytes    int      `yaml:"maxOutputBytes"`
+	IdempotencyWindow Duration `yaml:"idempotencyWindow"`
+}
+
+// Shutdown configures how running jobs and in-flight requests are drained on SIGINT/SIGTERM.
+// Timeout bounds draining the jobs, and then draining the requests.
+type Shutdown struct {
+	Policy  string   `yaml:"policy"`
+	Timeout Duration `yaml:"timeout"`
+}
+
+// Duration is a time.Duration written as a string, eg. 15m or 1h30m.
+type Duration time.Duration
+
+func (d Duration) MarshalYAML() (any, error) {
+	return time.Duration(d).String(), nil
+}
+
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	var value string
+	if err := node.Decode(&value); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("line %d: invalid duration %q, expected eg. 30s, 15m or 24h", node.Line, value)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// Default returns the configuration used without a config file.
+func Default() Config {
+	return Config{
+		Listen:     jobserver.DefaultHost,
+		GRPCListen: jobserver.DefaultGRPCHost,
+		DataDir:    ".",
+		TLS: TLS{
+			Cert:   DefaultTLSCert,
+			Key:    DefaultTLSKey,
+			CACert: DefaultCACert,
+			CAKey:  DefaultCAKey,
+		},
+		Auth: Auth{
+			TokenKeys:        DefaultTokenKeys,
+			TokenRevocations: DefaultTokenRevocations,
+			TokenAudience:    jobserver.DefaultAudience,
+			Users:            DefaultUsers,
+			AccessTokenTTL:   Duration(jobserver.DefaultAccessTokenTTL),
+			RefreshTokenTTL:  Duration(jobserver.DefaultRefreshTokenTTL),
+		},
+		AuditLog: DefaultAuditLog,
+		Limits: Limits{
+			MaxOutputBytes:    job.DefaultOutputLimit,
+			IdempotencyWindow: Duration(jobserver.DefaultIdempotencyWindow),
+		},
+		Shutdown: Shutdown{
+			Policy:  string(job.ShutdownStop),
+			Timeout: Duration(30 * time.Second),
+		},
+	}
+}
+
+// Load reads a YAML or JSON config file over c. Unknown settings are rejected.
+func (c *Config) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// Validate checks every setting, and reports every invalid one.
+func (c *Config) Validate() error {
+	var errs []error
+	invalid := func(setting, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", setting, fmt.Sprintf(format, args...)))
+	}
+
+	for _, listen := range []struct {
+		setting, addr string
+		required      bool
+	}{
+		{"listen", c.Listen, true},
+		{"grpcListen", c.GRPCListen, true},
+		{"metricsListen", c.MetricsListen, false},
+	} {
+		if listen.addr == "" {
+			if listen.required {
+				invalid(listen.setting, "address is required")
+			}
+		} else if _, _, err := net.SplitHostPort(listen.addr); err != nil {
+			invalid(listen.setting, "invalid address %q, expected host:port", listen.addr)
+		}
+	}
+	if c.DataDir == "" {
+		invalid("dataDir", "directory is required")
+	}
+
+	if c.TLS.Cert == "" {
+		invalid("tls.cert", "path is required")
+	}
+	if c.TLS.Key == "" {
+		invalid("tls.key", "path is required")
+	}
+	if c.TLS.ClientCRL != "" && c.TLS.ClientCA == "" {
+		invalid("tls.clientCRL", "requires tls.clientCA")
+	}
+
+	if c.TLS.ClientCA == "" {
+		if c.Auth.TokenKeys == "" {
+			invalid("auth.tokenKeys", "path is required")
+		}
+		if c.Auth.TokenAudience == "" {
+			invalid("auth.tokenAudience", "audience is required")
+		}
+	}
+	if c.Auth.AccessTokenTTL <= 0 {
+		invalid("auth.accessTokenTTL", "must be positive")
+	}
+	if c.Auth.RefreshTokenTTL <= 0 {
+		invalid("auth.refreshTokenTTL", "must be positive")
+	}
+	if c.AuditLog == "" {
+		invalid("auditLog", "path is required")
+	}
+
+	if c.Limits.MaxJobs < 0 {
+		invalid("limits.maxJobs", "must not be negative")
+	}
+	if c.Limits.MaxJobsPerUser < 0 {
+		invalid("limits.maxJobsPerUser", "must not be negative")
+	}
+	if c.Limits.MaxOutputBytes <= 0 {
+		invalid("limits.maxOutputBytes", "must be positive")
+	}
+	if c.Limits.IdempotencyWindow <= 0 {
+		invalid("limits.idempotencyWindow", "must be positive")
+	}
+
+	if _, err := job.ParseShutdownPolicy(c.Shutdown.Policy); err != nil {
+		invalid("shutdown.policy", "%s", err)
+	}
+	if c.Shutdown.Timeout <= 0 {
+		invalid("shutdown.timeout", "must be positive")
+	}
+
+	return errors.Join(errs...)
+}
+
+// ResolvePaths makes the relative file paths of c relative to DataDir.
+func (c *Config) ResolvePaths() {
+	for _, path := range []*string{
+		&c.TLS.Cert, &c.TLS.Key, &c.TLS.CACert, &c.TLS.CAKey, &c.TLS.ClientCA, &c.TLS.ClientCRL,
+		&c.Auth.TokenKeys, &c.Auth.TokenRevocations, &c.Auth.Users,
+		&c.AuditLog, &c.Roles,
+	} {
+		if *path != "" && !filepath.IsAbs(*path) {
+			*path = filepath.Join(c.DataDir, *path)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeConfig writes a config file in a temporary directory.
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("WriteFile() error: %s", err.Error())
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		err     string
+	}{
+		{"config.yaml", "listen: 0.0.0.0:9443\nauth:\n  accessTokenTTL: 5m\nlimits:\n  maxJobs: 10\n", ""},
+		{"config.json", `{"listen": "0.0.0.0:9443", "auth": {"accessTokenTTL": "5m"}, "limits": {"maxJobs": 10}}`, ""},
+		{"empty.yaml", "", ""},
+		{"unknown.yaml", "auth:\n  tokenAudiance: jobs\n", "line 2: field tokenAudiance not found"},
+		{"duration.yaml", "shutdown:\n  timeout: 30\n", `line 2: invalid duration "30"`},
+	}
+
+	for _, test := range tests {
+		config := Default()
+		err := config.Load(writeConfig(t, test.name, test.content))
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("Load() %s expected error containing %q, got: %v", test.name, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Load() %s error: %s", test.name, err.Error())
+			continue
+		}
+
+		// settings missing from the file keep their defaults
+		if test.content != "" && (config.Listen != "0.0.0.0:9443" || config.Auth.AccessTokenTTL != Duration(5*time.Minute) ||
+			config.Limits.MaxJobs != 10) {
+			t.Errorf("Load() %s expected the settings of the file, got %+v", test.name, config)
+		}
+		if config.GRPCListen != Default().GRPCListen || config.Shutdown != Default().Shutdown {
+			t.Errorf("Load() %s expected default settings, got %+v", test.name, config)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	config := Default()
+	if err := config.Validate(); err != nil {
+		t.Errorf("Validate() error for the default config: %s", err.Error())
+	}
+
+	config.Listen = "localhost"
+	config.TLS.Key = ""
+	config.TLS.ClientCRL = "users.crl"
+	config.Limits.MaxJobsPerUser = -1
+	config.Shutdown.Policy = "kill"
+	err := config.Validate()
+	if err == nil {
+		t.Fatalf("Validate() expected errors")
+	}
+	for _, want := range []string{
+		`listen: invalid address "localhost"`,
+		"tls.key: path is required",
+		"tls.clientCRL: requires tls.clientCA",
+		"limits.maxJobsPerUser: must not be negative",
+		`shutdown.policy: unknown shutdown policy "kill"`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Validate() expected error %q, got: %s", want, err.Error())
+		}
+	}
+}
+
+func TestResolvePaths(t *testing.T) {
+	config := Default()
+	config.DataDir = "/var/lib/jobserver"
+	config.Roles = "/etc/jobserver/roles.json"
+	config.ResolvePaths()
+
+	if config.Auth.TokenKeys != "/var/lib/jobserver/"+DefaultTokenKeys || config.AuditLog != "/var/lib/jobserver/"+DefaultAuditLog ||
+		config.TLS.Cert != "/var/lib/jobserver/"+DefaultTLSCert {
+		t.Errorf("ResolvePaths() expected paths in the data directory, got %+v", config)
+	}
+	if config.Roles != "/etc/jobserver/roles.json" || config.TLS.ClientCA != "" {
+		t.Errorf("ResolvePaths() expected absolute and empty paths unchanged, got %+v", config)
+	}
+}
@@ -0,0 +1,79 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var ErrForbidden = errors.New("permission denied")
+
+// Permission verbs
+const (
+	VerbStart  = "start"
+	VerbStop   = "stop"
+	VerbStatus = "status"
+	VerbOutput = "output"
+	VerbSignal = "signal"
+	VerbList   = "list"
+	// VerbAttach covers writing the stdin of jobs and attaching to their terminals.
+	VerbAttach = "attach"
+	// VerbShare covers granting other users access to jobs.
+	VerbShare = "share"
+	// VerbAdmin covers server-wide actions, eg. querying the audit log.
+	VerbAdmin = "admin"
+)
+
+// Permission scopes
+const (
+	ScopeOwn = "own"
+	ScopeAll = "all"
+)
+
+// Resource describes the job an action applies to, or a job about to be started.
+// The zero Resource stands for no job in particular, eg. to list jobs or for VerbAdmin.
+type Resource struct {
+	Owner    string
+	Programs []string
+	Labels   map[string]string
+}
+
+// Authorizer decides whether the user of a context, set with WithUserInfo, may perform verb on resource.
+type Authorizer interface {
+	// Authorize returns nil if the action is allowed, or a *PermissionError otherwise.
+	Authorize(ctx context.Context, verb string, resource Resource) error
+}
+
+// PermissionError reports the permission missing for a denied action. It matches ErrForbidden.
+type PermissionError struct {
+	Verb string
+	// Scope is ScopeOwn or ScopeAll for actions on jobs, empty otherwise.
+	Scope string
+}
+
+func (e *PermissionError) Error() string {
+	if e.Scope == "" {
+		return fmt.Sprintf("%s: missing %s permission", ErrForbidden, e.Verb)
+	}
+	return fmt.Sprintf("%s: missing %s permission on %s jobs", ErrForbidden, e.Verb, e.Scope)
+}
+
+func (e *PermissionError) Is(target error) bool {
+	return target == ErrForbidden
+}
+
+// WithAuthorizer checks every action against a, instead of the DefaultPolicy.
+func WithAuthorizer(a Authorizer) ManagerOption {
+	return func(m *Manager) {
+		m.authorizer = a
+	}
+}
+
+// Authorize checks an action against the Authorizer of the Manager,
+// eg. for server-wide actions with VerbAdmin.
+func (m *Manager) Authorize(ctx context.Context, verb string, resource Resource) error {
+	if _, _, ok := UserInfo(ctx); !ok {
+		return ErrUnauthorized
+	}
+	return m.authorizer.Authorize(ctx, verb, resource)
+}
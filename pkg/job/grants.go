@@ -0,0 +1,132 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+var ErrInvalidGrant = errors.New("invalid grant")
+
+// MaxGrants bounds the number of unexpired grants of a job.
+const MaxGrants = 32
+
+// Access levels of grants
+const (
+	// AccessRead allows viewing the status and output of a job.
+	AccessRead = "read"
+	// AccessControl allows stopping and signalling a job, on top of AccessRead.
+	AccessControl = "control"
+)
+
+// accessVerbs are the verbs allowed by each access level.
+var accessVerbs = map[string][]string{
+	AccessRead:    {VerbStatus, VerbOutput, VerbList},
+	AccessControl: {VerbStatus, VerbOutput, VerbList, VerbStop, VerbSignal},
+}
+
+// Grant shares a job with users and with every user of groups.
+type Grant struct {
+	Users  []string
+	Groups []string
+	// Access is AccessRead or AccessControl.
+	Access string
+	// ExpiresAt is when the grant stops applying, or zero for the lifetime of the job.
+	ExpiresAt time.Time
+	// GrantedBy is the user who shared the job, set by Manager.Grant.
+	GrantedBy string
+}
+
+// Validate checks that the grant has an access level and grantees, and has not expired.
+func (g Grant) Validate() error {
+	if _, ok := accessVerbs[g.Access]; !ok {
+		return fmt.Errorf("%w: unknown access %q, expected %s or %s", ErrInvalidGrant, g.Access, AccessRead, AccessControl)
+	}
+	if len(g.Users) == 0 && len(g.Groups) == 0 {
+		return fmt.Errorf("%w: no user or group provided", ErrInvalidGrant)
+	}
+	if slices.Contains(g.Users, "") || slices.Contains(g.Groups, "") {
+		return fmt.Errorf("%w: empty user or group", ErrInvalidGrant)
+	}
+	if !g.ExpiresAt.IsZero() && !g.ExpiresAt.After(time.Now()) {
+		return fmt.Errorf("%w: expiry %s is in the past", ErrInvalidGrant, g.ExpiresAt.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// allows reports whether the grant allows the user of group to perform verb at now.
+func (g Grant) allows(userID, group, verb string, now time.Time) bool {
+	if g.expired(now) {
+		return false
+	}
+	if !slices.Contains(g.Users, userID) && !slices.Contains(g.Groups, group) {
+		return false
+	}
+	return slices.Contains(accessVerbs[g.Access], verb)
+}
+
+// Grant shares a job with other users, once the user is allowed VerbShare on it, eg. as its owner.
+// The grant replaces a grant of the same access to the same users and groups, and expired grants
+// are removed. Returns ErrInvalidGrant if the job would have more than MaxGrants grants.
+// Returns the grants of the job.
+func (m *Manager) Grant(ctx context.Context, jobID string, grant Grant) ([]Grant, error) {
+	if err := grant.Validate(); err != nil {
+		return nil, err
+	}
+	if _, err := m.readJob(ctx, VerbShare, jobID); err != nil {
+		return nil, err
+	}
+
+	userID, _, _ := UserInfo(ctx)
+	grant.GrantedBy = userID
+	grant.Users = slices.Clone(grant.Users)
+	grant.Groups = slices.Clone(grant.Groups)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	record := m.jobs[jobID]
+	if record == nil {
+		return nil, ErrNotFound
+	}
+	now := time.Now()
+	grants := slices.DeleteFunc(slices.Clone(record.grants), func(g Grant) bool {
+		return g.expired(now) || g.sameAs(grant)
+	})
+	if len(grants) >= MaxGrants {
+		return nil, fmt.Errorf("%w: the job has %d grants, the limit is %d", ErrInvalidGrant, len(grants), MaxGrants)
+	}
+	record.grants = append(grants, grant)
+	return slices.Clone(record.grants), nil
+}
+
+// expired reports whether the grant no longer applies at now.
+func (g Grant) expired(now time.Time) bool {
+	return !g.ExpiresAt.IsZero() && !now.Before(g.ExpiresAt)
+}
+
+// sameAs reports whether g and other grant the same access to the same users and groups.
+func (g Grant) sameAs(other Grant) bool {
+	sameSet := func(a, b []string) bool {
+		a, b = slices.Clone(a), slices.Clone(b)
+		slices.Sort(a)
+		slices.Sort(b)
+		return slices.Equal(slices.Compact(a), slices.Compact(b))
+	}
+	return g.Access == other.Access && sameSet(g.Users, other.Users) && sameSet(g.Groups, other.Groups)
+}
+
+// authorize checks an action on a job against its grants, then against the Authorizer.
+// The caller must hold the mutex.
+func (m *Manager) authorize(ctx context.Context, verb string, record *jobRecord) error {
+	userID, group, _ := UserInfo(ctx)
+	now := time.Now()
+	for _, grant := range record.grants {
+		if grant.allows(userID, group, verb, now) {
+			return nil
+		}
+	}
+	return m.authorizer.Authorize(ctx, verb, record.resource)
+}
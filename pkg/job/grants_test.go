@@ -0,0 +1,125 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestGrant(t *testing.T) {
+	m, ctx := initManagerContext(User)
+	user2 := WithUserInfo(context.Background(), "user2", User)
+	operator := WithUserInfo(context.Background(), "operator1", "ops")
+
+	jobID, err := m.Start(ctx, longCmd[0], longCmd[1:])
+	if err != nil {
+		t.Fatalf("Start() error: %s", err.Error())
+	}
+	defer m.Stop(ctx, jobID)
+
+	// only users allowed to share the job may grant access to it
+	if _, err := m.Grant(user2, jobID, Grant{Users: []string{"user2"}, Access: AccessControl}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Grant() expected error: %s, got: %v", ErrNotFound, err)
+	}
+
+	grants, err := m.Grant(ctx, jobID, Grant{Users: []string{"user2"}, Access: AccessRead, ExpiresAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("Grant() error: %s", err.Error())
+	}
+	if len(grants) != 1 || grants[0].GrantedBy != "testdummy" {
+		t.Errorf("Grant() expected a grant by testdummy, got %+v", grants)
+	}
+
+	if _, err := m.GetStatus(user2, jobID); err != nil {
+		t.Errorf("GetStatus() error with read access: %s", err.Error())
+	}
+	if jobs, _ := m.List(user2); len(jobs) != 1 || jobs[0].ID != jobID {
+		t.Errorf("List() expected shared job %s, got %+v", jobID, jobs)
+	}
+	if err := m.Stop(user2, jobID); !errors.Is(err, ErrForbidden) {
+		t.Errorf("Stop() expected error with read access: %s, got: %v", ErrForbidden, err)
+	}
+	if _, err := m.GetStatus(operator, jobID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetStatus() expected error without grant: %s, got: %v", ErrNotFound, err)
+	}
+
+	if _, err := m.Grant(ctx, jobID, Grant{Groups: []string{"ops"}, Access: AccessControl}); err != nil {
+		t.Fatalf("Grant() error: %s", err.Error())
+	}
+	if err := m.Authorize(operator, VerbStop, Resource{}); !errors.Is(err, ErrForbidden) {
+		t.Errorf("Authorize() expected grants to only apply to their job, got: %v", err)
+	}
+	if _, err := m.Grant(operator, jobID, Grant{Users: []string{"operator2"}, Access: AccessControl}); !errors.Is(err, ErrForbidden) {
+		t.Errorf("Grant() expected error without share permission: %s, got: %v", ErrForbidden, err)
+	}
+	for status, _ := m.GetStatus(ctx, jobID); status.State == Starting; status, _ = m.GetStatus(ctx, jobID) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := m.Stop(operator, jobID); err != nil {
+		t.Errorf("Stop() error with control access: %s", err.Error())
+	}
+
+	// expired grants no longer apply
+	m.mutex.Lock()
+	m.jobs[jobID].grants[0].ExpiresAt = time.Now().Add(-time.Second)
+	m.mutex.Unlock()
+	if _, err := m.GetStatus(user2, jobID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetStatus() expected error with expired grant: %s, got: %v", ErrNotFound, err)
+	}
+}
+
+func TestGrantLimit(t *testing.T) {
+	m, ctx := initManagerContext(User)
+	jobID, _ := m.Start(ctx, shortCmd[0], shortCmd[1:])
+
+	for i := range MaxGrants {
+		if _, err := m.Grant(ctx, jobID, Grant{Users: []string{fmt.Sprintf("user%d", i)}, Access: AccessRead}); err != nil {
+			t.Fatalf("Grant() error: %s", err.Error())
+		}
+	}
+	if _, err := m.Grant(ctx, jobID, Grant{Groups: []string{"ops"}, Access: AccessRead}); !errors.Is(err, ErrInvalidGrant) {
+		t.Errorf("Grant() expected error past %d grants: %s, got: %v", MaxGrants, ErrInvalidGrant, err)
+	}
+
+	// granting the same access to the same users replaces the grant
+	expiresAt := time.Now().Add(time.Hour)
+	grants, err := m.Grant(ctx, jobID, Grant{Users: []string{"user0", "user0"}, Access: AccessRead, ExpiresAt: expiresAt})
+	if err != nil {
+		t.Fatalf("Grant() error: %s", err.Error())
+	}
+	if len(grants) != MaxGrants || !grants[len(grants)-1].ExpiresAt.Equal(expiresAt) {
+		t.Errorf("Grant() expected %d grants, the last expiring at %s, got %+v", MaxGrants, expiresAt, grants)
+	}
+
+	// expired grants are removed
+	m.mutex.Lock()
+	m.jobs[jobID].grants[0].ExpiresAt = time.Now().Add(-time.Second)
+	m.mutex.Unlock()
+	grants, err = m.Grant(ctx, jobID, Grant{Groups: []string{"ops"}, Access: AccessRead})
+	if err != nil {
+		t.Fatalf("Grant() error: %s", err.Error())
+	}
+	if len(grants) != MaxGrants || slices.ContainsFunc(grants, func(g Grant) bool { return slices.Contains(g.Users, "user1") }) {
+		t.Errorf("Grant() expected the expired grant of user1 removed, got %+v", grants)
+	}
+}
+
+func TestGrantInvalid(t *testing.T) {
+	m, ctx := initManagerContext(User)
+	jobID, _ := m.Start(ctx, shortCmd[0], shortCmd[1:])
+
+	invalid := []Grant{
+		{Users: []string{"user2"}, Access: "write"},
+		{Access: AccessRead},
+		{Users: []string{""}, Access: AccessRead},
+		{Users: []string{"user2"}, Access: AccessRead, ExpiresAt: time.Now().Add(-time.Minute)},
+	}
+	for _, grant := range invalid {
+		if _, err := m.Grant(ctx, jobID, grant); !errors.Is(err, ErrInvalidGrant) {
+			t.Errorf("Grant() expected error for %+v: %s, got: %v", grant, ErrInvalidGrant, err)
+		}
+	}
+}
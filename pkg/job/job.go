@@ -3,11 +3,14 @@
 package job
 
 import (
-	"bytes"
+	"context"
 	"errors"
+	"io"
 	"os"
 	"os/exec"
 	"sync"
+	"syscall"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -21,95 +24,295 @@ const (
 	Stopped   = "stopped"
 )
 
-// Job is a Linux process started by the service.
+// Job is a Linux process started by the service, or a pipeline of processes
+// whose stdout/stdin are connected and managed as one unit.
 type Job struct {
 	ID     string
-	cmd    *exec.Cmd
-	outBuf safeBuffer
-	errBuf safeBuffer
+	stages []*exec.Cmd
+	pipes  []*os.File
+	// output is the only store of the job's stdout and stderr
+	output outputLog
+
+	options startOptions
+
+	stdin      io.WriteCloser
+	stdinMutex sync.Mutex
+	// stdinWriteMutex serializes the chunks written to stdin
+	stdinWriteMutex sync.Mutex
+
+	// pseudo-terminal master and slave sides, for jobs started WithTTY
+	ptmx *os.File
+	tty  *os.File
+
+	// outputs are the read ends of the job's stdout and stderr, or its terminal master
+	outputs []outputPipe
+	// outputDone is closed once the outputs are no longer copied into the output log
+	outputDone chan struct{}
+	// outputDrainTimeout bounds how long the outputs are read after the job exited
+	outputDrainTimeout time.Duration
 
 	status      JobStatus
 	statusMutex sync.RWMutex
+
+	// done is closed once the job reached a final state
+	done chan struct{}
 }
 
 // JobStatus holds job status information.
+// For pipelines, ExitCode is the last stage's exit code, or with pipefail,
+// the exit code of the last stage that did not succeed.
 type JobStatus struct {
-	State    string
-	ExitCode *int
+	State          string
+	ExitCode       *int
+	StageExitCodes []int
+	// Signal is the signal which terminated the process of the exit code, if any, eg. SIGKILL for stopped jobs.
+	Signal syscall.Signal
 }
 
-// safeBuffer provides concurrent r/w access to buffer content.
-// This allows safe access to process's stdout/stderr while job is running.
-type safeBuffer struct {
-	buf      bytes.Buffer
-	bufMutex sync.RWMutex
+// Finished reports whether the job reached a final state: completed, stopped or failed.
+func (s JobStatus) Finished() bool {
+	return s.State == Completed || s.State == Stopped || s.State == Failed
 }
 
-func (s *safeBuffer) Write(p []byte) (int, error) {
-	s.bufMutex.Lock()
-	defer s.bufMutex.Unlock()
-	return s.buf.Write(p)
+// Command is a program with its arguments, run as one stage of a job.
+type Command struct {
+	Program string
+	Args    []string
 }
 
-func (s *safeBuffer) String() string {
-	s.bufMutex.RLock()
-	defer s.bufMutex.RUnlock()
-	return s.buf.String()
+// newJob creates a new Job struct with state "Starting".
+func newJob(program string, args []string, opts ...StartOption) *Job {
+	return newPipelineJob([]Command{{program, args}}, opts...)
 }
 
-// newJob creates a new Job struct with state "Starting".
-func newJob(program string, args []string) *Job {
+// newPipelineJob creates a new Job struct with state "Starting", running each command
+// as a stage whose stdout is connected to the next stage's stdin.
+// Every stage writes to the job's stderr, and the last stage writes to the job's stdout.
+func newPipelineJob(commands []Command, opts ...StartOption) *Job {
 	ID := uuid.NewString()
 
 	job := Job{
-		ID:     ID,
-		cmd:    exec.Command(program, args...),
-		status: JobStatus{State: Starting},
+		ID:      ID,
+		options: applyStartOptions(opts),
+		status:  JobStatus{State: Starting},
+		output:  outputLog{limit: DefaultOutputLimit},
+		done:    make(chan struct{}),
+
+		outputDone:         make(chan struct{}),
+		outputDrainTimeout: outputDrainTimeout,
 	}
 
-	job.cmd.Stdout = &job.outBuf
-	job.cmd.Stderr = &job.errBuf
+	for _, command := range commands {
+		stage := exec.Command(command.Program, command.Args...)
+		// own process group, so signals sent to the server's group (eg. Ctrl-C) don't reach jobs
+		stage.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+		job.stages = append(job.stages, stage)
+	}
+
+	// connect terminal, stdin and stages up front, so they can be used as soon as the job ID is returned
+	if err := job.openTerminal(); err != nil {
+		job.status = JobStatus{State: Failed}
+	} else if err := job.openStdin(); err != nil {
+		job.status = JobStatus{State: Failed}
+	} else if err := job.openPipes(); err != nil {
+		job.status = JobStatus{State: Failed}
+	} else if err := job.openOutput(); err != nil {
+		job.status = JobStatus{State: Failed}
+	}
 
 	return &job
 }
 
+// openPipes connects the stdout of each stage to the stdin of the next stage.
+func (j *Job) openPipes() error {
+	for i := 0; i < len(j.stages)-1; i++ {
+		r, w, err := os.Pipe()
+		if err != nil {
+			j.closePipes()
+			return err
+		}
+		j.pipes = append(j.pipes, r, w)
+
+		j.stages[i].Stdout = w
+		j.stages[i+1].Stdin = r
+	}
+	return nil
+}
+
+// openOutput connects every stage's stderr and the last stage's stdout to pipes read into the job's
+// output, unless the job has a terminal. The job owns the read ends, so they can outlive the service
+// once the job is detached.
+func (j *Job) openOutput() error {
+	if j.tty != nil {
+		return nil
+	}
+
+	for _, stream := range []string{Stdout, Stderr} {
+		r, w, err := os.Pipe()
+		if err != nil {
+			j.closePipes()
+			for _, output := range j.outputs {
+				output.file.Close()
+			}
+			j.outputs = nil
+			return err
+		}
+		// the write end is released by closePipes once the stages started
+		j.pipes = append(j.pipes, w)
+		j.outputs = append(j.outputs, outputPipe{stream: stream, file: r})
+
+		if stream == Stdout {
+			j.stages[len(j.stages)-1].Stdout = w
+			continue
+		}
+		for _, stage := range j.stages {
+			stage.Stderr = w
+		}
+	}
+	return nil
+}
+
+// startOutput copies the outputs into the job's output log, once the processes started,
+// until every process closed them or they are closed by closeOutput.
+func (j *Job) startOutput() {
+	if j.tty != nil {
+		j.tty.Close()
+	}
+
+	var wg sync.WaitGroup
+	for _, output := range j.outputs {
+		wg.Go(func() {
+			// reading fails with EOF once every process closed a pipe, or EIO once they closed the terminal
+			io.Copy(streamWriter{stream: output.stream, log: &j.output}, output.file)
+		})
+	}
+	go func() {
+		wg.Wait()
+		close(j.outputDone)
+	}()
+}
+
+// closeOutput releases the outputs, after the job exited or failed to start.
+// The output of a started job is read until every process closed the outputs, or until
+// its drain timeout passed, since background processes of the job may keep them open.
+// Closing them then leaves these processes writing to a closed pipe or a hung up terminal.
+func (j *Job) closeOutput(started bool) {
+	if !started && j.tty != nil {
+		j.tty.Close()
+	}
+
+	if started {
+		select {
+		case <-j.outputDone:
+		case <-time.After(j.outputDrainTimeout):
+			// expiring the read deadline interrupts the copies
+			for _, output := range j.outputs {
+				output.file.SetReadDeadline(time.Now())
+			}
+			<-j.outputDone
+		}
+	}
+
+	for _, output := range j.outputs {
+		output.file.Close()
+	}
+}
+
+// closePipes releases the parent's copies of the pipes between stages,
+// so each stage sees EOF once the previous stage exits.
+func (j *Job) closePipes() {
+	for _, pipe := range j.pipes {
+		pipe.Close()
+	}
+	j.pipes = nil
+}
+
 // run forks a new process and manages job lifecycle.
 func (j *Job) run() {
 	j.statusMutex.Lock()
 	defer j.statusMutex.Unlock()
 
-	err := j.cmd.Start()
-	// unsuccessful starting the process
-	if err != nil {
+	// unsuccessful connecting terminal, stdin or stages in newJob
+	if j.status.State == Failed {
+		j.closeStdin()
+		j.closePipes()
+		j.closeOutput(false)
+		j.output.close()
+		close(j.done)
+		return
+	}
+
+	started := 0
+	for _, stage := range j.stages {
+		if err := stage.Start(); err != nil {
+			break
+		}
+		started++
+	}
+	j.closePipes()
+
+	// unsuccessful starting every process, stop the stages already started
+	if started < len(j.stages) {
+		for _, stage := range j.stages[:started] {
+			stage.Process.Kill()
+			stage.Wait()
+		}
+		j.closeStdin()
+		j.closeOutput(false)
+		j.output.close()
 		j.status = JobStatus{State: Failed}
+		close(j.done)
 		return
 	}
 
 	// successful starting the process
 	j.status = JobStatus{State: Running}
+	j.startOutput()
 
 	// wait for process completion to update job state
 	go j.wait()
 }
 
-// wait sits on the process until completion, then updates state.
+// wait sits on the processes until completion, then updates state.
 func (j *Job) wait() {
-	j.cmd.Wait()
+	stageExitCodes := make([]int, len(j.stages))
+	stageSignals := make([]syscall.Signal, len(j.stages))
+	for i, stage := range j.stages {
+		stage.Wait()
+		stageExitCodes[i] = stage.ProcessState.ExitCode()
+		if status, ok := stage.ProcessState.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			stageSignals[i] = status.Signal()
+		}
+	}
+	j.closeOutput(true)
 
 	j.statusMutex.Lock()
 	defer j.statusMutex.Unlock()
+	defer close(j.done)
+	defer j.output.close()
+
+	// the job's exit code is the last stage's, or with pipefail the last stage's that did not succeed
+	last := len(stageExitCodes) - 1
+	if j.options.pipefail {
+		for i := len(stageExitCodes) - 1; i >= 0; i-- {
+			if stageExitCodes[i] != 0 {
+				last = i
+				break
+			}
+		}
+	}
+	exitCode := stageExitCodes[last]
 
 	// update job state according to exit code
-	exitCode := j.cmd.ProcessState.ExitCode()
 	if exitCode == -1 {
-		j.status = JobStatus{State: Stopped, ExitCode: &exitCode}
+		j.status = JobStatus{State: Stopped, ExitCode: &exitCode, StageExitCodes: stageExitCodes, Signal: stageSignals[last]}
 		return
 	}
 
-	j.status = JobStatus{State: Completed, ExitCode: &exitCode}
+	j.status = JobStatus{State: Completed, ExitCode: &exitCode, StageExitCodes: stageExitCodes}
 }
 
-// stop kills the job process with signal SIGKILL.
+// stop kills every job process with signal SIGKILL.
 func (j *Job) stop() error {
 	j.statusMutex.Lock()
 	defer j.statusMutex.Unlock()
@@ -120,14 +323,35 @@ func (j *Job) stop() error {
 	}
 
 	// job process still starting, coalesce into ErrNotFound
-	if j.cmd.Process == nil {
+	if j.stages[0].Process == nil {
 		return ErrNotFound
 	}
 
-	// send SIGKILL signal
-	err := j.cmd.Process.Kill()
-	if err != nil && !errors.Is(err, os.ErrProcessDone) {
-		return err
+	// send SIGKILL signal to every stage
+	for _, stage := range j.stages {
+		err := stage.Process.Kill()
+		if err != nil && !errors.Is(err, os.ErrProcessDone) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// signal sends sig to every process of a running job.
+func (j *Job) signal(sig os.Signal) error {
+	j.statusMutex.RLock()
+	defer j.statusMutex.RUnlock()
+
+	if j.status.State != Running {
+		return nil
+	}
+
+	for _, stage := range j.stages {
+		err := stage.Process.Signal(sig)
+		if err != nil && !errors.Is(err, os.ErrProcessDone) {
+			return err
+		}
 	}
 
 	return nil
@@ -141,7 +365,23 @@ func (j *Job) getStatus() JobStatus {
 	return j.status
 }
 
-// getOutput returns the job's stdout/stderr data.
+// waitDone blocks until the job reached a final state, or ctx is done, and returns its status.
+// Returns ctx.Err() with the current status if ctx was done first.
+func (j *Job) waitDone(ctx context.Context) (JobStatus, error) {
+	select {
+	case <-j.done:
+		return j.getStatus(), nil
+	case <-ctx.Done():
+		return j.getStatus(), ctx.Err()
+	}
+}
+
+// getOutput returns the job's stdout/stderr data, the most recent output once it exceeded its limit.
 func (j *Job) getOutput() (stdout, stderr string) {
-	return j.outBuf.String(), j.errBuf.String()
+	return j.output.streams()
+}
+
+// getOutputRecords returns the job's merged output records written at or after since.
+func (j *Job) getOutputRecords(since time.Time) []OutputRecord {
+	return j.output.since(since)
 }
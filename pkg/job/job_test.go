@@ -1,9 +1,14 @@
 package job
 
 import (
+	"errors"
+	"fmt"
+	"slices"
 	"strings"
+	"syscall"
 	"testing"
 	"testing/synctest"
+	"time"
 )
 
 var shortCmd = []string{"/bin/echo", "hello world"}
@@ -56,9 +61,9 @@ func TestStop(t *testing.T) {
 		synctest.Wait()
 
 		status = job.getStatus()
-		if status.State != Stopped || *status.ExitCode != -1 {
-			t.Errorf("getStatus() expected stopped with exit code -1, got %v, code %v",
-				status.State, *status.ExitCode)
+		if status.State != Stopped || *status.ExitCode != -1 || status.Signal != syscall.SIGKILL {
+			t.Errorf("getStatus() expected stopped with exit code -1 by SIGKILL, got %v, code %v, signal %v",
+				status.State, *status.ExitCode, status.Signal)
 		}
 	})
 }
@@ -102,3 +107,258 @@ func TestStartInvalidCmd(t *testing.T) {
 		}
 	})
 }
+
+func TestOutputRecords(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		job := newJob("/bin/sh", []string{"-c", "echo one; echo two 1>&2; printf three"})
+		job.run()
+
+		synctest.Wait()
+
+		records := job.getOutputRecords(time.Time{})
+		streams := map[string]string{}
+		var lastSeq uint64
+		for _, record := range records {
+			if record.Seq <= lastSeq {
+				t.Errorf("getOutputRecords() expected increasing seq, got %d after %d", record.Seq, lastSeq)
+			}
+			lastSeq = record.Seq
+			streams[record.Stream] += record.Data
+		}
+
+		if streams[Stdout] != "one\nthree" {
+			t.Errorf("getOutputRecords() unexpected stdout: %q", streams[Stdout])
+		}
+		if streams[Stderr] != "two\n" {
+			t.Errorf("getOutputRecords() unexpected stderr: %q", streams[Stderr])
+		}
+
+		if records := job.getOutputRecords(time.Now().Add(time.Hour)); len(records) != 0 {
+			t.Errorf("getOutputRecords() expected no records after since, got %d", len(records))
+		}
+	})
+}
+
+func TestOutputLimit(t *testing.T) {
+	output := outputLog{limit: 3 * (recordOverhead + len("line 1\n"))}
+	for i := 1; i <= 5; i++ {
+		stream := Stdout
+		if i%2 == 0 {
+			stream = Stderr
+		}
+		output.append(stream, []byte(fmt.Sprintf("line %d\n", i)))
+	}
+
+	if size := output.sizeBytes(); size != output.limit {
+		t.Errorf("sizeBytes() expected %d, got %d", output.limit, size)
+	}
+
+	// the first records were dropped, and followers behind them resume after them
+	records, _, _ := output.after(0)
+	if len(records) != 3 || records[0].Seq != 3 || records[2].Seq != 5 {
+		t.Errorf("after(0) expected records 3 to 5, got %v", records)
+	}
+	if records, _, _ := output.after(4); len(records) != 1 || records[0].Seq != 5 {
+		t.Errorf("after(4) expected record 5, got %v", records)
+	}
+
+	stdout, stderr := output.streams()
+	if stdout != "line 3\nline 5\n" || stderr != "line 4\n" {
+		t.Errorf("streams() unexpected output: %q, %q", stdout, stderr)
+	}
+}
+
+func TestBackgroundProcess(t *testing.T) {
+	// the background process keeps stdout open after the job exited
+	job := newJob("/bin/sh", []string{"-c", "/bin/sleep 3 & echo started"})
+	job.outputDrainTimeout = 100 * time.Millisecond
+	job.run()
+
+	select {
+	case <-job.done:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("job not done while a background process keeps its stdout open")
+	}
+
+	status := job.getStatus()
+	if status.State != Completed || *status.ExitCode != 0 {
+		t.Errorf("getStatus() expected completed with exit code 0, got %v", status.State)
+	}
+	if stdout, _ := job.getOutput(); stdout != "started\n" {
+		t.Errorf("Unexpected stdout: %q", stdout)
+	}
+}
+
+func TestStdin(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		job := newJob("/bin/cat", nil, WithStdin())
+		job.run()
+
+		_, err := job.writeStdin(strings.NewReader("hello stdin\n"))
+		if err != nil {
+			t.Errorf("writeStdin() error: %s", err.Error())
+		}
+
+		err = job.closeStdin()
+		if err != nil {
+			t.Errorf("closeStdin() error: %s", err.Error())
+		}
+
+		synctest.Wait()
+
+		status := job.getStatus()
+		if status.State != Completed || *status.ExitCode != 0 {
+			t.Errorf("getStatus() expected completed with exit code 0, got %v", status.State)
+		}
+
+		stdout, _ := job.getOutput()
+		if stdout != "hello stdin\n" {
+			t.Errorf("Unexpected stdout: %q", stdout)
+		}
+
+		// stdin cannot be written after it is closed
+		_, err = job.writeStdin(strings.NewReader("too late"))
+		if !errors.Is(err, ErrStdinClosed) {
+			t.Errorf("writeStdin() expected error: %s, got: %v", ErrStdinClosed, err)
+		}
+	})
+}
+
+// endlessReader reads zeros forever.
+type endlessReader struct{}
+
+func (endlessReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+func TestStdinCloseInterruptsWrite(t *testing.T) {
+	// the job does not read its stdin, so the write blocks once the pipe is full
+	job := newJob(longCmd[0], longCmd[1:], WithStdin())
+	job.run()
+	defer job.stop()
+
+	written := make(chan error, 1)
+	go func() {
+		_, err := job.writeStdin(endlessReader{})
+		written <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	closed := make(chan error, 1)
+	go func() {
+		closed <- job.closeStdin()
+	}()
+
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Errorf("closeStdin() error: %s", err.Error())
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("closeStdin() blocked by the write in progress")
+	}
+
+	select {
+	case err := <-written:
+		if !errors.Is(err, ErrStdinClosed) {
+			t.Errorf("writeStdin() expected error: %s, got: %v", ErrStdinClosed, err)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("writeStdin() not interrupted by closeStdin()")
+	}
+}
+
+func TestStdinNotRequested(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		job := newJob(shortCmd[0], shortCmd[1:])
+		job.run()
+		synctest.Wait()
+
+		_, err := job.writeStdin(strings.NewReader("hello"))
+		if !errors.Is(err, ErrStdinClosed) {
+			t.Errorf("writeStdin() expected error: %s, got: %v", ErrStdinClosed, err)
+		}
+	})
+}
+
+func TestPipeline(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		job := newPipelineJob([]Command{
+			{"/bin/echo", []string{"hello world"}},
+			{"/usr/bin/tr", []string{"a-z", "A-Z"}},
+		})
+		job.run()
+
+		synctest.Wait()
+
+		status := job.getStatus()
+		if status.State != Completed || *status.ExitCode != 0 || !slices.Equal(status.StageExitCodes, []int{0, 0}) {
+			t.Errorf("getStatus() expected completed with exit codes [0 0], got %v, %v",
+				status.State, status.StageExitCodes)
+		}
+
+		stdout, _ := job.getOutput()
+		if stdout != "HELLO WORLD\n" {
+			t.Errorf("Unexpected stdout: %q", stdout)
+		}
+	})
+}
+
+func TestPipelinePipefail(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		commands := []Command{{"/bin/false", nil}, {"/bin/cat", nil}}
+
+		job := newPipelineJob(commands)
+		job.run()
+		pipefailJob := newPipelineJob(commands, WithPipefail())
+		pipefailJob.run()
+
+		synctest.Wait()
+
+		status := job.getStatus()
+		if *status.ExitCode != 0 || !slices.Equal(status.StageExitCodes, []int{1, 0}) {
+			t.Errorf("getStatus() expected exit code 0 with stage codes [1 0], got %v, %v",
+				*status.ExitCode, status.StageExitCodes)
+		}
+
+		status = pipefailJob.getStatus()
+		if *status.ExitCode != 1 {
+			t.Errorf("getStatus() expected pipefail exit code 1, got %v", *status.ExitCode)
+		}
+	})
+}
+
+func TestPipelineStop(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		job := newPipelineJob([]Command{{longCmd[0], longCmd[1:]}, {"/bin/cat", nil}})
+		job.run()
+
+		err := job.stop()
+		if err != nil {
+			t.Errorf("stop() error: %s", err.Error())
+		}
+
+		synctest.Wait()
+
+		status := job.getStatus()
+		if status.State != Stopped || !slices.Equal(status.StageExitCodes, []int{-1, -1}) {
+			t.Errorf("getStatus() expected stopped with exit codes [-1 -1], got %v, %v",
+				status.State, status.StageExitCodes)
+		}
+	})
+}
+
+func TestPipelineInvalidCmd(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		job := newPipelineJob([]Command{{longCmd[0], longCmd[1:]}, {invalidCmd[0], invalidCmd[1:]}})
+		job.run()
+
+		synctest.Wait()
+
+		status := job.getStatus()
+		if status.State != Failed {
+			t.Errorf("getStatus() expected failed, got %v", status.State)
+		}
+	})
+}
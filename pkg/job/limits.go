@@ -0,0 +1,57 @@
+package job
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrTooManyJobs = errors.New("too many running jobs")
+
+// WithJobLimits bounds the number of jobs starting or running at once, in total and per user.
+// Zero means no limit.
+func WithJobLimits(total, perUser int) ManagerOption {
+	return func(m *Manager) {
+		m.maxJobs = total
+		m.maxJobsPerUser = perUser
+	}
+}
+
+// JobLimits returns the limits set with WithJobLimits, in total and per user. Zero means no limit.
+func (m *Manager) JobLimits() (total, perUser int) {
+	return m.maxJobs, m.maxJobsPerUser
+}
+
+// WithOutputLimit bounds the size of the output kept for each job, DefaultOutputLimit by default.
+// Once a job's output exceeds it, its oldest output records are dropped.
+func WithOutputLimit(bytes int) ManagerOption {
+	return func(m *Manager) {
+		m.outputLimit = bytes
+	}
+}
+
+// checkLimits returns ErrTooManyJobs if starting a job for userID would exceed the job limits.
+// The caller must hold the mutex.
+func (m *Manager) checkLimits(userID string) error {
+	if m.maxJobs <= 0 && m.maxJobsPerUser <= 0 {
+		return nil
+	}
+
+	var total, perUser int
+	for _, record := range m.jobs {
+		if state := record.job.getStatus().State; state != Starting && state != Running {
+			continue
+		}
+		total++
+		if record.userID == userID {
+			perUser++
+		}
+	}
+
+	if m.maxJobs > 0 && total >= m.maxJobs {
+		return fmt.Errorf("%w: %d jobs are running, the limit is %d", ErrTooManyJobs, total, m.maxJobs)
+	}
+	if m.maxJobsPerUser > 0 && perUser >= m.maxJobsPerUser {
+		return fmt.Errorf("%w: %d of your jobs are running, the limit is %d", ErrTooManyJobs, perUser, m.maxJobsPerUser)
+	}
+	return nil
+}
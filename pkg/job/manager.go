@@ -3,11 +3,17 @@ package job
 import (
 	"context"
 	"errors"
+	"fmt"
+	"io"
+	"slices"
 	"sync"
+	"syscall"
+	"time"
 )
 
 var ErrNotFound = errors.New("job not found")
 var ErrUnauthorized = errors.New("unauthorized action, no user provided")
+var ErrInvalidCommand = errors.New("invalid command")
 
 // Manager roles
 const (
@@ -17,14 +23,60 @@ const (
 
 // Manager tracks every job created by the service.
 type Manager struct {
-	mutex sync.RWMutex
-	jobs  map[string]*jobRecord // jobID -> (userID, Job)
+	mutex    sync.RWMutex
+	jobs     map[string]*jobRecord // jobID -> (userID, Job)
+	draining bool
+
+	observer   Observer
+	authorizer Authorizer
+
+	maxJobs        int
+	maxJobsPerUser int
+	outputLimit    int
+	detachDir      string
+}
+
+// Observer is notified of job lifecycle events, eg. to collect metrics.
+// Calls are made from the goroutines managing jobs, and must not block.
+type Observer interface {
+	JobStarted(userID string)
+	JobFinished(userID string, status JobStatus, duration time.Duration)
 }
 
-// jobRecord tracks user ID associated to Job.
+// ManagerOption configures optional behaviour of the Manager.
+type ManagerOption func(*Manager)
+
+// WithObserver notifies o of the lifecycle events of every job.
+func WithObserver(o Observer) ManagerOption {
+	return func(m *Manager) {
+		m.observer = o
+	}
+}
+
+// Stats is a snapshot of the jobs tracked by the Manager.
+type Stats struct {
+	// Starting counts jobs created but not yet running, waiting for their processes to start.
+	Starting int
+	Running  int
+	// OutputBytes is the size of the stdout and stderr records stored for every job, including their overhead.
+	OutputBytes int
+}
+
+// jobRecord tracks user ID associated to Job, the job as an authorization resource, and its grants.
 type jobRecord struct {
-	userID string
-	job    *Job
+	userID   string
+	job      *Job
+	created  time.Time
+	resource Resource
+	grants   []Grant
+}
+
+// JobInfo describes a job listed by the Manager.
+type JobInfo struct {
+	ID     string
+	UserID string
+	Status JobStatus
+	Labels map[string]string
 }
 
 // Context includes user ID and role for use with Manager functions.
@@ -35,33 +87,125 @@ type userInfo struct {
 }
 
 // NewManager creates a new Manager with empty job table.
-func NewManager() *Manager {
-	return &Manager{
-		jobs: map[string]*jobRecord{},
+func NewManager(opts ...ManagerOption) *Manager {
+	// the default policy is valid
+	defaultAuthorizer, _ := NewRBAC(DefaultPolicy())
+	manager := &Manager{
+		jobs:       map[string]*jobRecord{},
+		authorizer: defaultAuthorizer,
 	}
+
+	for _, opt := range opts {
+		opt(manager)
+	}
+
+	return manager
 }
 
 // Start creates a job and assigns a unique job ID.
-func (m *Manager) Start(ctx context.Context, program string, args []string) (string, error) {
-	userID, _, ok := getUserInfo(ctx)
+func (m *Manager) Start(ctx context.Context, program string, args []string, opts ...StartOption) (string, error) {
+	return m.StartPipeline(ctx, []Command{{program, args}}, opts...)
+}
+
+// StartPipeline creates a job running the commands as a pipeline, without a shell:
+// the stdout of each command is connected to the stdin of the next.
+// The pipeline has a single lifecycle, and assigns a unique job ID.
+func (m *Manager) StartPipeline(ctx context.Context, commands []Command, opts ...StartOption) (string, error) {
+	userID, _, ok := UserInfo(ctx)
 	if !ok {
 		return "", ErrUnauthorized
 	}
 
-	newJob := newJob(program, args)
+	if len(commands) == 0 {
+		return "", fmt.Errorf("%w: no command provided", ErrInvalidCommand)
+	}
+	options := applyStartOptions(opts)
+	if options.tty && len(commands) > 1 {
+		return "", fmt.Errorf("%w: pipelines cannot run on a terminal", ErrInvalidCommand)
+	}
+
+	resource := startResource(userID, commands, options)
+	if err := m.authorizer.Authorize(ctx, VerbStart, resource); err != nil {
+		return "", err
+	}
 
 	m.mutex.Lock()
-	m.jobs[newJob.ID] = &jobRecord{job: newJob, userID: userID}
+	if m.draining {
+		m.mutex.Unlock()
+		return "", ErrDraining
+	}
+	if err := m.checkLimits(userID); err != nil {
+		m.mutex.Unlock()
+		return "", err
+	}
+	newJob := newPipelineJob(commands, opts...)
+	if m.outputLimit > 0 {
+		newJob.output.limit = m.outputLimit
+	}
+	m.jobs[newJob.ID] = &jobRecord{job: newJob, userID: userID, created: time.Now(), resource: resource}
 	m.mutex.Unlock()
 
 	go newJob.run()
+	if m.observer != nil {
+		m.observer.JobStarted(userID)
+		go m.observe(userID, newJob)
+	}
 
 	return newJob.ID, nil
 }
 
+// AuthorizeStart checks whether the user of ctx may start the commands with opts, as StartPipeline does.
+// Callers inspecting the commands, eg. whether the programs exist, check it first so that users
+// who may not start them learn nothing about them.
+func (m *Manager) AuthorizeStart(ctx context.Context, commands []Command, opts ...StartOption) error {
+	userID, _, ok := UserInfo(ctx)
+	if !ok {
+		return ErrUnauthorized
+	}
+	return m.authorizer.Authorize(ctx, VerbStart, startResource(userID, commands, applyStartOptions(opts)))
+}
+
+// startResource describes a job about to be started by userID.
+func startResource(userID string, commands []Command, options startOptions) Resource {
+	resource := Resource{Owner: userID, Labels: options.labels}
+	for _, command := range commands {
+		resource.Programs = append(resource.Programs, command.Program)
+	}
+	return resource
+}
+
+// observe notifies the observer once the job reached a final state.
+func (m *Manager) observe(userID string, job *Job) {
+	started := time.Now()
+	<-job.done
+	m.observer.JobFinished(userID, job.getStatus(), time.Since(started))
+}
+
+// Stats returns a snapshot of the jobs tracked by the Manager.
+func (m *Manager) Stats() Stats {
+	m.mutex.RLock()
+	records := make([]*jobRecord, 0, len(m.jobs))
+	for _, record := range m.jobs {
+		records = append(records, record)
+	}
+	m.mutex.RUnlock()
+
+	var stats Stats
+	for _, record := range records {
+		switch record.job.getStatus().State {
+		case Starting:
+			stats.Starting++
+		case Running:
+			stats.Running++
+		}
+		stats.OutputBytes += record.job.output.sizeBytes()
+	}
+	return stats
+}
+
 // Stop kills the job of specified job ID.
 func (m *Manager) Stop(ctx context.Context, jobID string) error {
-	job, err := m.readJob(ctx, jobID)
+	job, err := m.readJob(ctx, VerbStop, jobID)
 	if err != nil {
 		return err
 	}
@@ -71,7 +215,7 @@ func (m *Manager) Stop(ctx context.Context, jobID string) error {
 
 // GetStatus queries the job ID and returns job status, exit code.
 func (m *Manager) GetStatus(ctx context.Context, jobID string) (JobStatus, error) {
-	job, err := m.readJob(ctx, jobID)
+	job, err := m.readJob(ctx, VerbStatus, jobID)
 	if err != nil {
 		return JobStatus{}, err
 	}
@@ -79,9 +223,20 @@ func (m *Manager) GetStatus(ctx context.Context, jobID string) (JobStatus, error
 	return job.getStatus(), nil
 }
 
+// Wait blocks until the job of specified job ID reached a final state, and returns its status.
+// If ctx is done first, Wait returns the current status with ctx.Err().
+func (m *Manager) Wait(ctx context.Context, jobID string) (JobStatus, error) {
+	job, err := m.readJob(ctx, VerbStatus, jobID)
+	if err != nil {
+		return JobStatus{}, err
+	}
+
+	return job.waitDone(ctx)
+}
+
 // GetOutput queries the job ID and returns stdout, stderr.
 func (m *Manager) GetOutput(ctx context.Context, jobID string) (stdout, stderr string, err error) {
-	job, err := m.readJob(ctx, jobID)
+	job, err := m.readJob(ctx, VerbOutput, jobID)
 	if err != nil {
 		return "", "", err
 	}
@@ -90,23 +245,126 @@ func (m *Manager) GetOutput(ctx context.Context, jobID string) (stdout, stderr s
 	return stdout, stderr, nil
 }
 
-// readJob retrieves a Job if the jobID exists in table and user has valid role.
-func (m *Manager) readJob(ctx context.Context, jobID string) (*Job, error) {
-	userID, role, ok := getUserInfo(ctx)
+// GetOutputRecords queries the job ID and returns its timestamped output records,
+// merged across stdout/stderr in write order, starting at since.
+func (m *Manager) GetOutputRecords(ctx context.Context, jobID string, since time.Time) ([]OutputRecord, error) {
+	job, err := m.readJob(ctx, VerbOutput, jobID)
+	if err != nil {
+		return nil, err
+	}
+
+	return job.getOutputRecords(since), nil
+}
+
+// FollowOutput calls send with the output records of the job written at or after since,
+// then with every new record as it is written, until the job exited or ctx is done.
+// Returns ctx.Err() if ctx was done first, or the first error returned by send.
+func (m *Manager) FollowOutput(ctx context.Context, jobID string, since time.Time, send func(OutputRecord) error) error {
+	job, err := m.readJob(ctx, VerbOutput, jobID)
+	if err != nil {
+		return err
+	}
+
+	return job.output.follow(ctx, since, send)
+}
+
+// Signal sends sig to every process of a running job.
+func (m *Manager) Signal(ctx context.Context, jobID string, sig syscall.Signal) error {
+	job, err := m.readJob(ctx, VerbSignal, jobID)
+	if err != nil {
+		return err
+	}
+
+	return job.signal(sig)
+}
+
+// List returns the jobs the user may list, eg. its own jobs, or every job for admins, oldest first.
+func (m *Manager) List(ctx context.Context) ([]JobInfo, error) {
+	if err := m.Authorize(ctx, VerbList, Resource{}); err != nil {
+		return nil, err
+	}
+
+	m.mutex.RLock()
+	records := make([]*jobRecord, 0, len(m.jobs))
+	for _, record := range m.jobs {
+		if m.authorize(ctx, VerbList, record) == nil {
+			records = append(records, record)
+		}
+	}
+	m.mutex.RUnlock()
+
+	slices.SortFunc(records, func(a, b *jobRecord) int {
+		return a.created.Compare(b.created)
+	})
+
+	jobs := make([]JobInfo, 0, len(records))
+	for _, record := range records {
+		jobs = append(jobs, JobInfo{
+			ID:     record.job.ID,
+			UserID: record.userID,
+			Status: record.job.getStatus(),
+			Labels: record.resource.Labels,
+		})
+	}
+	return jobs, nil
+}
+
+// WriteStdin streams r into the standard input of the job, which must have been
+// started WithStdin and not yet closed. Returns the number of bytes written.
+func (m *Manager) WriteStdin(ctx context.Context, jobID string, r io.Reader) (int64, error) {
+	job, err := m.readJob(ctx, VerbAttach, jobID)
+	if err != nil {
+		return 0, err
+	}
+
+	return job.writeStdin(r)
+}
+
+// CloseStdin closes the standard input of the job, signalling end of input.
+func (m *Manager) CloseStdin(ctx context.Context, jobID string) error {
+	job, err := m.readJob(ctx, VerbAttach, jobID)
+	if err != nil {
+		return err
+	}
+
+	return job.closeStdin()
+}
+
+// Attach connects to the pseudo-terminal of a job started WithTTY.
+// Closing the returned Terminal detaches from the job, which keeps running.
+func (m *Manager) Attach(ctx context.Context, jobID string) (*Terminal, error) {
+	job, err := m.readJob(ctx, VerbAttach, jobID)
+	if err != nil {
+		return nil, err
+	}
+
+	return job.attach()
+}
+
+// readJob retrieves a Job if the jobID exists in table and the user may perform verb on it.
+func (m *Manager) readJob(ctx context.Context, verb, jobID string) (*Job, error) {
+	userID, _, ok := UserInfo(ctx)
 	if !ok {
 		return nil, ErrUnauthorized
 	}
 
 	m.mutex.RLock()
-	record := m.jobs[jobID]
-	m.mutex.RUnlock()
+	defer m.mutex.RUnlock()
 
-	// job is not found in table
-	// and, user can only act on owned jobs, unless they have admin role
-	if record == nil || (role != Admin && userID != record.userID) {
+	record := m.jobs[jobID]
+	if record == nil {
 		return nil, ErrNotFound
 	}
 
+	err := m.authorize(ctx, verb, record)
+	if err != nil {
+		// jobs of other users the user may not even see are reported as not found
+		if record.userID != userID && (verb == VerbStatus || m.authorize(ctx, VerbStatus, record) != nil) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
 	return record.job, nil
 }
 
@@ -115,8 +373,11 @@ func WithUserInfo(ctx context.Context, id, role string) context.Context {
 	return context.WithValue(ctx, userContextKey{}, &userInfo{id, role})
 }
 
-// getUserInfo retrieves user information data (userID and role) from context.
-func getUserInfo(ctx context.Context) (userID, role string, ok bool) {
+// UserInfo retrieves user information data (userID and role) from context.
+func UserInfo(ctx context.Context) (userID, role string, ok bool) {
 	userInfo, ok := ctx.Value(userContextKey{}).(*userInfo)
-	return userInfo.id, userInfo.role, ok
+	if !ok {
+		return "", "", false
+	}
+	return userInfo.id, userInfo.role, true
 }
@@ -3,7 +3,12 @@ package job
 import (
 	"context"
 	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 )
 
 // initManagerContext initiates Manager and the context used for Manager functions.
@@ -48,3 +53,220 @@ func TestUnauthorized(t *testing.T) {
 		t.Errorf("GetStatus() error: %s", err.Error())
 	}
 }
+
+func TestStartPipelineInvalid(t *testing.T) {
+	m, ctx := initManagerContext(User)
+
+	_, err := m.StartPipeline(ctx, nil)
+	if !errors.Is(err, ErrInvalidCommand) {
+		t.Errorf("StartPipeline() expected error: %s, got: %v", ErrInvalidCommand, err)
+	}
+
+	commands := []Command{{shortCmd[0], shortCmd[1:]}, {"/bin/cat", nil}}
+	_, err = m.StartPipeline(ctx, commands, WithTTY())
+	if !errors.Is(err, ErrInvalidCommand) {
+		t.Errorf("StartPipeline() expected error: %s, got: %v", ErrInvalidCommand, err)
+	}
+}
+
+func TestShutdownStop(t *testing.T) {
+	m, ctx := initManagerContext(User)
+
+	gracefulID, _ := m.Start(ctx, longCmd[0], longCmd[1:])
+	// ignore SIGTERM, so they are killed together once the shutdown context is done
+	stubbornCmd := []string{"-c", "trap '' TERM; echo ready; exec /bin/sleep 5"}
+	stubbornID, _ := m.Start(ctx, "/bin/sh", stubbornCmd)
+	otherStubbornID, _ := m.Start(ctx, "/bin/sh", stubbornCmd)
+
+	// every job must be running, with SIGTERM ignored, before shutting down
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+		graceful, _ := m.GetStatus(ctx, gracefulID)
+		stdout, _, _ := m.GetOutput(ctx, stubbornID)
+		otherStdout, _, _ := m.GetOutput(ctx, otherStubbornID)
+		if graceful.State == Running && stdout != "" && otherStdout != "" {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	summaries, err := m.Shutdown(shutdownCtx, ShutdownStop)
+	if err != nil {
+		t.Errorf("Shutdown() error: %s", err.Error())
+	}
+
+	outcomes := map[string]string{}
+	for _, summary := range summaries {
+		outcomes[summary.ID] = summary.Outcome
+		if summary.Status.State != Stopped {
+			t.Errorf("Shutdown() expected job %s stopped, got %s", summary.ID, summary.Status.State)
+		}
+	}
+	if outcomes[gracefulID] != OutcomeStopped || outcomes[stubbornID] != OutcomeKilled ||
+		outcomes[otherStubbornID] != OutcomeKilled {
+		t.Errorf("Shutdown() unexpected outcomes: %v", outcomes)
+	}
+
+	_, err = m.Start(ctx, shortCmd[0], shortCmd[1:])
+	if !errors.Is(err, ErrDraining) {
+		t.Errorf("Start() expected error: %s, got: %v", ErrDraining, err)
+	}
+}
+
+func TestShutdownWait(t *testing.T) {
+	m, ctx := initManagerContext(User)
+
+	jobID, _ := m.Start(ctx, "/bin/sleep", []string{"0.2"})
+
+	summaries, err := m.Shutdown(context.Background(), ShutdownWait)
+	if err != nil {
+		t.Errorf("Shutdown() error: %s", err.Error())
+	}
+
+	if len(summaries) != 1 || summaries[0].ID != jobID || summaries[0].Outcome != OutcomeFinished ||
+		summaries[0].Status.State != Completed {
+		t.Errorf("Shutdown() expected job %s finished, got %+v", jobID, summaries)
+	}
+}
+
+func TestShutdownDetach(t *testing.T) {
+	dir := t.TempDir()
+	m := NewManager(WithDetachDir(dir))
+	ctx := WithUserInfo(context.Background(), "user1", User)
+
+	jobID, _ := m.Start(ctx, "/bin/sh", []string{"-c", "echo before; read line; echo after; echo $line >&2"}, WithStdin())
+	defer m.Stop(ctx, jobID)
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+		if stdout, _, _ := m.GetOutput(ctx, jobID); stdout != "" {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	summaries, err := m.Shutdown(context.Background(), ShutdownDetach)
+	if err != nil {
+		t.Errorf("Shutdown() error: %s", err.Error())
+	}
+	if len(summaries) != 1 || summaries[0].Outcome != OutcomeDetached || summaries[0].Status.State != Running {
+		t.Fatalf("Shutdown() expected job %s detached and running, got %+v", jobID, summaries)
+	}
+	stdoutFile := filepath.Join(dir, jobID+".stdout")
+	stderrFile := filepath.Join(dir, jobID+".stderr")
+	if !slices.Equal(summaries[0].OutputFiles, []string{stdoutFile, stderrFile}) {
+		t.Errorf("Shutdown() unexpected output files: %v", summaries[0].OutputFiles)
+	}
+
+	// the output written after detaching goes to the files, after the output recorded before
+	if _, err := m.WriteStdin(ctx, jobID, strings.NewReader("detached\n")); err != nil {
+		t.Fatalf("WriteStdin() error: %s", err.Error())
+	}
+	expected := map[string]string{stdoutFile: "before\nafter\n", stderrFile: "detached\n"}
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+		done := true
+		for name, content := range expected {
+			data, _ := os.ReadFile(name)
+			done = done && string(data) == content
+		}
+		if done {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	for name, content := range expected {
+		if data, _ := os.ReadFile(name); string(data) != content {
+			t.Errorf("Detached output %s = %q, expected %q", name, data, content)
+		}
+	}
+}
+
+func TestList(t *testing.T) {
+	m, ctx := initManagerContext(User)
+	otherCtx := WithUserInfo(context.Background(), "user2", User)
+	adminCtx := WithUserInfo(context.Background(), "admin1", Admin)
+
+	first, _ := m.Start(ctx, shortCmd[0], shortCmd[1:])
+	second, _ := m.Start(otherCtx, shortCmd[0], shortCmd[1:])
+
+	jobs, err := m.List(ctx)
+	if err != nil {
+		t.Errorf("List() error: %s", err.Error())
+	}
+	if len(jobs) != 1 || jobs[0].ID != first {
+		t.Errorf("List() expected only job %s, got %+v", first, jobs)
+	}
+
+	jobs, _ = m.List(adminCtx)
+	if len(jobs) != 2 || jobs[0].ID != first || jobs[1].ID != second || jobs[1].UserID != "user2" {
+		t.Errorf("List() expected jobs %s and %s, oldest first, got %+v", first, second, jobs)
+	}
+
+	_, err = m.List(context.Background())
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("List() expected error: %s, got: %v", ErrUnauthorized, err)
+	}
+}
+
+func TestJobLimits(t *testing.T) {
+	m := NewManager(WithJobLimits(2, 1))
+	ctx := WithUserInfo(context.Background(), "user1", User)
+	otherCtx := WithUserInfo(context.Background(), "user2", User)
+
+	first, err := m.Start(ctx, longCmd[0], longCmd[1:])
+	if err != nil {
+		t.Fatalf("Start() error: %s", err.Error())
+	}
+	if _, err := m.Start(ctx, longCmd[0], longCmd[1:]); !errors.Is(err, ErrTooManyJobs) {
+		t.Errorf("Start() expected error over the user limit: %s, got: %v", ErrTooManyJobs, err)
+	}
+	if _, err := m.Start(otherCtx, longCmd[0], longCmd[1:]); err != nil {
+		t.Errorf("Start() error: %s", err.Error())
+	}
+	if _, err := m.Start(WithUserInfo(context.Background(), "user3", User), shortCmd[0], shortCmd[1:]); !errors.Is(err, ErrTooManyJobs) {
+		t.Errorf("Start() expected error over the total limit: %s, got: %v", ErrTooManyJobs, err)
+	}
+
+	// finished jobs no longer count
+	for status, _ := m.GetStatus(ctx, first); status.State == Starting; status, _ = m.GetStatus(ctx, first) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	m.Stop(ctx, first)
+	for status, _ := m.GetStatus(ctx, first); status.State == Running; status, _ = m.GetStatus(ctx, first) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err := m.Start(ctx, shortCmd[0], shortCmd[1:]); err != nil {
+		t.Errorf("Start() error after the job finished: %s", err.Error())
+	}
+}
+
+func TestWait(t *testing.T) {
+	m, ctx := initManagerContext(User)
+
+	jobID, err := m.Start(ctx, "/bin/sleep", []string{"0.2"})
+	if err != nil {
+		t.Fatalf("Start() error: %s", err.Error())
+	}
+
+	// the job is still running when the timeout passes
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	status, err := m.Wait(timeoutCtx, jobID)
+	if !errors.Is(err, context.DeadlineExceeded) || status.Finished() {
+		t.Errorf("Wait() expected %s with the job running, got %+v, %v", context.DeadlineExceeded, status, err)
+	}
+
+	status, err = m.Wait(ctx, jobID)
+	if err != nil {
+		t.Errorf("Wait() error: %s", err.Error())
+	}
+	if status.State != Completed || status.ExitCode == nil || *status.ExitCode != 0 {
+		t.Errorf("Wait() expected job %s completed, got %+v", jobID, status)
+	}
+
+	// other users may not wait on the job
+	_, err = m.Wait(WithUserInfo(context.Background(), "falsedummy", User), jobID)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("Wait() expected error: %s, got: %v", ErrNotFound, err)
+	}
+}
@@ -0,0 +1,55 @@
+package job
+
+import "maps"
+
+// StartOption configures optional behaviour of a job at Start.
+type StartOption func(*startOptions)
+
+// startOptions holds the optional settings applied by StartOption.
+type startOptions struct {
+	stdin    bool
+	tty      bool
+	pipefail bool
+	labels   map[string]string
+}
+
+// applyStartOptions returns the settings of the given options.
+func applyStartOptions(opts []StartOption) startOptions {
+	var options startOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
+
+// WithStdin keeps the job's standard input open, so it can be written with
+// Manager.WriteStdin until closed with Manager.CloseStdin.
+// Without it, jobs read from the null device.
+func WithStdin() StartOption {
+	return func(o *startOptions) {
+		o.stdin = true
+	}
+}
+
+// WithTTY runs the job on a pseudo-terminal, which serves as its stdin, stdout and stderr.
+// Its output is recorded as stdout, and clients can interact with it with Manager.Attach.
+func WithTTY() StartOption {
+	return func(o *startOptions) {
+		o.tty = true
+	}
+}
+
+// WithPipefail reports the exit code of the last pipeline stage that did not succeed,
+// instead of the exit code of the last stage.
+func WithPipefail() StartOption {
+	return func(o *startOptions) {
+		o.pipefail = true
+	}
+}
+
+// WithLabels attaches labels to the job, eg. to grant permissions on jobs by label.
+func WithLabels(labels map[string]string) StartOption {
+	return func(o *startOptions) {
+		o.labels = maps.Clone(labels)
+	}
+}
@@ -0,0 +1,229 @@
+package job
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Output streams
+const (
+	Stdout = "stdout"
+	Stderr = "stderr"
+)
+
+// DefaultOutputLimit is the size of the output kept for each job, unless set with WithOutputLimit.
+const DefaultOutputLimit = 16 << 20
+
+// outputDrainTimeout bounds how long the output of a job is read after it exited,
+// since background processes of the job may keep its stdout, stderr or terminal open.
+const outputDrainTimeout = 2 * time.Second
+
+// recordOverhead is the size of an OutputRecord besides its data, counted in the size of the output.
+const recordOverhead = 64
+
+// OutputRecord is one line (or trailing partial chunk) of job output,
+// tagged with the stream it was written to.
+type OutputRecord struct {
+	Seq    uint64
+	Time   time.Time
+	Stream string
+	Data   string
+}
+
+// outputLog keeps the ordered record stream of a job's stdout/stderr writes, the only copy of its output.
+// Sequence numbers are shared by both streams to preserve their interleaving.
+// Once the records exceed limit bytes, the oldest ones are dropped.
+type outputLog struct {
+	records  []OutputRecord
+	nextSeq  uint64
+	size     int
+	limit    int
+	logMutex sync.RWMutex
+
+	// updated is closed (and replaced) when records are appended or the log is closed,
+	// allowing followers to wait for new output instead of polling.
+	updated chan struct{}
+	closed  bool
+}
+
+// append splits p into lines and records each line under the given stream.
+func (l *outputLog) append(stream string, p []byte) {
+	now := time.Now()
+
+	l.logMutex.Lock()
+	defer l.logMutex.Unlock()
+
+	for len(p) > 0 {
+		line := p
+		if i := bytes.IndexByte(p, '\n'); i >= 0 {
+			line = p[:i+1]
+		}
+		p = p[len(line):]
+
+		l.nextSeq++
+		l.records = append(l.records, OutputRecord{
+			Seq:    l.nextSeq,
+			Time:   now,
+			Stream: stream,
+			Data:   string(line),
+		})
+		l.size += len(line) + recordOverhead
+	}
+	l.truncate()
+
+	l.notify()
+}
+
+// truncate drops the oldest records until the log fits in its limit, keeping at least the last record.
+// Caller must hold logMutex.
+func (l *outputLog) truncate() {
+	if l.limit <= 0 {
+		return
+	}
+
+	dropped := 0
+	for l.size > l.limit && dropped < len(l.records)-1 {
+		l.size -= len(l.records[dropped].Data) + recordOverhead
+		dropped++
+	}
+	// release the data of the dropped records, which the backing array would otherwise keep
+	clear(l.records[:dropped])
+	l.records = l.records[dropped:]
+}
+
+// outputPipe is the read end of a job's stdout or stderr, or its terminal master.
+type outputPipe struct {
+	stream string
+	file   *os.File
+}
+
+// streamWriter records the writes of a job's stdout or stderr in its output log.
+type streamWriter struct {
+	stream string
+	log    *outputLog
+}
+
+func (w streamWriter) Write(p []byte) (int, error) {
+	w.log.append(w.stream, p)
+	return len(p), nil
+}
+
+// close marks the end of the record stream, once the job has exited.
+func (l *outputLog) close() {
+	l.logMutex.Lock()
+	defer l.logMutex.Unlock()
+
+	l.closed = true
+	l.notify()
+}
+
+// notify wakes up every follower waiting on updated. Caller must hold logMutex.
+func (l *outputLog) notify() {
+	if l.updated != nil {
+		close(l.updated)
+		l.updated = nil
+	}
+}
+
+// after returns a copy of the records with a sequence number greater than seq.
+// If there are none, updated is closed on the next change to the log,
+// and closed reports whether the log will never receive new records.
+func (l *outputLog) after(seq uint64) (records []OutputRecord, updated <-chan struct{}, closed bool) {
+	l.logMutex.Lock()
+	defer l.logMutex.Unlock()
+
+	// records are numbered from 1 without gaps, after the dropped ones;
+	// followers behind the oldest record kept skip the dropped ones
+	first := l.nextSeq - uint64(len(l.records))
+	seq = max(seq, first)
+	if seq < l.nextSeq {
+		return append([]OutputRecord{}, l.records[seq-first:]...), nil, l.closed
+	}
+
+	if l.updated == nil {
+		l.updated = make(chan struct{})
+	}
+	return nil, l.updated, l.closed
+}
+
+// follow calls send with the records written at or after t, then with every new record
+// as it is appended, until the log is closed or ctx is done.
+func (l *outputLog) follow(ctx context.Context, t time.Time, send func(OutputRecord) error) error {
+	var seq uint64
+	for {
+		records, updated, closed := l.after(seq)
+		for _, record := range records {
+			seq = record.Seq
+			if record.Time.Before(t) {
+				continue
+			}
+			if err := send(record); err != nil {
+				return err
+			}
+		}
+		if len(records) > 0 {
+			continue
+		}
+
+		if closed {
+			return nil
+		}
+
+		select {
+		case <-updated:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// lastSeq returns the sequence number of the most recent record, or 0 if none.
+func (l *outputLog) lastSeq() uint64 {
+	l.logMutex.RLock()
+	defer l.logMutex.RUnlock()
+
+	return l.nextSeq
+}
+
+// sizeBytes returns the size of the records kept, including their overhead.
+func (l *outputLog) sizeBytes() int {
+	l.logMutex.RLock()
+	defer l.logMutex.RUnlock()
+
+	return l.size
+}
+
+// streams returns the data of the records kept, written to stdout and stderr.
+func (l *outputLog) streams() (stdout, stderr string) {
+	l.logMutex.RLock()
+	defer l.logMutex.RUnlock()
+
+	var out, err strings.Builder
+	for _, record := range l.records {
+		if record.Stream == Stderr {
+			err.WriteString(record.Data)
+		} else {
+			out.WriteString(record.Data)
+		}
+	}
+	return out.String(), err.String()
+}
+
+// since returns a copy of the records written at or after t.
+// A zero t returns every record.
+func (l *outputLog) since(t time.Time) []OutputRecord {
+	l.logMutex.RLock()
+	defer l.logMutex.RUnlock()
+
+	records := []OutputRecord{}
+	for _, record := range l.records {
+		if !record.Time.Before(t) {
+			records = append(records, record)
+		}
+	}
+	return records
+}
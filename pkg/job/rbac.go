@@ -0,0 +1,204 @@
+package job
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+)
+
+// verbs are the permission verbs of role rules.
+var verbs = []string{VerbStart, VerbStop, VerbStatus, VerbOutput, VerbSignal, VerbList, VerbAttach, VerbShare, VerbAdmin}
+
+// Policy defines named roles of permissions, bound to users or groups.
+// The group of a user is the role of its access token or client certificate.
+type Policy struct {
+	Roles    []Role    `json:"roles"`
+	Bindings []Binding `json:"bindings"`
+}
+
+// Role is a named set of permission rules.
+type Role struct {
+	Name  string `json:"name"`
+	Rules []Rule `json:"rules"`
+}
+
+// Rule grants verbs on jobs in a scope, optionally limited to jobs matching every matcher.
+type Rule struct {
+	// Verbs are permission verbs, or "*" for every verb.
+	Verbs []string `json:"verbs"`
+	// Scope is ScopeOwn (default) for jobs owned by the user, or ScopeAll for every job.
+	Scope string `json:"scope,omitempty"`
+	// Programs are path.Match patterns, one of which every program of the job must match.
+	Programs []string `json:"programs,omitempty"`
+	// Labels must all be set on the job with the same value, or any value for "*".
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// Binding grants a role to users and to every user of groups.
+type Binding struct {
+	Role   string   `json:"role"`
+	Users  []string `json:"users,omitempty"`
+	Groups []string `json:"groups,omitempty"`
+}
+
+// DefaultPolicy grants the User group every permission on its own jobs,
+// and the Admin group every permission on every job.
+func DefaultPolicy() Policy {
+	return Policy{
+		Roles: []Role{
+			{Name: User, Rules: []Rule{{
+				Verbs: []string{VerbStart, VerbStop, VerbStatus, VerbOutput, VerbSignal, VerbList, VerbAttach, VerbShare},
+				Scope: ScopeOwn,
+			}}},
+			{Name: Admin, Rules: []Rule{{Verbs: []string{"*"}, Scope: ScopeAll}}},
+		},
+		Bindings: []Binding{
+			{Role: User, Groups: []string{User}},
+			{Role: Admin, Groups: []string{Admin}},
+		},
+	}
+}
+
+// LoadPolicy reads a Policy from a JSON file, and validates it.
+func LoadPolicy(path string) (Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Policy{}, err
+	}
+
+	var policy Policy
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&policy); err != nil {
+		return Policy{}, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := policy.Validate(); err != nil {
+		return Policy{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return policy, nil
+}
+
+// Validate checks that roles have unique names and valid rules, and that bindings refer to roles.
+func (p Policy) Validate() error {
+	names := map[string]bool{}
+	for _, role := range p.Roles {
+		if role.Name == "" {
+			return fmt.Errorf("role without name")
+		}
+		if names[role.Name] {
+			return fmt.Errorf("role %s defined twice", role.Name)
+		}
+		names[role.Name] = true
+
+		for _, rule := range role.Rules {
+			if err := rule.validate(); err != nil {
+				return fmt.Errorf("role %s: %w", role.Name, err)
+			}
+		}
+	}
+
+	for _, binding := range p.Bindings {
+		if !names[binding.Role] {
+			return fmt.Errorf("binding of unknown role %s", binding.Role)
+		}
+	}
+	return nil
+}
+
+func (r Rule) validate() error {
+	if len(r.Verbs) == 0 {
+		return fmt.Errorf("rule without verbs")
+	}
+	for _, verb := range r.Verbs {
+		if verb != "*" && !slices.Contains(verbs, verb) {
+			return fmt.Errorf("unknown verb %q, expected one of %v or *", verb, verbs)
+		}
+	}
+	if r.Scope != "" && r.Scope != ScopeOwn && r.Scope != ScopeAll {
+		return fmt.Errorf("unknown scope %q, expected %s or %s", r.Scope, ScopeOwn, ScopeAll)
+	}
+	for _, pattern := range r.Programs {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("program pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// RBAC is an Authorizer granting the permissions of the roles bound to users and their groups.
+type RBAC struct {
+	policy Policy
+}
+
+// NewRBAC creates an Authorizer enforcing a validated policy.
+func NewRBAC(policy Policy) (*RBAC, error) {
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+	return &RBAC{policy: policy}, nil
+}
+
+// Authorize allows verb if a rule of a role bound to the user or its group grants it on resource.
+// For the zero Resource, any rule granting verb allows it.
+func (r *RBAC) Authorize(ctx context.Context, verb string, resource Resource) error {
+	userID, group, ok := UserInfo(ctx)
+	if !ok {
+		return ErrUnauthorized
+	}
+
+	for _, binding := range r.policy.Bindings {
+		if !slices.Contains(binding.Users, userID) && !slices.Contains(binding.Groups, group) {
+			continue
+		}
+		for _, role := range r.policy.Roles {
+			if role.Name != binding.Role {
+				continue
+			}
+			for _, rule := range role.Rules {
+				if rule.allows(userID, verb, resource) {
+					return nil
+				}
+			}
+		}
+	}
+
+	denied := &PermissionError{Verb: verb}
+	if resource.Owner == userID {
+		denied.Scope = ScopeOwn
+	} else if resource.Owner != "" {
+		denied.Scope = ScopeAll
+	}
+	return denied
+}
+
+func (r Rule) allows(userID, verb string, resource Resource) bool {
+	if !slices.Contains(r.Verbs, verb) && !slices.Contains(r.Verbs, "*") {
+		return false
+	}
+	if resource.Owner == "" {
+		return true
+	}
+
+	if r.Scope != ScopeAll && resource.Owner != userID {
+		return false
+	}
+	for _, program := range resource.Programs {
+		if len(r.Programs) > 0 && !slices.ContainsFunc(r.Programs, func(pattern string) bool {
+			matched, _ := path.Match(pattern, program)
+			return matched
+		}) {
+			return false
+		}
+	}
+	for key, value := range r.Labels {
+		label, ok := resource.Labels[key]
+		if !ok || value != "*" && label != value {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,169 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// testPolicy lets operators of the ops group stop and signal web jobs of any user,
+// and lets user3 start only echo jobs, on top of the DefaultPolicy.
+func testPolicy() Policy {
+	policy := DefaultPolicy()
+	policy.Roles = append(policy.Roles,
+		Role{Name: "operator", Rules: []Rule{
+			{Verbs: []string{VerbList, VerbStatus}, Scope: ScopeAll},
+			{Verbs: []string{VerbStop, VerbSignal}, Scope: ScopeAll, Labels: map[string]string{"team": "web"}},
+		}},
+		Role{Name: "echoer", Rules: []Rule{{Verbs: []string{"*"}, Programs: []string{"/bin/ech*"}}}},
+	)
+	policy.Bindings = append(policy.Bindings,
+		Binding{Role: "operator", Groups: []string{"ops"}},
+		Binding{Role: "echoer", Users: []string{"user3"}},
+	)
+	return policy
+}
+
+func TestRBAC(t *testing.T) {
+	rbac, err := NewRBAC(testPolicy())
+	if err != nil {
+		t.Fatalf("NewRBAC() error: %s", err.Error())
+	}
+
+	user := WithUserInfo(context.Background(), "user1", User)
+	operator := WithUserInfo(context.Background(), "operator1", "ops")
+	echoer := WithUserInfo(context.Background(), "user3", "guests")
+	web := Resource{Owner: "user1", Programs: []string{"/bin/sleep"}, Labels: map[string]string{"team": "web"}}
+	db := Resource{Owner: "user1", Programs: []string{"/bin/sleep"}, Labels: map[string]string{"team": "db"}}
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		verb     string
+		resource Resource
+		denied   *PermissionError
+	}{
+		{"owner stops", user, VerbStop, web, nil},
+		{"owner without admin", user, VerbAdmin, Resource{}, &PermissionError{Verb: VerbAdmin}},
+		{"other user", WithUserInfo(context.Background(), "user2", User), VerbStop, web,
+			&PermissionError{Verb: VerbStop, Scope: ScopeAll}},
+		{"operator lists", operator, VerbList, Resource{}, nil},
+		{"operator stops web", operator, VerbStop, web, nil},
+		{"operator stops db", operator, VerbStop, db, &PermissionError{Verb: VerbStop, Scope: ScopeAll}},
+		{"operator starts", operator, VerbStart, Resource{Owner: "operator1"},
+			&PermissionError{Verb: VerbStart, Scope: ScopeOwn}},
+		{"echoer starts echo", echoer, VerbStart, Resource{Owner: "user3", Programs: []string{"/bin/echo"}}, nil},
+		{"echoer starts pipeline", echoer, VerbStart,
+			Resource{Owner: "user3", Programs: []string{"/bin/echo", "/bin/cat"}},
+			&PermissionError{Verb: VerbStart, Scope: ScopeOwn}},
+	}
+
+	for _, test := range tests {
+		err := rbac.Authorize(test.ctx, test.verb, test.resource)
+		if test.denied == nil {
+			if err != nil {
+				t.Errorf("Authorize() %s error: %s", test.name, err.Error())
+			}
+			continue
+		}
+
+		var denied *PermissionError
+		if !errors.As(err, &denied) || *denied != *test.denied || !errors.Is(err, ErrForbidden) {
+			t.Errorf("Authorize() %s expected error: %s, got: %v", test.name, test.denied, err)
+		}
+	}
+
+	want := "permission denied: missing stop permission on all jobs"
+	if got := (&PermissionError{Verb: VerbStop, Scope: ScopeAll}).Error(); got != want {
+		t.Errorf("PermissionError expected %q, got %q", want, got)
+	}
+}
+
+func TestManagerRBAC(t *testing.T) {
+	rbac, _ := NewRBAC(testPolicy())
+	m := NewManager(WithAuthorizer(rbac))
+	user := WithUserInfo(context.Background(), "user1", User)
+	operator := WithUserInfo(context.Background(), "operator1", "ops")
+	guest := WithUserInfo(context.Background(), "guest1", "guests")
+
+	web, err := m.Start(user, longCmd[0], longCmd[1:], WithLabels(map[string]string{"team": "web"}))
+	if err != nil {
+		t.Fatalf("Start() error: %s", err.Error())
+	}
+	db, _ := m.Start(user, longCmd[0], longCmd[1:], WithLabels(map[string]string{"team": "db"}))
+	defer m.Stop(user, db)
+
+	jobs, err := m.List(operator)
+	if err != nil || len(jobs) != 2 || jobs[0].Labels["team"] != "web" {
+		t.Errorf("List() expected both jobs with labels, got %+v, error: %v", jobs, err)
+	}
+
+	// the operator sees every job, so a missing permission is reported
+	if err := m.Stop(operator, db); !errors.Is(err, ErrForbidden) {
+		t.Errorf("Stop() expected error: %s, got: %v", ErrForbidden, err)
+	}
+	for status, _ := m.GetStatus(user, web); status.State == Starting; status, _ = m.GetStatus(user, web) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := m.Signal(operator, web, syscall.SIGTERM); err != nil {
+		t.Errorf("Signal() error: %s", err.Error())
+	}
+
+	// the guest may not see the jobs of other users
+	if err := m.Stop(guest, db); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Stop() expected error: %s, got: %v", ErrNotFound, err)
+	}
+	if _, err := m.List(guest); !errors.Is(err, ErrForbidden) {
+		t.Errorf("List() expected error: %s, got: %v", ErrForbidden, err)
+	}
+
+	for range 50 {
+		status, _ := m.GetStatus(user, web)
+		if status.State != Running {
+			if status.ExitCode == nil || *status.ExitCode != -1 {
+				t.Errorf("Signal() expected job killed by SIGTERM, got %+v", status)
+			}
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Errorf("Signal() expected job to exit")
+}
+
+func TestLoadPolicy(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		content string
+		valid   bool
+	}{
+		{"valid", `{"roles": [{"name": "viewer", "rules": [{"verbs": ["list", "status"], "scope": "all"}]}],
+			"bindings": [{"role": "viewer", "groups": ["user"]}]}`, true},
+		{"unknown field", `{"roles": [], "bindngs": []}`, false},
+		{"unknown verb", `{"roles": [{"name": "viewer", "rules": [{"verbs": ["read"]}]}]}`, false},
+		{"unknown scope", `{"roles": [{"name": "viewer", "rules": [{"verbs": ["list"], "scope": "some"}]}]}`, false},
+		{"bad pattern", `{"roles": [{"name": "viewer", "rules": [{"verbs": ["start"], "programs": ["/bin/["]}]}]}`, false},
+		{"duplicate role", `{"roles": [{"name": "viewer"}, {"name": "viewer"}]}`, false},
+		{"unknown role", `{"bindings": [{"role": "viewer", "users": ["user1"]}]}`, false},
+	}
+
+	for _, test := range tests {
+		path := filepath.Join(dir, "roles.json")
+		if err := os.WriteFile(path, []byte(test.content), 0600); err != nil {
+			t.Fatalf("WriteFile() error: %s", err.Error())
+		}
+
+		_, err := LoadPolicy(path)
+		if test.valid && err != nil {
+			t.Errorf("LoadPolicy() %s error: %s", test.name, err.Error())
+		}
+		if !test.valid && err == nil {
+			t.Errorf("LoadPolicy() %s expected error", test.name)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+var ErrDraining = errors.New("service is shutting down, not accepting new jobs")
+
+// ShutdownPolicy selects what Manager.Shutdown does with jobs still running.
+type ShutdownPolicy string
+
+// Shutdown policies
+const (
+	// ShutdownWait waits for running jobs to complete on their own.
+	ShutdownWait ShutdownPolicy = "wait"
+	// ShutdownStop sends SIGTERM to running jobs, then SIGKILL when the shutdown context is done.
+	ShutdownStop ShutdownPolicy = "stop"
+	// ShutdownDetach leaves running jobs running, unmanaged, after the service exits.
+	// Their output is written to files in the detach directory (see WithDetachDir).
+	ShutdownDetach ShutdownPolicy = "detach"
+)
+
+// Shutdown outcomes of a job
+const (
+	OutcomeFinished = "finished"
+	OutcomeStopped  = "stopped"
+	OutcomeKilled   = "killed"
+	OutcomeDetached = "detached"
+	OutcomeRunning  = "still running"
+)
+
+// killWait bounds how long Shutdown waits for killed jobs to be reaped.
+const killWait = 5 * time.Second
+
+// JobSummary reports what happened to a job that was running when Shutdown began.
+type JobSummary struct {
+	ID      string
+	UserID  string
+	Outcome string
+	Status  JobStatus
+	// OutputFiles are the files receiving the output of a detached job.
+	OutputFiles []string
+}
+
+// WithDetachDir sets the directory of the output files of jobs detached by Shutdown, os.TempDir() by default.
+func WithDetachDir(dir string) ManagerOption {
+	return func(m *Manager) {
+		m.detachDir = dir
+	}
+}
+
+// ParseShutdownPolicy validates a shutdown policy name.
+func ParseShutdownPolicy(name string) (ShutdownPolicy, error) {
+	policy := ShutdownPolicy(name)
+	switch policy {
+	case ShutdownWait, ShutdownStop, ShutdownDetach:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown shutdown policy %q, expected %s, %s or %s",
+		name, ShutdownWait, ShutdownStop, ShutdownDetach)
+}
+
+// Shutdown drains the Manager: new jobs are refused with ErrDraining, and jobs still
+// running are handled according to policy. It returns a summary of every job that was
+// running, and ctx.Err() if ctx was done before the running jobs were handled.
+func (m *Manager) Shutdown(ctx context.Context, policy ShutdownPolicy) ([]JobSummary, error) {
+	if _, err := ParseShutdownPolicy(string(policy)); err != nil {
+		return nil, err
+	}
+
+	m.mutex.Lock()
+	m.draining = true
+	var records []*jobRecord
+	for _, record := range m.jobs {
+		select {
+		case <-record.job.done:
+		default:
+			records = append(records, record)
+		}
+	}
+	m.mutex.Unlock()
+
+	summaries := make([]JobSummary, len(records))
+	var shutdownErr error
+
+	if policy == ShutdownStop {
+		for _, record := range records {
+			record.job.signal(syscall.SIGTERM)
+		}
+	}
+
+	var stubborn []int
+	for i, record := range records {
+		summaries[i] = JobSummary{ID: record.job.ID, UserID: record.userID}
+
+		switch policy {
+		case ShutdownDetach:
+			summaries[i].Outcome = OutcomeDetached
+			files, err := record.job.detachOutput(m.detachDirectory())
+			if err != nil {
+				shutdownErr = errors.Join(shutdownErr, fmt.Errorf("detaching job %s: %w", record.job.ID, err))
+			}
+			summaries[i].OutputFiles = files
+
+		case ShutdownWait, ShutdownStop:
+			summaries[i].Outcome = OutcomeFinished
+			if policy == ShutdownStop {
+				summaries[i].Outcome = OutcomeStopped
+			}
+			if !waitJob(ctx, record.job) {
+				stubborn = append(stubborn, i)
+			}
+		}
+	}
+
+	switch {
+	case len(stubborn) == 0:
+	case policy == ShutdownWait:
+		for _, i := range stubborn {
+			summaries[i].Outcome = OutcomeRunning
+		}
+		shutdownErr = ctx.Err()
+
+	case policy == ShutdownStop:
+		// the jobs ignored SIGTERM, or ctx was done before they could exit:
+		// kill all of them, then wait for them together
+		for _, i := range stubborn {
+			records[i].job.stop()
+		}
+		killCtx, cancel := context.WithTimeout(context.Background(), killWait)
+		defer cancel()
+
+		for _, i := range stubborn {
+			summaries[i].Outcome = OutcomeKilled
+			if !waitJob(killCtx, records[i].job) {
+				summaries[i].Outcome = OutcomeRunning
+				shutdownErr = ctx.Err()
+			}
+		}
+	}
+
+	for i, record := range records {
+		summaries[i].Status = record.job.getStatus()
+	}
+	return summaries, shutdownErr
+}
+
+// Draining reports whether Shutdown was called, and new jobs are refused.
+func (m *Manager) Draining() bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return m.draining
+}
+
+// waitJob blocks until job reached a final state, or ctx is done, and reports whether the job is done.
+// A job done by the time ctx is done counts as done.
+func waitJob(ctx context.Context, job *Job) bool {
+	select {
+	case <-job.done:
+		return true
+	case <-ctx.Done():
+	}
+	select {
+	case <-job.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// detachDirectory returns the directory of the output files of detached jobs.
+func (m *Manager) detachDirectory() string {
+	if m.detachDir == "" {
+		return os.TempDir()
+	}
+	return m.detachDir
+}
+
+// detachOutput hands the outputs of a running job over to cat processes, appending them to files
+// in dir after the output recorded so far. They outlive the service: otherwise the job would write
+// to closed pipes, or have its terminal hung up, once the service exits.
+// Returns the paths of the files.
+func (j *Job) detachOutput(dir string) ([]string, error) {
+	j.statusMutex.RLock()
+	defer j.statusMutex.RUnlock()
+
+	// the outputs of jobs which are not running were never copied, or are already closed
+	if j.status.State != Running {
+		return nil, nil
+	}
+
+	cat, err := exec.LookPath("cat")
+	if err != nil {
+		return nil, err
+	}
+
+	// stop copying the outputs into the output log, leaving the output not yet read in them
+	for _, output := range j.outputs {
+		output.file.SetReadDeadline(time.Now())
+	}
+	<-j.outputDone
+
+	stdout, stderr := j.output.streams()
+	var paths []string
+	for _, output := range j.outputs {
+		path := filepath.Join(dir, j.ID+"."+output.stream)
+		recorded := stdout
+		if output.stream == Stderr {
+			recorded = stderr
+		}
+		if err := detachStream(cat, path, recorded, output.file); err != nil {
+			return paths, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// detachStream writes recorded to the file at path, then starts cat appending output to it,
+// in its own session so it is not hung up with the service.
+func detachStream(cat, path, recorded string, output *os.File) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err := file.WriteString(recorded); err != nil {
+		return err
+	}
+
+	cmd := exec.Command(cat)
+	cmd.Stdin = output
+	cmd.Stdout = file
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	// reaps cat if the service keeps running
+	go cmd.Wait()
+	return nil
+}
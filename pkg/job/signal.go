@@ -0,0 +1,33 @@
+package job
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"syscall"
+)
+
+var ErrInvalidSignal = errors.New("invalid signal")
+
+// signals are the signals that can be sent to jobs with Manager.Signal.
+var signals = map[string]syscall.Signal{
+	"HUP":  syscall.SIGHUP,
+	"INT":  syscall.SIGINT,
+	"QUIT": syscall.SIGQUIT,
+	"KILL": syscall.SIGKILL,
+	"USR1": syscall.SIGUSR1,
+	"USR2": syscall.SIGUSR2,
+	"TERM": syscall.SIGTERM,
+	"CONT": syscall.SIGCONT,
+	"STOP": syscall.SIGSTOP,
+	"TSTP": syscall.SIGTSTP,
+}
+
+// ParseSignal parses a signal name, with or without the SIG prefix, eg. SIGTERM or term.
+func ParseSignal(name string) (syscall.Signal, error) {
+	sig, ok := signals[strings.TrimPrefix(strings.ToUpper(name), "SIG")]
+	if !ok {
+		return 0, fmt.Errorf("%w %q", ErrInvalidSignal, name)
+	}
+	return sig, nil
+}
@@ -0,0 +1,97 @@
+package job
+
+import (
+	"errors"
+	"io"
+	"os"
+	"syscall"
+)
+
+var ErrStdinClosed = errors.New("job stdin is not open")
+
+// openStdin connects a pipe to the job's standard input, if requested at Start.
+// Must be called before the job process is started.
+// Writes made before the process starts are buffered by the pipe.
+func (j *Job) openStdin() error {
+	j.stdinMutex.Lock()
+	defer j.stdinMutex.Unlock()
+
+	// jobs with a terminal read their input from it
+	if !j.options.stdin || j.options.tty {
+		return nil
+	}
+
+	pipe, err := j.stages[0].StdinPipe()
+	if err != nil {
+		return err
+	}
+	j.stdin = pipe
+	return nil
+}
+
+// stdinChunkSize is the size of the chunks written by writeStdin.
+const stdinChunkSize = 32 << 10
+
+// writeStdin copies r into the job's standard input until r is drained, chunk by chunk.
+// The chunks of concurrent writers are not interleaved, but their streams may be.
+// Closing stdin interrupts the copy with ErrStdinClosed.
+func (j *Job) writeStdin(r io.Reader) (int64, error) {
+	var written int64
+	buf := make([]byte, stdinChunkSize)
+	for {
+		n, readErr := r.Read(buf)
+		if n > 0 {
+			n, err := j.writeStdinChunk(buf[:n])
+			written += int64(n)
+			if err != nil {
+				return written, err
+			}
+		}
+		if errors.Is(readErr, io.EOF) {
+			return written, nil
+		}
+		if readErr != nil {
+			return written, readErr
+		}
+	}
+}
+
+// writeStdinChunk writes p to the job's standard input. It holds the stdin lock only to read the pipe,
+// so closeStdin can close it while the write is blocked on a job which does not read its input.
+func (j *Job) writeStdinChunk(p []byte) (int, error) {
+	j.stdinWriteMutex.Lock()
+	defer j.stdinWriteMutex.Unlock()
+
+	j.stdinMutex.Lock()
+	stdin := j.stdin
+	j.stdinMutex.Unlock()
+	if stdin == nil {
+		return 0, ErrStdinClosed
+	}
+
+	n, err := stdin.Write(p)
+	// the pipe is closed by closeStdin, or once the process exits and is reaped
+	if errors.Is(err, os.ErrClosed) || errors.Is(err, syscall.EPIPE) {
+		return n, ErrStdinClosed
+	}
+	return n, err
+}
+
+// closeStdin closes the job's standard input, signalling end of input to the process,
+// and interrupting the writes in progress.
+func (j *Job) closeStdin() error {
+	j.stdinMutex.Lock()
+	stdin := j.stdin
+	j.stdin = nil
+	j.stdinMutex.Unlock()
+
+	if stdin == nil {
+		return ErrStdinClosed
+	}
+
+	err := stdin.Close()
+	if err != nil && !errors.Is(err, os.ErrClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+package job
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"syscall"
+
+	"github.com/creack/pty"
+	"golang.org/x/sys/unix"
+)
+
+var ErrNoTerminal = errors.New("job has no terminal")
+var ErrDetached = errors.New("terminal detached")
+
+// Default pseudo-terminal size, until a client attaches and resizes it.
+const (
+	DefaultTerminalRows = 24
+	DefaultTerminalCols = 80
+)
+
+// openTerminal allocates a pseudo-terminal for the job, if requested at Start,
+// and connects it to the job's stdin, stdout and stderr.
+// Must be called before the job process is started.
+func (j *Job) openTerminal() error {
+	if !j.options.tty {
+		return nil
+	}
+
+	ptmx, tty, err := pty.Open()
+	if err != nil {
+		return err
+	}
+	ptmx, err = pollable(ptmx)
+	if err != nil {
+		tty.Close()
+		return err
+	}
+
+	err = setTerminalSize(ptmx, DefaultTerminalRows, DefaultTerminalCols)
+	if err != nil {
+		ptmx.Close()
+		tty.Close()
+		return err
+	}
+
+	// the job leads a new session with the terminal as its controlling terminal
+	j.stages[0].Stdin = tty
+	j.stages[0].Stdout = tty
+	j.stages[0].Stderr = tty
+	j.stages[0].SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true}
+
+	j.ptmx = ptmx
+	j.tty = tty
+	j.outputs = []outputPipe{{stream: Stdout, file: ptmx}}
+
+	// terminal input is written to the master side; it is never closed as a stdin pipe
+	j.stdinMutex.Lock()
+	j.stdin = nopWriteCloser{ptmx}
+	j.stdinMutex.Unlock()
+
+	return nil
+}
+
+// pollable returns a copy of the terminal master f in non-blocking mode, closing f, so that reads
+// are interrupted by closing it. pty.Open leaves the master in blocking mode.
+func pollable(f *os.File) (*os.File, error) {
+	defer f.Close()
+
+	conn, err := f.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+
+	var fd int
+	var dupErr error
+	err = conn.Control(func(raw uintptr) {
+		fd, dupErr = unix.FcntlInt(raw, unix.F_DUPFD_CLOEXEC, 0)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if dupErr != nil {
+		return nil, dupErr
+	}
+
+	if err := unix.SetNonblock(fd, true); err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+	return os.NewFile(uintptr(fd), f.Name()), nil
+}
+
+// setTerminalSize sets the window size of the terminal master f, without taking it out
+// of non-blocking mode like f.Fd() would.
+func setTerminalSize(f *os.File, rows, cols uint16) error {
+	conn, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var ioctlErr error
+	err = conn.Control(func(fd uintptr) {
+		ioctlErr = unix.IoctlSetWinsize(int(fd), unix.TIOCSWINSZ, &unix.Winsize{Row: rows, Col: cols})
+	})
+	if err != nil {
+		return err
+	}
+	return ioctlErr
+}
+
+// nopWriteCloser turns closing the terminal's input into a no-op,
+// since closing the master would hang up the job's terminal.
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// Terminal is an attachment to a running job's pseudo-terminal.
+// Reads return the job's output written after attaching; writes are sent as terminal input.
+// Closing the Terminal detaches from the job, which keeps running.
+type Terminal struct {
+	job *Job
+
+	seq     uint64
+	pending []byte
+
+	detached   chan struct{}
+	detachOnce sync.Once
+}
+
+// attach creates a Terminal that follows output written after this call.
+func (j *Job) attach() (*Terminal, error) {
+	if j.ptmx == nil {
+		return nil, ErrNoTerminal
+	}
+
+	return &Terminal{
+		job:      j,
+		seq:      j.output.lastSeq(),
+		detached: make(chan struct{}),
+	}, nil
+}
+
+// Read blocks until the job writes output to its terminal.
+// Returns io.EOF after the job exited and every output was read,
+// or ErrDetached once the Terminal is closed. Read is not safe for concurrent use.
+func (t *Terminal) Read(p []byte) (int, error) {
+	for {
+		select {
+		case <-t.detached:
+			return 0, ErrDetached
+		default:
+		}
+
+		if len(t.pending) > 0 {
+			n := copy(p, t.pending)
+			t.pending = t.pending[n:]
+			return n, nil
+		}
+
+		records, updated, closed := t.job.output.after(t.seq)
+		if len(records) > 0 {
+			for _, record := range records {
+				t.pending = append(t.pending, record.Data...)
+			}
+			t.seq = records[len(records)-1].Seq
+			continue
+		}
+
+		if closed {
+			return 0, io.EOF
+		}
+
+		select {
+		case <-updated:
+		case <-t.detached:
+			return 0, ErrDetached
+		}
+	}
+}
+
+// Write sends p as input to the job's terminal.
+func (t *Terminal) Write(p []byte) (int, error) {
+	select {
+	case <-t.detached:
+		return 0, ErrDetached
+	default:
+	}
+
+	n, err := t.job.ptmx.Write(p)
+	if errors.Is(err, os.ErrClosed) || errors.Is(err, syscall.EIO) {
+		return n, ErrStdinClosed
+	}
+	return n, err
+}
+
+// Resize changes the window size of the job's terminal, notifying the job with SIGWINCH.
+func (t *Terminal) Resize(rows, cols uint16) error {
+	err := setTerminalSize(t.job.ptmx, rows, cols)
+	if errors.Is(err, os.ErrClosed) {
+		return ErrStdinClosed
+	}
+	return err
+}
+
+// Close detaches from the job's terminal without stopping the job.
+func (t *Terminal) Close() error {
+	t.detachOnce.Do(func() {
+		close(t.detached)
+	})
+	return nil
+}
@@ -0,0 +1,119 @@
+package job
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readUntil reads from the terminal until its output contains want, or times out.
+func readUntil(t *testing.T, terminal *Terminal, want string) string {
+	t.Helper()
+
+	result := make(chan string, 1)
+	go func() {
+		var output []byte
+		buf := make([]byte, 1024)
+		for !strings.Contains(string(output), want) {
+			n, err := terminal.Read(buf)
+			output = append(output, buf[:n]...)
+			if err != nil {
+				break
+			}
+		}
+		result <- string(output)
+	}()
+
+	select {
+	case output := <-result:
+		return output
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Read() timed out waiting for %q", want)
+		return ""
+	}
+}
+
+func TestTTY(t *testing.T) {
+	job := newJob("/bin/sh", []string{"-c", "test -t 0 && test -t 1 && echo on a tty"}, WithTTY())
+	job.run()
+
+	terminal := &Terminal{job: job, detached: make(chan struct{})}
+	output := readUntil(t, terminal, "on a tty")
+	if !strings.Contains(output, "on a tty") {
+		t.Errorf("Unexpected terminal output: %q", output)
+	}
+
+	// the terminal reaches EOF once the job exited
+	if _, err := io.ReadAll(terminal); err != nil {
+		t.Errorf("ReadAll() error: %s", err.Error())
+	}
+
+	status := job.getStatus()
+	if status.State != Completed || *status.ExitCode != 0 {
+		t.Errorf("getStatus() expected completed with exit code 0, got %v", status.State)
+	}
+}
+
+func TestTTYBackgroundProcess(t *testing.T) {
+	// the background process ignores the hangup, and keeps the terminal open after the job exited
+	job := newJob("/bin/sh", []string{"-c", "trap '' HUP; /bin/sleep 3 & echo started"}, WithTTY())
+	job.outputDrainTimeout = 100 * time.Millisecond
+	job.run()
+
+	select {
+	case <-job.done:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("job not done while a background process keeps its terminal open")
+	}
+
+	status := job.getStatus()
+	if status.State != Completed || *status.ExitCode != 0 {
+		t.Errorf("getStatus() expected completed with exit code 0, got %v", status.State)
+	}
+	if stdout, _ := job.getOutput(); !strings.Contains(stdout, "started") {
+		t.Errorf("Unexpected terminal output: %q", stdout)
+	}
+}
+
+func TestAttachDetach(t *testing.T) {
+	job := newJob("/bin/cat", nil, WithTTY())
+	job.run()
+	defer job.stop()
+
+	terminal, err := job.attach()
+	if err != nil {
+		t.Fatalf("attach() error: %s", err.Error())
+	}
+
+	if err := terminal.Resize(40, 120); err != nil {
+		t.Errorf("Resize() error: %s", err.Error())
+	}
+
+	if _, err := terminal.Write([]byte("ping\n")); err != nil {
+		t.Errorf("Write() error: %s", err.Error())
+	}
+	readUntil(t, terminal, "ping")
+
+	// detaching ends the attachment, but leaves the job running
+	terminal.Close()
+	if _, err := terminal.Read(make([]byte, 1)); !errors.Is(err, ErrDetached) {
+		t.Errorf("Read() expected error: %s, got: %v", ErrDetached, err)
+	}
+
+	if status := job.getStatus(); status.State != Running {
+		t.Errorf("getStatus() expected running after detach, got %v", status.State)
+	}
+}
+
+func TestAttachNoTerminal(t *testing.T) {
+	job := newJob(longCmd[0], longCmd[1:])
+	job.run()
+	defer job.stop()
+
+	_, err := job.attach()
+	if !errors.Is(err, ErrNoTerminal) {
+		t.Errorf("attach() expected error: %s, got: %v", ErrNoTerminal, err)
+	}
+}
@@ -0,0 +1,233 @@
+package jobserver
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"teleport-jobworker/pkg/job"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// An attach session is a WebSocket carrying binary messages for terminal data in both directions,
+// and JSON text messages (TerminalMessage) for control: resize and detach from the client,
+// and the job's final status from the server once the job exits.
+
+// Terminal control message types
+const (
+	messageResize = "resize"
+	messageDetach = "detach"
+	messageExit   = "exit"
+)
+
+// TerminalMessage defines a control message of an attach session.
+type TerminalMessage struct {
+	Type     string `json:"type"`
+	Rows     uint16 `json:"rows,omitempty"`
+	Cols     uint16 `json:"cols,omitempty"`
+	Status   string `json:"status,omitempty"`
+	ExitCode *int   `json:"exitCode,omitempty"`
+}
+
+// closeGracePeriod bounds how long the server waits for the client to acknowledge
+// the end of a session, once the job exited.
+const closeGracePeriod = 5 * time.Second
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+}
+
+// attachHandler handles HTTPS requests to GET /v1/jobs/{id}/attach, upgraded to a WebSocket.
+func (s *Server) attachHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	terminal, err := s.manager.Attach(r.Context(), id)
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+	defer terminal.Close()
+
+	// Upgrade replies with an HTTP error on failure
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	// forward terminal output until the job exits or the client detaches
+	outputDone := make(chan struct{})
+	go func() {
+		defer close(outputDone)
+		s.pumpTerminalOutput(r, conn, id, terminal)
+	}()
+
+	for {
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			break
+		}
+
+		if messageType == websocket.BinaryMessage {
+			if _, err := terminal.Write(data); err != nil {
+				break
+			}
+			continue
+		}
+
+		var message TerminalMessage
+		if err := json.Unmarshal(data, &message); err != nil {
+			continue
+		}
+		if message.Type == messageDetach {
+			break
+		}
+		if message.Type == messageResize {
+			if err := terminal.Resize(message.Rows, message.Cols); err != nil {
+				log.Printf("Terminal.Resize() failed to resize terminal: %v", err)
+			}
+		}
+	}
+
+	terminal.Close()
+	<-outputDone
+}
+
+// pumpTerminalOutput writes terminal output to the WebSocket, followed by the job's
+// final status if the job exited, then closes the session.
+func (s *Server) pumpTerminalOutput(r *http.Request, conn *websocket.Conn, id string, terminal *job.Terminal) {
+	buf := make([]byte, 4096)
+	for {
+		n, err := terminal.Read(buf)
+		if n > 0 {
+			if err := conn.WriteMessage(websocket.BinaryMessage, buf[:n]); err != nil {
+				return
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			conn.WriteMessage(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, "detached"))
+			return
+		}
+	}
+
+	status, err := s.manager.GetStatus(r.Context(), id)
+	if err == nil {
+		conn.WriteJSON(TerminalMessage{Type: messageExit, Status: status.State, ExitCode: status.ExitCode})
+	}
+	conn.WriteMessage(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, "job exited"))
+	conn.SetReadDeadline(time.Now().Add(closeGracePeriod))
+}
+
+// Attachment is a client session attached to a job's terminal.
+// Reads return terminal output, writes are sent as terminal input.
+type Attachment struct {
+	conn       *websocket.Conn
+	writeMutex sync.Mutex
+
+	pending []byte
+	exit    *TerminalMessage
+}
+
+// AttachJob opens an attach session with the /jobs/{id}/attach endpoint.
+func (c *Client) AttachJob(jobID string) (*Attachment, error) {
+	dialer := websocket.Dialer{}
+	if transport, ok := c.client.Transport.(*http.Transport); ok {
+		dialer.TLSClientConfig = transport.TLSClientConfig
+	}
+
+	header := http.Header{}
+	c.authorize(header)
+
+	url := "wss" + strings.TrimPrefix(c.url, "https") + APIPrefix + "/jobs/" + jobID + "/attach"
+	conn, response, err := dialer.Dial(url, header)
+	if err != nil {
+		// surface the API error, if the server refused the upgrade
+		if response != nil && response.Body != nil {
+			defer response.Body.Close()
+			return nil, responseErr(response)
+		}
+		return nil, err
+	}
+
+	return &Attachment{conn: conn}, nil
+}
+
+// Read returns terminal output. It returns io.EOF once the session ended,
+// after which ExitStatus reports the job's final status, if it exited.
+func (a *Attachment) Read(p []byte) (int, error) {
+	for len(a.pending) == 0 {
+		messageType, data, err := a.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+				return 0, io.EOF
+			}
+			return 0, err
+		}
+
+		if messageType == websocket.BinaryMessage {
+			a.pending = data
+			continue
+		}
+
+		var message TerminalMessage
+		if err := json.Unmarshal(data, &message); err == nil && message.Type == messageExit {
+			a.exit = &message
+		}
+	}
+
+	n := copy(p, a.pending)
+	a.pending = a.pending[n:]
+	return n, nil
+}
+
+// Write sends p as terminal input.
+func (a *Attachment) Write(p []byte) (int, error) {
+	a.writeMutex.Lock()
+	defer a.writeMutex.Unlock()
+
+	if err := a.conn.WriteMessage(websocket.BinaryMessage, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Resize sets the window size of the job's terminal.
+func (a *Attachment) Resize(rows, cols uint16) error {
+	return a.writeControl(TerminalMessage{Type: messageResize, Rows: rows, Cols: cols})
+}
+
+// Detach ends the session, leaving the job running. Read returns io.EOF once the server acknowledged.
+func (a *Attachment) Detach() error {
+	return a.writeControl(TerminalMessage{Type: messageDetach})
+}
+
+// ExitStatus returns the job's final status, once the job exited during the session.
+func (a *Attachment) ExitStatus() (status string, exitCode *int, ok bool) {
+	if a.exit == nil {
+		return "", nil, false
+	}
+	return a.exit.Status, a.exit.ExitCode, true
+}
+
+// Close closes the underlying connection.
+func (a *Attachment) Close() error {
+	return a.conn.Close()
+}
+
+func (a *Attachment) writeControl(message TerminalMessage) error {
+	a.writeMutex.Lock()
+	defer a.writeMutex.Unlock()
+
+	return a.conn.WriteJSON(message)
+}
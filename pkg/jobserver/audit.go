@@ -0,0 +1,152 @@
+package jobserver
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"teleport-jobworker/pkg/audit"
+	"teleport-jobworker/pkg/job"
+	"teleport-jobworker/pkg/metrics"
+	"time"
+)
+
+// Audited actions
+const (
+	actionStart      = "start"
+	actionStop       = "stop"
+	actionSignal     = "signal"
+	actionWriteStdin = "stdin.write"
+	actionCloseStdin = "stdin.close"
+	actionAttach     = "attach"
+	actionList       = "list"
+	actionStatus     = "status"
+	actionWait       = "wait"
+	actionOutput     = "output"
+	actionLogs       = "logs"
+	actionAuditQuery = "audit.query"
+)
+
+// AuditResponse defines the GET /audit response body.
+type AuditResponse struct {
+	Records []audit.Record `json:"records"`
+}
+
+// Context includes the audit record of the request, completed by handlers.
+type auditContextKey struct{}
+
+// audited records every request to next in the audit log, if enabled, after next returned.
+// next is expected to authenticate the request, eg. with bearerAuth.
+func (s *Server) audited(action string, next http.HandlerFunc) http.HandlerFunc {
+	if s.auditLog == nil {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		record := &audit.Record{
+			Time:     time.Now(),
+			Action:   action,
+			JobID:    r.PathValue("id"),
+			SourceIP: sourceIP(r),
+		}
+		recorder := metrics.NewStatusRecorder(w)
+
+		ctx := context.WithValue(r.Context(), auditContextKey{}, record)
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		s.appendAudit(record, recorder.Code)
+	}
+}
+
+// appendAudit completes the record with the status code of the action and its result,
+// then appends it to the audit log.
+func (s *Server) appendAudit(record *audit.Record, code int) {
+	record.Code = code
+	switch {
+	case code < http.StatusBadRequest:
+		record.Result = audit.ResultSuccess
+	case code == http.StatusUnauthorized || code == http.StatusForbidden ||
+		code == http.StatusNotFound && record.JobID != "":
+		// jobs of other users are reported as not found
+		record.Result = audit.ResultDenied
+	default:
+		record.Result = audit.ResultError
+	}
+
+	if err := s.auditLog.Append(*record); err != nil {
+		log.Printf("audit.Log.Append() failed to record %s by %q: %v", record.Action, record.User, err)
+	}
+}
+
+// auditRecord returns the audit record of the request, for handlers to complete.
+// Returns a discarded record when auditing is disabled.
+func auditRecord(ctx context.Context) *audit.Record {
+	if record, ok := ctx.Value(auditContextKey{}).(*audit.Record); ok {
+		return record
+	}
+	return &audit.Record{}
+}
+
+// auditCommands records the program and arguments of a started job.
+// Pipelines are recorded like jobctl arguments, with "|" separating commands.
+func auditCommands(record *audit.Record, commands []job.Command) {
+	record.Program, record.Args = commands[0].Program, slices.Clone(commands[0].Args)
+	for _, command := range commands[1:] {
+		record.Args = append(append(record.Args, "|", command.Program), command.Args...)
+	}
+}
+
+// sourceIP returns the IP address of the client that sent the request.
+func sourceIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// getAuditHandler handles HTTPS requests to
+// GET /v1/audit?user=<id>&action=<action>&job=<id>&since=<ts>&until=<ts>&limit=<n>
+func (s *Server) getAuditHandler(w http.ResponseWriter, r *http.Request) {
+	if err := s.manager.Authorize(r.Context(), job.VerbAdmin, job.Resource{}); err != nil {
+		responseError(w, err)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := audit.Filter{
+		User:   query.Get("user"),
+		Action: query.Get("action"),
+		JobID:  query.Get("job"),
+	}
+
+	for name, t := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if value := query.Get(name); value != "" {
+			var err error
+			*t, err = time.Parse(time.RFC3339Nano, value)
+			if err != nil {
+				responseError(w, invalidParameter(name, "invalid %s timestamp %q, expected RFC 3339", name, value))
+				return
+			}
+		}
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			responseError(w, invalidParameter("limit", "invalid limit %q", value))
+			return
+		}
+		filter.Limit = limit
+	}
+
+	records, err := s.auditLog.Query(filter)
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+
+	responseJSON(w, AuditResponse{Records: records}, http.StatusOK)
+}
@@ -1,20 +1,18 @@
 package jobserver
 
 import (
+	"crypto/tls"
+	"errors"
 	"net/http"
 	"strings"
 	"teleport-jobworker/pkg/job"
+	"teleport-jobworker/pkg/token"
 )
 
 var ErrBadAuthentication = "unauthorized action"
 
-// For the prototype, the server will contain a static store of valid Bearer tokens.
-// In the future, tokens will be auto-generated (eg. JWT), and stored securely.
-var validTokens = map[string]tokenClaims{
-	"user1_token":  {"user1", job.User},
-	"user2_token":  {"user2", job.User},
-	"admin1_token": {"admin1", job.Admin},
-}
+// DefaultAudience is the audience of the access tokens accepted by the job Server.
+const DefaultAudience = "jobworker"
 
 // tokenClaims contains user information to be used in job library calls.
 type tokenClaims struct {
@@ -22,26 +20,89 @@ type tokenClaims struct {
 	role   string
 }
 
-// bearerAuth inspects the Authorization: Bearer header and manages authentication.
-func bearerAuth(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		authHeader := r.Header.Get("Authorization")
+// Authentication failure reasons, reported in metrics
+const (
+	authMissingToken = "missing_token"
+	authInvalidToken = "invalid_token"
+	authExpiredToken = "expired_token"
+	authRevokedToken = "revoked_token"
+)
 
-		authHeaderFields := strings.Fields(authHeader)
-		if len(authHeaderFields) != 2 || !strings.EqualFold(authHeaderFields[0], "Bearer") {
-			responseJSON(w, ErrorResponse{ErrBadAuthentication}, http.StatusUnauthorized)
+// bearerAuth inspects the Authorization: Bearer header, or the client certificate
+// in mutual TLS mode, and manages authentication.
+func (s *Server) bearerAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, reason := s.authenticateRequest(r.TLS, r.Header.Get("Authorization"))
+		if reason != "" {
+			s.authFailure(reason)
+			responseError(w, unauthenticated())
 			return
 		}
 
-		token := authHeaderFields[1]
-		claims, ok := validTokens[token]
-		if !ok {
-			responseJSON(w, ErrorResponse{ErrBadAuthentication}, http.StatusUnauthorized)
-			return
-		}
+		record := auditRecord(r.Context())
+		record.User, record.Role = claims.userId, claims.role
 
 		// store token (as userID) and role in context for use in Manager library calls
 		ctx := job.WithUserInfo(r.Context(), claims.userId, claims.role)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	}
 }
+
+// authenticateRequest authenticates a request by its client certificate in mutual TLS mode,
+// or by its authorization value otherwise. Returns the failure reason if authentication failed.
+func (s *Server) authenticateRequest(state *tls.ConnectionState, authorization string) (tokenClaims, string) {
+	if s.mutualTLS != nil {
+		return s.mutualTLS.certificateClaims(state)
+	}
+	return s.authenticate(authorization)
+}
+
+// authenticate verifies a "Bearer <token>" authorization value, shared by the HTTPS and gRPC APIs.
+// Returns the failure reason if the token is missing, invalid, expired or revoked.
+func (s *Server) authenticate(authorization string) (tokenClaims, string) {
+	accessToken, ok := bearerToken(authorization)
+	if !ok {
+		return tokenClaims{}, authMissingToken
+	}
+	if s.verifier == nil {
+		return tokenClaims{}, authInvalidToken
+	}
+
+	claims, err := s.verifier.Verify(accessToken)
+	if err != nil {
+		return tokenClaims{}, tokenFailureReason(err)
+	}
+
+	// roles are the groups of users, granted permissions by the job Authorizer
+	if claims.Subject == "" || claims.Role == "" {
+		return tokenClaims{}, authInvalidToken
+	}
+	return tokenClaims{userId: claims.Subject, role: claims.Role}, ""
+}
+
+// bearerToken returns the token of a "Bearer <token>" authorization value.
+func bearerToken(authorization string) (string, bool) {
+	fields := strings.Fields(authorization)
+	if len(fields) != 2 || !strings.EqualFold(fields[0], "Bearer") {
+		return "", false
+	}
+	return fields[1], true
+}
+
+// tokenFailureReason maps a token verification error to an authentication failure reason.
+func tokenFailureReason(err error) string {
+	switch {
+	case errors.Is(err, token.ErrExpired) || errors.Is(err, token.ErrNotYetValid):
+		return authExpiredToken
+	case errors.Is(err, token.ErrRevoked):
+		return authRevokedToken
+	}
+	return authInvalidToken
+}
+
+// authFailure reports a failed authentication to metrics, if enabled.
+func (s *Server) authFailure(reason string) {
+	if s.metrics != nil {
+		s.metrics.AuthFailure(reason)
+	}
+}
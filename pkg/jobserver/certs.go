@@ -1,20 +1,121 @@
 package jobserver
 
 import (
+	"context"
 	"crypto/tls"
-	_ "embed"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"teleport-jobworker/internal/fileutil"
+	"time"
 )
 
-// The self-signed TLS certificate will be embedded into the binary.
-// In the future, the job Server will use certificate issued by a Trusted CA.
+// CertificateCheckInterval is how often Watch checks whether the certificate files changed.
+const CertificateCheckInterval = 10 * time.Second
 
-//go:embed certs/cert.pem
-var cert []byte
+// CertificateReloader serves the TLS certificate of a certificate file and key file, with
+// tls.Config.GetCertificate. The files are reloaded when Watch sees them change, or on Reload,
+// and the previous certificate is kept serving if the new key pair is invalid.
+type CertificateReloader struct {
+	// mutex serializes reloads; the current certificate is read without it
+	mutex    sync.Mutex
+	certFile fileutil.Watched
+	keyFile  fileutil.Watched
+	current  atomic.Pointer[tls.Certificate]
+}
+
+// NewCertificateReloader loads the PEM certificate chain of certFile and the private key of keyFile.
+func NewCertificateReloader(certFile, keyFile string) (*CertificateReloader, error) {
+	r := &CertificateReloader{certFile: fileutil.Watched{Path: certFile}, keyFile: fileutil.Watched{Path: keyFile}}
+	r.certFile.Changed()
+	r.keyFile.Changed()
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload loads the certificate files, and serves the new certificate if its key pair is valid.
+// Returns an error and keeps serving the previous certificate otherwise.
+func (r *CertificateReloader) Reload() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.reload()
+}
+
+// reload loads the certificate files. Caller must hold mutex.
+func (r *CertificateReloader) reload() error {
+	loaded, err := tls.LoadX509KeyPair(r.certFile.Path, r.keyFile.Path)
+	if err != nil {
+		return fmt.Errorf("TLS certificate %s: %w", r.certFile.Path, err)
+	}
+	if err := validateCertificate(loaded); err != nil {
+		return fmt.Errorf("TLS certificate %s: %w", r.certFile.Path, err)
+	}
+
+	r.current.Store(&loaded)
+	return nil
+}
+
+// validateCertificate checks that the leaf certificate is currently valid.
+func validateCertificate(certificate tls.Certificate) error {
+	if certificate.Leaf == nil {
+		return errors.New("no certificate found")
+	}
 
-//go:embed certs/key.pem
-var key []byte
+	now := time.Now()
+	if now.Before(certificate.Leaf.NotBefore) {
+		return fmt.Errorf("certificate is not valid before %s", certificate.Leaf.NotBefore.Format(time.RFC3339))
+	}
+	if now.After(certificate.Leaf.NotAfter) {
+		return fmt.Errorf("certificate expired at %s", certificate.Leaf.NotAfter.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// Watch reloads the certificate files when they change, checking them every interval, until ctx is done.
+func (r *CertificateReloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.reloadChanged()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// reloadChanged reloads the certificate files if they changed since the last check.
+func (r *CertificateReloader) reloadChanged() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// both files are checked, to track their state even when only one of them changed
+	certChanged, keyChanged := r.certFile.Changed(), r.keyFile.Changed()
+	if !certChanged && !keyChanged {
+		return
+	}
+	if err := r.reload(); err != nil {
+		// the other file of the pair may not be written yet: it is retried once it changes
+		log.Printf("failed to reload TLS certificate, serving the previous one: %v", err)
+		return
+	}
+	log.Printf("reloaded TLS certificate %s, valid until %s",
+		r.certFile.Path, r.current.Load().Leaf.NotAfter.Format(time.RFC3339))
+}
+
+// GetCertificate implements tls.Config.GetCertificate.
+func (r *CertificateReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.current.Load(), nil
+}
 
-// LoadTLSCertificate loads the self-signed TLS certificate for the job Server.
-func LoadTLSCertificate() (tls.Certificate, error) {
-	return tls.X509KeyPair(cert, key)
+// NotAfter returns the expiry time of the current certificate.
+func (r *CertificateReloader) NotAfter() time.Time {
+	return r.current.Load().Leaf.NotAfter
 }
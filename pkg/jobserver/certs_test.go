@@ -0,0 +1,179 @@
+package jobserver
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"log"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"teleport-jobworker/pkg/job"
+	"teleport-jobworker/pkg/pki"
+	"testing"
+	"time"
+)
+
+// writeKeyPair writes cert and its private key as PEM files, replacing them atomically like certificate managers do.
+func writeKeyPair(t *testing.T, certFile, keyFile string, cert tls.Certificate) {
+	t.Helper()
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		t.Fatalf("MarshalPKCS8PrivateKey() error: %s", err.Error())
+	}
+	for path, block := range map[string]*pem.Block{
+		certFile: {Type: "CERTIFICATE", Bytes: cert.Certificate[0]},
+		keyFile:  {Type: "PRIVATE KEY", Bytes: keyDER},
+	} {
+		if err := os.WriteFile(path+".tmp", pem.EncodeToMemory(block), 0o600); err != nil {
+			t.Fatalf("WriteFile() error: %s", err.Error())
+		}
+		if err := os.Rename(path+".tmp", path); err != nil {
+			t.Fatalf("Rename() error: %s", err.Error())
+		}
+	}
+}
+
+func TestCertificateReloader(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+
+	first := ca.issue(t, 1, "server", "", time.Now().Add(time.Hour).Truncate(time.Second))
+	writeKeyPair(t, certFile, keyFile, first)
+	reloader, err := NewCertificateReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("NewCertificateReloader() error: %s", err.Error())
+	}
+	if got, _ := reloader.GetCertificate(nil); string(got.Certificate[0]) != string(first.Certificate[0]) {
+		t.Errorf("GetCertificate() expected the first certificate")
+	}
+
+	// replaced files are served once Watch sees them change
+	ctx, cancel := context.WithCancel(context.Background())
+	watching := make(chan struct{})
+	go func() {
+		defer close(watching)
+		reloader.Watch(ctx, 10*time.Millisecond)
+	}()
+	second := ca.issue(t, 2, "server", "", time.Now().Add(2*time.Hour).Truncate(time.Second))
+	writeKeyPair(t, certFile, keyFile, second)
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if got, _ := reloader.GetCertificate(nil); string(got.Certificate[0]) == string(second.Certificate[0]) {
+			break
+		}
+	}
+	cancel()
+	<-watching
+	if got, _ := reloader.GetCertificate(nil); string(got.Certificate[0]) != string(second.Certificate[0]) {
+		t.Errorf("GetCertificate() expected the replaced certificate")
+	}
+	if got, want := reloader.NotAfter(), time.Now().Add(2*time.Hour).Truncate(time.Second); got.Sub(want).Abs() > time.Second {
+		t.Errorf("NotAfter() = %s, expected %s", got, want)
+	}
+
+	// a certificate not matching the key is rejected, and the previous one kept
+	third := ca.issue(t, 3, "server", "", time.Now().Add(3*time.Hour))
+	keyDER, _ := x509.MarshalPKCS8PrivateKey(third.PrivateKey)
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatalf("WriteFile() error: %s", err.Error())
+	}
+	reloader.reloadChanged()
+	if got, _ := reloader.GetCertificate(nil); string(got.Certificate[0]) != string(second.Certificate[0]) {
+		t.Errorf("GetCertificate() expected the previous certificate with a mismatched key")
+	}
+	if err := reloader.Reload(); err == nil {
+		t.Errorf("Reload() expected error with a mismatched key")
+	}
+
+	// an expired certificate is rejected, and the previous one kept
+	expired := ca.issue(t, 4, "server", "", time.Now().Add(-time.Hour))
+	writeKeyPair(t, certFile, keyFile, expired)
+	if err := reloader.Reload(); err == nil {
+		t.Errorf("Reload() expected error with an expired certificate")
+	}
+	if got, _ := reloader.GetCertificate(nil); string(got.Certificate[0]) != string(second.Certificate[0]) {
+		t.Errorf("GetCertificate() expected the previous certificate with an expired one")
+	}
+
+	// removed files keep the previous certificate
+	os.Remove(certFile)
+	reloader.reloadChanged()
+	if got, _ := reloader.GetCertificate(nil); string(got.Certificate[0]) != string(second.Certificate[0]) {
+		t.Errorf("GetCertificate() expected the previous certificate with a removed file")
+	}
+}
+
+func TestCertificateReloaderInvalid(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+
+	if _, err := NewCertificateReloader(certFile, keyFile); err == nil {
+		t.Errorf("NewCertificateReloader() expected error with missing files")
+	}
+
+	expired := newTestCA(t).issue(t, 1, "server", "", time.Now().Add(-time.Hour))
+	writeKeyPair(t, certFile, keyFile, expired)
+	if _, err := NewCertificateReloader(certFile, keyFile); err == nil {
+		t.Errorf("NewCertificateReloader() expected error with an expired certificate")
+	}
+}
+
+func TestClientCAFile(t *testing.T) {
+	dir := t.TempDir()
+	caFile, certFile, keyFile := filepath.Join(dir, "ca.pem"), filepath.Join(dir, "server.pem"), filepath.Join(dir, "server-key.pem")
+
+	ca, err := pki.NewCA("test CA", pki.KeyECDSA, time.Hour)
+	if err != nil {
+		t.Fatalf("NewCA() error: %s", err.Error())
+	}
+	if err := ca.Save(caFile, filepath.Join(dir, "ca-key.pem")); err != nil {
+		t.Fatalf("Save() error: %s", err.Error())
+	}
+	server, err := ca.IssueServer([]string{"127.0.0.1"}, pki.KeyEd25519, time.Minute)
+	if err != nil {
+		t.Fatalf("IssueServer() error: %s", err.Error())
+	}
+	if err := server.Save(certFile, keyFile); err != nil {
+		t.Fatalf("Save() error: %s", err.Error())
+	}
+	reloader, err := NewCertificateReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("NewCertificateReloader() error: %s", err.Error())
+	}
+
+	// httptest.Server.StartTLS would serve its own certificate to clients without SNI, such as IP addresses
+	ts := httptest.NewUnstartedServer(NewServer(job.NewManager(), withTestTokens()))
+	ts.Listener = tls.NewListener(ts.Listener, &tls.Config{MinVersion: tls.VersionTLS13, GetCertificate: reloader.GetCertificate})
+	ts.Config.ErrorLog = log.New(io.Discard, "", 0)
+	ts.Start()
+	t.Cleanup(ts.Close)
+	url := "https://" + ts.Listener.Addr().String()
+
+	// the server certificate is trusted by the CA file
+	client, err := NewClient(WithCAFile(caFile), WithToken(user1token))
+	if err != nil {
+		t.Fatalf("NewClient() error: %s", err.Error())
+	}
+	client.url = url
+	if _, err := client.StartJob("/bin/true", nil); err != nil {
+		t.Errorf("StartJob() error with the CA file: %s", err.Error())
+	}
+
+	// and not by the system CAs
+	client, err = NewClient(WithToken(user1token))
+	if err != nil {
+		t.Fatalf("NewClient() error: %s", err.Error())
+	}
+	client.url = url
+	if _, err := client.StartJob("/bin/true", nil); err == nil {
+		t.Errorf("StartJob() expected error without the CA file")
+	}
+
+	if _, err := NewClient(WithCAFile(keyFile)); err == nil {
+		t.Errorf("NewClient() expected error with a CA file without certificates")
+	}
+}
@@ -2,61 +2,155 @@ package jobserver
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
 )
 
 const DefaultBaseURL = "https://localhost:8443"
 
+// Attempts of start requests, which are made safe to retry by an idempotency key.
+const (
+	startAttempts     = 3
+	startRetryBackoff = 200 * time.Millisecond
+)
+
 // Client sends job management requests to the HTTPS API server.
 type Client struct {
 	client *http.Client
 	url    string
+	token  string
+}
+
+// ClientOption configures optional behaviour of the job Clients.
+type ClientOption func(*clientOptions)
+
+type clientOptions struct {
+	caFile   string
+	certFile string
+	keyFile  string
+	token    string
+}
+
+// WithToken authenticates requests with an access token issued by the server,
+// sent as an Authorization: Bearer header.
+func WithToken(token string) ClientOption {
+	return func(o *clientOptions) {
+		o.token = token
+	}
+}
+
+// WithCAFile trusts the server certificates signed by the PEM CA certificates of caFile,
+// such as the local CA created by jobserver ca init, instead of the system CAs.
+func WithCAFile(caFile string) ClientOption {
+	return func(o *clientOptions) {
+		o.caFile = caFile
+	}
+}
+
+// WithClientCertificate presents the PEM certificate and key from files to the server,
+// for servers authenticating users by client certificates (mutual TLS).
+func WithClientCertificate(certFile, keyFile string) ClientOption {
+	return func(o *clientOptions) {
+		o.certFile = certFile
+		o.keyFile = keyFile
+	}
+}
+
+// clientTLSConfig creates the TLS config shared by the HTTPS and gRPC Clients.
+func clientTLSConfig(options clientOptions) (*tls.Config, error) {
+	config := &tls.Config{}
+	if options.caFile != "" {
+		caPEM, err := os.ReadFile(options.caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load CA: %w", err)
+		}
+		certPool := x509.NewCertPool()
+		if ok := certPool.AppendCertsFromPEM(caPEM); !ok {
+			return nil, fmt.Errorf("failed to load CA: no PEM certificate found in %s", options.caFile)
+		}
+		config.RootCAs = certPool
+	}
+
+	if options.certFile != "" || options.keyFile != "" {
+		clientCert, err := tls.LoadX509KeyPair(options.certFile, options.keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{clientCert}
+	}
+
+	return config, nil
+}
+
+func newClientOptions(opts []ClientOption) clientOptions {
+	var options clientOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
 }
 
 // NewClient configures an HTTP Client for communication with the job Server.
-func NewClient() (*Client, error) {
-	// configure job Client to trust self-signed TLS certificate
-	certPool := x509.NewCertPool()
-	if ok := certPool.AppendCertsFromPEM(cert); !ok {
-		return nil, fmt.Errorf("failed to append cert to CertPool")
+func NewClient(opts ...ClientOption) (*Client, error) {
+	options := newClientOptions(opts)
+	tlsConfig, err := clientTLSConfig(options)
+	if err != nil {
+		return nil, err
 	}
 
 	client := &http.Client{
 		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{
-				RootCAs: certPool,
-			},
+			TLSClientConfig: tlsConfig,
 		}}
 
-	return &Client{client, DefaultBaseURL}, nil
+	return &Client{client: client, url: DefaultBaseURL, token: options.token}, nil
 }
 
-// userToToken simply appends a "_token" string to a userID to generate a Bearer token.
-// In the future, tokens will be auto-generated (eg. JWT) according to user info.
-func userToToken(user string) string {
-	return user + "_token"
+// Close closes idle connections to the server.
+func (c *Client) Close() error {
+	c.client.CloseIdleConnections()
+	return nil
 }
 
-// StartJob creates an HTTP request and parses response for the /jobs/start endpoint.
-func (c *Client) StartJob(user, program string, args []string) (*StartResponse, error) {
-	var requestBuf bytes.Buffer
-	requestBody := StartRequest{
-		Program: program,
-		Args:    args,
+// authorize sets the access token of the Client on request, if any.
+func (c *Client) authorize(header http.Header) {
+	if c.token != "" {
+		header.Set("Authorization", "Bearer "+c.token)
 	}
-	if err := json.NewEncoder(&requestBuf).Encode(requestBody); err != nil {
+}
+
+// Login creates an HTTP request and parses response for the /auth/login endpoint.
+func (c *Client) Login(user, password string) (*TokenResponse, error) {
+	return c.postTokens(APIPrefix+"/auth/login", LoginRequest{User: user, Password: password})
+}
+
+// RefreshToken creates an HTTP request and parses response for the /auth/refresh endpoint.
+// The refresh token is only valid once, and the response carries a new one.
+func (c *Client) RefreshToken(refreshToken string) (*TokenResponse, error) {
+	return c.postTokens(APIPrefix+"/auth/refresh", RefreshRequest{RefreshToken: refreshToken})
+}
+
+func (c *Client) postTokens(path string, requestBody any) (*TokenResponse, error) {
+	body, err := json.Marshal(requestBody)
+	if err != nil {
 		return nil, err
 	}
 
-	request, err := http.NewRequest("POST", c.url+"/jobs/start", &requestBuf)
+	request, err := http.NewRequest("POST", c.url+path, bytes.NewReader(body))
 	if err != nil {
 		return nil, err
 	}
-	request.Header.Set("Authorization", "Bearer "+userToToken(user))
 	request.Header.Set("Content-Type", "application/json")
 
 	response, err := c.client.Do(request)
@@ -65,21 +159,134 @@ func (c *Client) StartJob(user, program string, args []string) (*StartResponse,
 	}
 	defer response.Body.Close()
 
-	var startResponse StartResponse
-	err = json.NewDecoder(response.Body).Decode(&startResponse)
+	var tokenResponse TokenResponse
+	if err := decodeResponse(response, &tokenResponse); err != nil {
+		return nil, err
+	}
+	return &tokenResponse, nil
+}
+
+// Logout creates an HTTP request for the /auth/logout endpoint, revoking the refresh token,
+// and the access token of the Client, if any.
+func (c *Client) Logout(refreshToken string) error {
+	body, err := json.Marshal(RefreshRequest{RefreshToken: refreshToken})
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequest("POST", c.url+APIPrefix+"/auth/logout", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	c.authorize(request.Header)
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := c.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	return decodeResponse(response, nil)
+}
+
+// StartJob creates an HTTP request and parses response for the /jobs/start endpoint.
+func (c *Client) StartJob(program string, args []string) (*StartResponse, error) {
+	return c.StartJobRequest(StartRequest{
+		Program: program,
+		Args:    args,
+	})
+}
+
+// StartJobRequest is StartJob with every StartRequest option available, eg. an open stdin.
+// The request carries a generated idempotency key, so it is retried on network errors
+// and unavailable servers without risking to start the job twice.
+func (c *Client) StartJobRequest(requestBody StartRequest) (*StartResponse, error) {
+	body, err := json.Marshal(requestBody)
 	if err != nil {
 		return nil, err
 	}
+	idempotencyKey := uuid.NewString()
+
+	var response *http.Response
+	for attempt := 1; ; attempt++ {
+		request, err := http.NewRequest("POST", c.url+APIPrefix+"/jobs/start", bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		c.authorize(request.Header)
+		request.Header.Set("Content-Type", "application/json")
+		request.Header.Set(IdempotencyKeyHeader, idempotencyKey)
+
+		response, err = c.client.Do(request)
+		if err == nil && !retryableStatus(response.StatusCode) {
+			break
+		}
+		if attempt == startAttempts {
+			if err != nil {
+				return nil, err
+			}
+			break
+		}
+
+		if response != nil {
+			io.Copy(io.Discard, response.Body)
+			response.Body.Close()
+		}
+		time.Sleep(startRetryBackoff << (attempt - 1))
+	}
+	defer response.Body.Close()
+
+	var startResponse StartResponse
+	if err := decodeResponse(response, &startResponse); err != nil {
+		return nil, err
+	}
 	return &startResponse, nil
 }
 
+// decodeResponse decodes the JSON body of a successful response into v, unless v is nil.
+// Error responses are returned as an *Error.
+func decodeResponse(response *http.Response, v any) error {
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return responseErr(response)
+	}
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(response.Body).Decode(v)
+}
+
+// responseErr returns the *Error of an error response. Responses without an error body,
+// eg. from a proxy, are reported by their status.
+func responseErr(response *http.Response) error {
+	var errorResponse ErrorResponse
+	apiErr := &errorResponse.Error
+	if err := json.NewDecoder(response.Body).Decode(&errorResponse); err != nil || apiErr.Code == "" {
+		apiErr.Code = CodeInternal
+		if retryableStatus(response.StatusCode) {
+			apiErr.Code = CodeUnavailable
+		}
+		apiErr.Message = "unexpected response " + response.Status
+	}
+	if apiErr.RequestID == "" {
+		apiErr.RequestID = response.Header.Get(RequestIDHeader)
+	}
+	apiErr.Status = response.StatusCode
+	return apiErr
+}
+
+// retryableStatus reports whether a response status means the request may succeed if retried.
+func retryableStatus(code int) bool {
+	return code == http.StatusBadGateway || code == http.StatusServiceUnavailable || code == http.StatusGatewayTimeout
+}
+
 // StopJob creates an HTTP request and parses response for the /jobs/{id}/stop endpoint.
-func (c *Client) StopJob(user, jobID string) (*StopResponse, error) {
-	request, err := http.NewRequest("POST", c.url+"/jobs/"+jobID+"/stop", nil)
+func (c *Client) StopJob(jobID string) (*StopResponse, error) {
+	request, err := http.NewRequest("POST", c.url+APIPrefix+"/jobs/"+jobID+"/stop", nil)
 	if err != nil {
 		return nil, err
 	}
-	request.Header.Set("Authorization", "Bearer "+userToToken(user))
+	c.authorize(request.Header)
 	request.Header.Set("Content-Type", "application/json")
 
 	response, err := c.client.Do(request)
@@ -89,20 +296,118 @@ func (c *Client) StopJob(user, jobID string) (*StopResponse, error) {
 	defer response.Body.Close()
 
 	var stopResponse StopResponse
-	err = json.NewDecoder(response.Body).Decode(&stopResponse)
-	if err != nil {
+	if err := decodeResponse(response, &stopResponse); err != nil {
 		return nil, err
 	}
 	return &stopResponse, nil
 }
 
+// SignalJob creates an HTTP request and parses response for the /jobs/{id}/signal endpoint.
+func (c *Client) SignalJob(jobID, signal string) (*SignalResponse, error) {
+	body, err := json.Marshal(SignalRequest{Signal: signal})
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := http.NewRequest("POST", c.url+APIPrefix+"/jobs/"+jobID+"/signal", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	c.authorize(request.Header)
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := c.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	var signalResponse SignalResponse
+	if err := decodeResponse(response, &signalResponse); err != nil {
+		return nil, err
+	}
+	return &signalResponse, nil
+}
+
+// GrantJob creates an HTTP request and parses response for the /jobs/{id}/grants endpoint.
+func (c *Client) GrantJob(jobID string, grant GrantRequest) (*GrantResponse, error) {
+	body, err := json.Marshal(grant)
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := http.NewRequest("POST", c.url+APIPrefix+"/jobs/"+jobID+"/grants", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	c.authorize(request.Header)
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := c.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	var grantResponse GrantResponse
+	if err := decodeResponse(response, &grantResponse); err != nil {
+		return nil, err
+	}
+	return &grantResponse, nil
+}
+
+// WriteJobStdin creates a streaming HTTP request for the /jobs/{id}/stdin endpoint.
+// The contents of r are sent to the job's stdin as they are read, until r returns EOF.
+func (c *Client) WriteJobStdin(jobID string, r io.Reader) (*StdinResponse, error) {
+	request, err := http.NewRequest("POST", c.url+APIPrefix+"/jobs/"+jobID+"/stdin", r)
+	if err != nil {
+		return nil, err
+	}
+	c.authorize(request.Header)
+	request.Header.Set("Content-Type", "application/octet-stream")
+
+	response, err := c.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	var stdinResponse StdinResponse
+	if err := decodeResponse(response, &stdinResponse); err != nil {
+		return nil, err
+	}
+	return &stdinResponse, nil
+}
+
+// CloseJobStdin creates an HTTP request and parses response for the /jobs/{id}/stdin/close endpoint.
+func (c *Client) CloseJobStdin(jobID string) (*StdinResponse, error) {
+	request, err := http.NewRequest("POST", c.url+APIPrefix+"/jobs/"+jobID+"/stdin/close", nil)
+	if err != nil {
+		return nil, err
+	}
+	c.authorize(request.Header)
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := c.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	var stdinResponse StdinResponse
+	if err := decodeResponse(response, &stdinResponse); err != nil {
+		return nil, err
+	}
+	return &stdinResponse, nil
+}
+
 // GetJobStatus creates an HTTP request and parses response for the /jobs/{id} endpoint.
-func (c *Client) GetJobStatus(user, jobID string) (*StatusResponse, error) {
-	request, err := http.NewRequest("GET", c.url+"/jobs/"+jobID, nil)
+func (c *Client) GetJobStatus(jobID string) (*StatusResponse, error) {
+	request, err := http.NewRequest("GET", c.url+APIPrefix+"/jobs/"+jobID, nil)
 	if err != nil {
 		return nil, err
 	}
-	request.Header.Set("Authorization", "Bearer "+userToToken(user))
+	c.authorize(request.Header)
 	request.Header.Set("Content-Type", "application/json")
 
 	response, err := c.client.Do(request)
@@ -112,20 +417,68 @@ func (c *Client) GetJobStatus(user, jobID string) (*StatusResponse, error) {
 	defer response.Body.Close()
 
 	var statusResponse StatusResponse
-	err = json.NewDecoder(response.Body).Decode(&statusResponse)
+	if err := decodeResponse(response, &statusResponse); err != nil {
+		return nil, err
+	}
+	return &statusResponse, nil
+}
+
+// WaitJob creates an HTTP request and parses response for the /jobs/{id}/wait endpoint, blocking until
+// the job reached a final state or the timeout passed. A zero timeout uses the server's default.
+func (c *Client) WaitJob(jobID string, timeout time.Duration) (*StatusResponse, error) {
+	path := c.url + APIPrefix + "/jobs/" + jobID + "/wait"
+	if timeout > 0 {
+		path += "?" + url.Values{"timeout": {timeout.String()}}.Encode()
+	}
+
+	request, err := http.NewRequest("GET", path, nil)
 	if err != nil {
 		return nil, err
 	}
+	c.authorize(request.Header)
+
+	response, err := c.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	var statusResponse StatusResponse
+	if err := decodeResponse(response, &statusResponse); err != nil {
+		return nil, err
+	}
 	return &statusResponse, nil
 }
 
+// ListJobs creates an HTTP request and parses response for the /jobs endpoint,
+// returning the jobs the user may list.
+func (c *Client) ListJobs() ([]JobListing, error) {
+	request, err := http.NewRequest("GET", c.url+APIPrefix+"/jobs", nil)
+	if err != nil {
+		return nil, err
+	}
+	c.authorize(request.Header)
+
+	response, err := c.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	var listResponse ListResponse
+	if err := decodeResponse(response, &listResponse); err != nil {
+		return nil, err
+	}
+	return listResponse.Jobs, nil
+}
+
 // GetJobOutput creates an HTTP request and parses response for the /jobs/{id}/output endpoint.
-func (c *Client) GetJobOutput(user, jobID string) (*OutputResponse, error) {
-	request, err := http.NewRequest("GET", c.url+"/jobs/"+jobID+"/output", nil)
+func (c *Client) GetJobOutput(jobID string) (*OutputResponse, error) {
+	request, err := http.NewRequest("GET", c.url+APIPrefix+"/jobs/"+jobID+"/output", nil)
 	if err != nil {
 		return nil, err
 	}
-	request.Header.Set("Authorization", "Bearer "+userToToken(user))
+	c.authorize(request.Header)
 	request.Header.Set("Content-Type", "application/json")
 
 	response, err := c.client.Do(request)
@@ -135,9 +488,90 @@ func (c *Client) GetJobOutput(user, jobID string) (*OutputResponse, error) {
 	defer response.Body.Close()
 
 	var outputResponse OutputResponse
-	err = json.NewDecoder(response.Body).Decode(&outputResponse)
-	if err != nil {
+	if err := decodeResponse(response, &outputResponse); err != nil {
 		return nil, err
 	}
 	return &outputResponse, nil
 }
+
+// GetJobLogs creates an HTTP request and parses the NDJSON response for the /jobs/{id}/logs endpoint.
+// Only records written at or after since are returned; a zero since returns every record.
+func (c *Client) GetJobLogs(jobID string, since time.Time) ([]LogRecord, error) {
+	records := []LogRecord{}
+	err := c.streamJobLogs(context.Background(), jobID, since, false, func(record LogRecord) error {
+		records = append(records, record)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// FollowJobLogs calls fn with the output records written at or after since, then with every
+// new record as it is written, until the job exited, ctx is done, or fn returns an error.
+func (c *Client) FollowJobLogs(ctx context.Context, jobID string, since time.Time, fn func(LogRecord) error) error {
+	return c.streamJobLogs(ctx, jobID, since, true, fn)
+}
+
+func (c *Client) streamJobLogs(ctx context.Context, jobID string, since time.Time, follow bool, fn func(LogRecord) error) error {
+	query := url.Values{"format": {formatNDJSON}}
+	if !since.IsZero() {
+		query.Set("since", since.Format(time.RFC3339Nano))
+	}
+	if follow {
+		query.Set("follow", "true")
+	}
+
+	request, err := http.NewRequestWithContext(ctx, "GET", c.url+APIPrefix+"/jobs/"+jobID+"/logs?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	c.authorize(request.Header)
+
+	response, err := c.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return responseErr(response)
+	}
+
+	decoder := json.NewDecoder(response.Body)
+	for {
+		var record LogRecord
+		err := decoder.Decode(&record)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+}
+
+// GetInfo creates an HTTP request and parses response for the /info endpoint.
+func (c *Client) GetInfo() (*InfoResponse, error) {
+	request, err := http.NewRequest("GET", c.url+APIPrefix+"/info", nil)
+	if err != nil {
+		return nil, err
+	}
+	c.authorize(request.Header)
+
+	response, err := c.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	var infoResponse InfoResponse
+	if err := decodeResponse(response, &infoResponse); err != nil {
+		return nil, err
+	}
+	return &infoResponse, nil
+}
@@ -1,63 +1,363 @@
 package jobserver
 
 import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
 	"strings"
+	"teleport-jobworker/pkg/audit"
 	"teleport-jobworker/pkg/job"
 	"testing"
+	"time"
 )
 
+// testClient creates a Client of the test server authenticated with an access token.
+func testClient(ts *httptest.Server, token string) *Client {
+	return &Client{client: ts.Client(), url: ts.URL, token: token}
+}
+
 func TestStartJob(t *testing.T) {
 	ts, _ := initTestServer(t)
-	client := &Client{ts.Client(), ts.URL}
+	client := testClient(ts, user1token)
 
-	response, err := client.StartJob("user1", "/bin/echo", []string{"hello world"})
+	response, err := client.StartJob("/bin/echo", []string{"hello world"})
 	if err != nil {
-		t.Errorf("StartJob() error: %s", err.Error())
+		t.Fatalf("StartJob() error: %s", err.Error())
 	}
 
-	if response.Error != nil {
-		t.Errorf("StartJob() job error: %s", *response.Error)
+	if response.ID == "" {
+		t.Errorf("StartJob() expected a job ID")
 	}
 }
 
 func TestGetJobStatus(t *testing.T) {
 	ts, id := initTestServer(t)
-	client := &Client{ts.Client(), ts.URL}
+	client := testClient(ts, user1token)
 
-	response, err := client.GetJobStatus("user1", id)
+	response, err := client.GetJobStatus(id)
 	if err != nil {
-		t.Errorf("GetJobStatus() error: %s", err.Error())
+		t.Fatalf("GetJobStatus() error: %s", err.Error())
 	}
 
-	if response.Error != nil {
-		t.Errorf("GetJobStatus() job error: %s", *response.Error)
+	if response.ID != id {
+		t.Errorf("GetJobStatus() ID = %s, expected %s", response.ID, id)
 	}
 }
 
 func TestGetJobStatusNotFound(t *testing.T) {
 	ts, _ := initTestServer(t)
-	client := &Client{ts.Client(), ts.URL}
+	client := testClient(ts, user1token)
 
-	response, err := client.GetJobStatus("user1", "fake_id")
-	if err != nil {
-		t.Errorf("GetJobStatus() error: %s", err.Error())
+	_, err := client.GetJobStatus("fake_id")
+	if !errors.Is(err, job.ErrNotFound) {
+		t.Fatalf("GetJobStatus() expected %s, got %v", job.ErrNotFound, err)
 	}
 
-	if response.Error == nil || !strings.Contains(*response.Error, job.ErrNotFound.Error()) {
-		t.Errorf("GetJobStatus() expected %s, got %s", job.ErrNotFound.Error(), *response.Error)
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.Code != CodeJobNotFound || apiErr.Status != http.StatusNotFound ||
+		apiErr.RequestID == "" {
+		t.Errorf("GetJobStatus() unexpected error: %+v", apiErr)
 	}
 }
 
 func TestStartJobUnauthorized(t *testing.T) {
 	ts, _ := initTestServer(t)
-	client := &Client{ts.Client(), ts.URL}
+	client := testClient(ts, fakeusertoken)
+
+	_, err := client.StartJob("/bin/echo", []string{"hello world"})
+	if !errors.Is(err, job.ErrUnauthorized) || err.Error() != ErrBadAuthentication {
+		t.Errorf("StartJob() expected %s, got %v", ErrBadAuthentication, err)
+	}
+}
+
+func TestGetJobLogs(t *testing.T) {
+	ts, id := initTestServer(t)
+	client := testClient(ts, user1token)
+
+	records, err := client.GetJobLogs(id, time.Time{})
+	if err != nil {
+		t.Errorf("GetJobLogs() error: %s", err.Error())
+	}
+
+	if len(records) != 1 || records[0].Stream != job.Stdout || records[0].Data != "hello world\n" {
+		t.Errorf("GetJobLogs() unexpected records: %+v", records)
+	}
+
+	_, err = testClient(ts, user2token).GetJobLogs(id, time.Time{})
+	if !errors.Is(err, job.ErrNotFound) {
+		t.Errorf("GetJobLogs() expected %s, got %v", job.ErrNotFound.Error(), err)
+	}
+}
+
+func TestFollowJobLogs(t *testing.T) {
+	ts, _ := initTestServer(t)
+	client := testClient(ts, user1token)
+
+	response, err := client.StartJob("/bin/sh", []string{"-c", "echo one; sleep 0.2; echo two >&2; sleep 0.2; echo three"})
+	if err != nil {
+		t.Fatalf("StartJob() error: %s", err.Error())
+	}
+
+	var records []LogRecord
+	err = client.FollowJobLogs(context.Background(), response.ID, time.Time{}, func(record LogRecord) error {
+		records = append(records, record)
+		return nil
+	})
+	if err != nil {
+		t.Errorf("FollowJobLogs() error: %s", err.Error())
+	}
+
+	// the stream ends once the job exited, with every record sent once
+	expected := []LogRecord{{Seq: 1, Stream: job.Stdout, Data: "one\n"}, {Seq: 2, Stream: job.Stderr, Data: "two\n"},
+		{Seq: 3, Stream: job.Stdout, Data: "three\n"}}
+	if len(records) != len(expected) {
+		t.Fatalf("FollowJobLogs() expected %d records, got %+v", len(expected), records)
+	}
+	for i, record := range records {
+		if record.Seq != expected[i].Seq || record.Stream != expected[i].Stream || record.Data != expected[i].Data {
+			t.Errorf("FollowJobLogs() expected record %+v, got %+v", expected[i], record)
+		}
+	}
+
+	err = testClient(ts, user2token).FollowJobLogs(context.Background(), response.ID, time.Time{}, func(LogRecord) error { return nil })
+	if !errors.Is(err, job.ErrNotFound) {
+		t.Errorf("FollowJobLogs() expected %s, got %v", job.ErrNotFound, err)
+	}
+}
+
+func TestListJobs(t *testing.T) {
+	ts, id := initTestServer(t)
+
+	second, err := testClient(ts, user2token).StartJob("/bin/echo", []string{"hello world"})
+	if err != nil {
+		t.Fatalf("StartJob() error: %s", err.Error())
+	}
+
+	jobs, err := testClient(ts, user1token).ListJobs()
+	if err != nil {
+		t.Errorf("ListJobs() error: %s", err.Error())
+	}
+	if len(jobs) != 1 || jobs[0].ID != id || jobs[0].Owner != "user1" || jobs[0].Status != job.Completed {
+		t.Errorf("ListJobs() expected completed job %s of user1, got %+v", id, jobs)
+	}
+
+	jobs, _ = testClient(ts, admin1token).ListJobs()
+	if len(jobs) != 2 || jobs[0].ID != id || jobs[1].ID != second.ID {
+		t.Errorf("ListJobs() expected jobs %s and %s for admin, got %+v", id, second.ID, jobs)
+	}
+}
+
+func TestWriteJobStdin(t *testing.T) {
+	ts, _ := initTestServer(t)
+	client := testClient(ts, user1token)
+
+	startResponse, err := client.StartJobRequest(StartRequest{Program: "/bin/cat", Stdin: true})
+	if err != nil {
+		t.Fatalf("StartJobRequest() error: %s", err.Error())
+	}
+	id := startResponse.ID
+
+	// stdin is owned like any other job resource
+	_, err = testClient(ts, user2token).WriteJobStdin(id, strings.NewReader("intruder\n"))
+	if !errors.Is(err, job.ErrNotFound) {
+		t.Errorf("WriteJobStdin() expected %s, got %v", job.ErrNotFound.Error(), err)
+	}
+
+	response, err := client.WriteJobStdin(id, strings.NewReader("hello stdin\n"))
+	if err != nil {
+		t.Fatalf("WriteJobStdin() error: %s", err.Error())
+	}
+	if response.Written != int64(len("hello stdin\n")) {
+		t.Errorf("WriteJobStdin() unexpected response: %+v", response)
+	}
+
+	if _, err := client.CloseJobStdin(id); err != nil {
+		t.Errorf("CloseJobStdin() error: %s", err.Error())
+	}
+
+	// wait for cat to see EOF and exit
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		status, err := client.GetJobStatus(id)
+		if err != nil {
+			t.Fatalf("GetJobStatus() error: %s", err.Error())
+		}
+		if status.Status == job.Completed {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	output, err := client.GetJobOutput(id)
+	if err != nil {
+		t.Errorf("GetJobOutput() error: %s", err.Error())
+	}
+	if output.Stdout != "hello stdin\n" {
+		t.Errorf("GetJobOutput() unexpected stdout: %q", output.Stdout)
+	}
+}
+
+func TestAttachJob(t *testing.T) {
+	ts, _ := initTestServer(t)
+	client := testClient(ts, user1token)
+
+	startResponse, err := client.StartJobRequest(StartRequest{
+		Program: "/bin/sh",
+		Args:    []string{"-c", "read line; echo got $line"},
+		TTY:     true,
+	})
+	if err != nil {
+		t.Fatalf("StartJobRequest() error: %s", err.Error())
+	}
+
+	_, err = testClient(ts, user2token).AttachJob(startResponse.ID)
+	if !errors.Is(err, job.ErrNotFound) {
+		t.Errorf("AttachJob() expected %s, got %v", job.ErrNotFound.Error(), err)
+	}
+
+	attachment, err := client.AttachJob(startResponse.ID)
+	if err != nil {
+		t.Fatalf("AttachJob() error: %s", err.Error())
+	}
+	defer attachment.Close()
+
+	if err := attachment.Resize(40, 120); err != nil {
+		t.Errorf("Resize() error: %s", err.Error())
+	}
+	if _, err := attachment.Write([]byte("hi\n")); err != nil {
+		t.Errorf("Write() error: %s", err.Error())
+	}
+
+	// the session ends once the job exits
+	output, err := io.ReadAll(attachment)
+	if err != nil {
+		t.Errorf("ReadAll() error: %s", err.Error())
+	}
+	if !strings.Contains(string(output), "got hi") {
+		t.Errorf("Unexpected terminal output: %q", output)
+	}
+
+	status, exitCode, ok := attachment.ExitStatus()
+	if !ok || status != job.Completed || exitCode == nil || *exitCode != 0 {
+		t.Errorf("ExitStatus() expected completed with exit code 0, got %v, %v", status, exitCode)
+	}
+}
+
+func TestAttachJobDetach(t *testing.T) {
+	ts, _ := initTestServer(t)
+	client := testClient(ts, user1token)
+
+	startResponse, err := client.StartJobRequest(StartRequest{Program: "/bin/cat", TTY: true})
+	if err != nil {
+		t.Fatalf("StartJobRequest() error: %s", err.Error())
+	}
+	defer client.StopJob(startResponse.ID)
 
-	response, err := client.StartJob("fakeuser", "/bin/echo", []string{"hello world"})
+	attachment, err := client.AttachJob(startResponse.ID)
 	if err != nil {
-		t.Errorf("StartJob() error: %s", err.Error())
+		t.Fatalf("AttachJob() error: %s", err.Error())
+	}
+	defer attachment.Close()
+
+	if err := attachment.Detach(); err != nil {
+		t.Errorf("Detach() error: %s", err.Error())
+	}
+	if _, err := io.ReadAll(attachment); err != nil {
+		t.Errorf("ReadAll() error: %s", err.Error())
+	}
+	if _, _, ok := attachment.ExitStatus(); ok {
+		t.Errorf("ExitStatus() expected no exit status after detach")
+	}
+
+	// the job keeps running after detach
+	status, err := client.GetJobStatus(startResponse.ID)
+	if err != nil {
+		t.Errorf("GetJobStatus() error: %s", err.Error())
+	}
+	if status.Status != job.Running {
+		t.Errorf("GetJobStatus() expected running, got %v", status.Status)
+	}
+}
+
+func TestStartJobRetry(t *testing.T) {
+	ts, _ := initTestServer(t)
+
+	// fail the first attempt as if the server was unavailable, after starting the job
+	var keys []string
+	handler := ts.Config.Handler
+	ts.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get(IdempotencyKeyHeader))
+		if len(keys) == 1 {
+			handler.ServeHTTP(httptest.NewRecorder(), r)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+	client := testClient(ts, user1token)
+
+	response, err := client.StartJob("/bin/echo", []string{"hello world"})
+	if err != nil {
+		t.Fatalf("StartJob() error: %s", err.Error())
+	}
+
+	if len(keys) != 2 || keys[0] == "" || keys[0] != keys[1] {
+		t.Errorf("StartJob() expected 2 attempts with the same idempotency key, got %q", keys)
+	}
+
+	// the retry returned the job started by the first attempt
+	if _, err := client.GetJobStatus(response.ID); err != nil {
+		t.Errorf("GetJobStatus() error: %s", err.Error())
+	}
+}
+
+func TestGrantJob(t *testing.T) {
+	auditLog, err := audit.Open(filepath.Join(t.TempDir(), "audit.log"))
+	if err != nil {
+		t.Fatalf("Open() error: %s", err.Error())
+	}
+	defer auditLog.Close()
+	ts := httptest.NewTLSServer(NewServer(job.NewManager(), withTestTokens(), WithAuditLog(auditLog)))
+	defer ts.Close()
+	owner, other := testClient(ts, user1token), testClient(ts, user2token)
+
+	started, err := owner.StartJob("/bin/echo", []string{"hello world"})
+	if err != nil {
+		t.Fatalf("StartJob() error: %s", err.Error())
+	}
+
+	expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	response, err := owner.GrantJob(started.ID, GrantRequest{Users: []string{"user2"}, Access: job.AccessRead, ExpiresAt: &expiresAt})
+	if err != nil {
+		t.Fatalf("GrantJob() error: %s", err.Error())
+	}
+	if len(response.Grants) != 1 || response.Grants[0].GrantedBy != "user1" ||
+		!response.Grants[0].ExpiresAt.Equal(expiresAt) {
+		t.Errorf("GrantJob() expected a grant by user1 until %s, got %+v", expiresAt, response)
+	}
+
+	if _, err := other.GetJobStatus(started.ID); err != nil {
+		t.Errorf("GetJobStatus() error with read access: %s", err.Error())
+	}
+	_, err = other.StopJob(started.ID)
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.Code != CodePolicyDenied || apiErr.Details["verb"] != job.VerbStop {
+		t.Errorf("StopJob() expected missing stop permission with read access, got %v", err)
+	}
+
+	_, err = other.GrantJob(started.ID, GrantRequest{Users: []string{"user3"}, Access: "write"})
+	if !errors.Is(err, job.ErrInvalidGrant) {
+		t.Errorf("GrantJob() expected %s, got %v", job.ErrInvalidGrant, err)
 	}
 
-	if response.Error == nil || !strings.Contains(*response.Error, ErrBadAuthentication) {
-		t.Errorf("StartJob() expected %s, got %s", job.ErrUnauthorized.Error(), *response.Error)
+	records, _ := auditLog.Query(audit.Filter{Action: actionGrant})
+	want := []string{"access=read", "user=user2", "expires=" + expiresAt.Format(time.RFC3339)}
+	if len(records) != 2 || records[0].JobID != started.ID || !slices.Equal(records[0].Args, want) ||
+		records[1].Code != http.StatusBadRequest {
+		t.Errorf("Query() expected grant of user1 with args %v, then an invalid grant, got %+v", want, records)
 	}
 }
@@ -0,0 +1,259 @@
+package jobserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"teleport-jobworker/pkg/job"
+	"teleport-jobworker/pkg/token"
+
+	"github.com/google/uuid"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrorCode is the stable, machine-readable code of an API error.
+type ErrorCode string
+
+// API error codes
+const (
+	CodeInvalidRequest      ErrorCode = "INVALID_REQUEST"
+	CodeInvalidCommand      ErrorCode = "INVALID_COMMAND"
+	CodeInvalidSignal       ErrorCode = "INVALID_SIGNAL"
+	CodeInvalidGrant        ErrorCode = "INVALID_GRANT"
+	CodeUnauthenticated     ErrorCode = "UNAUTHENTICATED"
+	CodePolicyDenied        ErrorCode = "POLICY_DENIED"
+	CodeJobNotFound         ErrorCode = "JOB_NOT_FOUND"
+	CodeStdinClosed         ErrorCode = "STDIN_CLOSED"
+	CodeNoTerminal          ErrorCode = "NO_TERMINAL"
+	CodeIdempotencyConflict ErrorCode = "IDEMPOTENCY_CONFLICT"
+	CodeQuotaExceeded       ErrorCode = "QUOTA_EXCEEDED"
+	CodeUnavailable         ErrorCode = "UNAVAILABLE"
+	CodeInternal            ErrorCode = "INTERNAL"
+)
+
+// RequestIDHeader identifies a request in its response and in the server logs.
+// The server generates it, unless the client sent a valid one.
+const RequestIDHeader = "X-Request-Id"
+
+// errorDomain is the domain of the errdetails.ErrorInfo attached to gRPC errors.
+const errorDomain = "jobworker"
+
+// Error is an error reported by the server: the body of API error responses, and the error
+// returned by the Clients for them. Callers check its code with errors.As, or errors.Is with
+// the errors of the job library, eg. errors.Is(err, job.ErrNotFound).
+type Error struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+	// RequestID is the X-Request-Id of the HTTPS request, empty for gRPC errors.
+	RequestID string            `json:"requestId,omitempty"`
+	Details   map[string]string `json:"details,omitempty"`
+	// Status is the HTTP status code of the response, or its equivalent for gRPC errors.
+	Status int `json:"-"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Is reports whether target is an *Error with the same code, or an error of the job library
+// mapped to the code of e.
+func (e *Error) Is(target error) bool {
+	if other, ok := target.(*Error); ok {
+		return other.Code == e.Code
+	}
+	for _, mapped := range errorCodes {
+		if mapped.code == e.Code && mapped.err == target {
+			return true
+		}
+	}
+	return false
+}
+
+// errorCodes maps errors of the job library to API error codes, in order of precedence.
+var errorCodes = []struct {
+	err  error
+	code ErrorCode
+}{
+	{job.ErrNotFound, CodeJobNotFound},
+	{job.ErrDraining, CodeUnavailable},
+	{job.ErrInvalidCommand, CodeInvalidCommand},
+	{job.ErrInvalidSignal, CodeInvalidSignal},
+	{job.ErrInvalidGrant, CodeInvalidGrant},
+	{job.ErrUnauthorized, CodeUnauthenticated},
+	{token.ErrInvalidCredentials, CodeUnauthenticated},
+	{job.ErrForbidden, CodePolicyDenied},
+	{job.ErrStdinClosed, CodeStdinClosed},
+	{job.ErrNoTerminal, CodeNoTerminal},
+	{job.ErrTooManyJobs, CodeQuotaExceeded},
+	{errIdempotencyConflict, CodeIdempotencyConflict},
+	{errTooManyIdempotencyKeys, CodeQuotaExceeded},
+}
+
+// codeStatuses maps API error codes to HTTP and gRPC status codes.
+var codeStatuses = map[ErrorCode]struct {
+	http int
+	grpc codes.Code
+}{
+	CodeInvalidRequest:      {http.StatusBadRequest, codes.InvalidArgument},
+	CodeInvalidCommand:      {http.StatusBadRequest, codes.InvalidArgument},
+	CodeInvalidSignal:       {http.StatusBadRequest, codes.InvalidArgument},
+	CodeInvalidGrant:        {http.StatusBadRequest, codes.InvalidArgument},
+	CodeUnauthenticated:     {http.StatusUnauthorized, codes.Unauthenticated},
+	CodePolicyDenied:        {http.StatusForbidden, codes.PermissionDenied},
+	CodeJobNotFound:         {http.StatusNotFound, codes.NotFound},
+	CodeStdinClosed:         {http.StatusConflict, codes.FailedPrecondition},
+	CodeNoTerminal:          {http.StatusConflict, codes.FailedPrecondition},
+	CodeIdempotencyConflict: {http.StatusConflict, codes.AlreadyExists},
+	CodeQuotaExceeded:       {http.StatusTooManyRequests, codes.ResourceExhausted},
+	CodeUnavailable:         {http.StatusServiceUnavailable, codes.Unavailable},
+	CodeInternal:            {http.StatusInternalServerError, codes.Internal},
+}
+
+// newError creates an API error with code, and details, if any.
+func newError(code ErrorCode, message string, details map[string]string) *Error {
+	return &Error{Code: code, Message: message, Details: details, Status: codeStatuses[code].http}
+}
+
+// invalidRequest creates an INVALID_REQUEST error, eg. for a malformed request body.
+func invalidRequest(format string, args ...any) *Error {
+	return newError(CodeInvalidRequest, fmt.Sprintf(format, args...), nil)
+}
+
+// invalidParameter creates an INVALID_REQUEST error for an invalid query parameter.
+func invalidParameter(parameter, format string, args ...any) *Error {
+	return newError(CodeInvalidRequest, fmt.Sprintf(format, args...), map[string]string{"parameter": parameter})
+}
+
+// unauthenticated is the error of requests failing authentication. The reason is not disclosed.
+func unauthenticated() *Error {
+	return newError(CodeUnauthenticated, ErrBadAuthentication, nil)
+}
+
+// messageInternal is the message of internal errors, whose cause is only logged by the server.
+const messageInternal = "internal server error, see the server log for the request ID"
+
+// apiError maps an error to an API error, by the errors of the job library it matches.
+// Errors which are already API errors are returned as a copy, and other errors as
+// a generic internal error.
+func apiError(err error) *Error {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		copied := *apiErr
+		return &copied
+	}
+
+	code := CodeInternal
+	for _, mapped := range errorCodes {
+		if errors.Is(err, mapped.err) {
+			code = mapped.code
+			break
+		}
+	}
+
+	// the cause of internal errors is logged by the server, never sent to clients
+	if code == CodeInternal {
+		return newError(code, messageInternal, nil)
+	}
+
+	var details map[string]string
+	var permissionErr *job.PermissionError
+	if errors.As(err, &permissionErr) {
+		details = map[string]string{"verb": permissionErr.Verb}
+		if permissionErr.Scope != "" {
+			details["scope"] = permissionErr.Scope
+		}
+	}
+	return newError(code, err.Error(), details)
+}
+
+// validRequestID matches the request IDs accepted from clients.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+// withRequestID sets the request ID of the response, taken from the request if valid, or generated.
+func withRequestID(w http.ResponseWriter, r *http.Request) {
+	requestID := r.Header.Get(RequestIDHeader)
+	if !validRequestID.MatchString(requestID) {
+		requestID = uuid.NewString()
+	}
+	w.Header().Set(RequestIDHeader, requestID)
+}
+
+// responseError prepares the error response body as JSON, with the request ID of the response.
+func responseError(w http.ResponseWriter, err error) {
+	apiErr := apiError(err)
+	apiErr.RequestID = w.Header().Get(RequestIDHeader)
+	if apiErr.Code == CodeInternal {
+		log.Printf("request %s failed: %v", apiErr.RequestID, err)
+	}
+	responseJSON(w, ErrorResponse{Error: *apiErr}, apiErr.Status)
+}
+
+// grpcError maps an error to a gRPC status error, carrying its API error code as an errdetails.ErrorInfo.
+func grpcError(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return status.FromContextError(err).Err()
+	}
+
+	apiErr := apiError(err)
+	if apiErr.Code == CodeInternal {
+		// RPCs have no request ID: the error ID correlates the response with the server log
+		errorID := uuid.NewString()
+		log.Printf("RPC failed, error ID %s: %v", errorID, err)
+		apiErr.Message = fmt.Sprintf("%s (error ID %s)", messageInternal, errorID)
+	}
+	s := status.New(codeStatuses[apiErr.Code].grpc, apiErr.Message)
+	detailed, detailsErr := s.WithDetails(&errdetails.ErrorInfo{
+		Reason:   string(apiErr.Code),
+		Domain:   errorDomain,
+		Metadata: apiErr.Details,
+	})
+	if detailsErr != nil {
+		return s.Err()
+	}
+	return detailed.Err()
+}
+
+// grpcClientError maps an error reported by the gRPC server to an *Error. Network errors, unavailable
+// servers and canceled calls are returned unchanged.
+func grpcClientError(err error) error {
+	s, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+
+	apiErr := &Error{Message: s.Message()}
+	for _, detail := range s.Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok && info.Domain == errorDomain {
+			apiErr.Code = ErrorCode(info.Reason)
+			apiErr.Details = info.Metadata
+		}
+	}
+	if apiErr.Code == "" {
+		switch s.Code() {
+		case codes.Unavailable, codes.Canceled, codes.DeadlineExceeded:
+			return err
+		case codes.Unauthenticated:
+			apiErr.Code = CodeUnauthenticated
+		case codes.PermissionDenied:
+			apiErr.Code = CodePolicyDenied
+		case codes.InvalidArgument:
+			apiErr.Code = CodeInvalidRequest
+		default:
+			apiErr.Code = CodeInternal
+		}
+	}
+
+	apiErr.Status = http.StatusInternalServerError
+	if statuses, ok := codeStatuses[apiErr.Code]; ok {
+		apiErr.Status = statuses.http
+	}
+	return apiErr
+}
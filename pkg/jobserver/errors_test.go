@@ -0,0 +1,124 @@
+package jobserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"strings"
+	"teleport-jobworker/pkg/job"
+	"testing"
+)
+
+func TestErrorResponses(t *testing.T) {
+	ts, _ := initTestServer(t)
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		body    string
+		token   string
+		status  int
+		code    ErrorCode
+		details map[string]string
+	}{
+		{"malformed JSON", "POST", "/v1/jobs/start", `{"program": "/bin/echo",}`, user1token,
+			http.StatusBadRequest, CodeInvalidRequest, map[string]string{"offset": "25"}},
+		{"wrong field type", "POST", "/v1/jobs/start", `{"program": 1}`, user1token,
+			http.StatusBadRequest, CodeInvalidRequest, map[string]string{"field": "program"}},
+		{"empty body", "POST", "/v1/jobs/fake_id/signal", "", user1token,
+			http.StatusBadRequest, CodeInvalidRequest, nil},
+		{"invalid parameter", "GET", "/v1/jobs/fake_id/logs?format=xml", "", user1token,
+			http.StatusBadRequest, CodeInvalidRequest, map[string]string{"parameter": "format"}},
+		{"invalid command", "POST", "/v1/jobs/start", `{"pipeline": [{"program": "/bin/echo"}, {"program": "/bin/cat"}], "tty": true}`, user1token,
+			http.StatusBadRequest, CodeInvalidCommand, nil},
+		{"unauthenticated", "GET", "/v1/jobs/fake_id", "", fakeusertoken,
+			http.StatusUnauthorized, CodeUnauthenticated, nil},
+		{"not found", "GET", "/v1/jobs/fake_id", "", user1token,
+			http.StatusNotFound, CodeJobNotFound, nil},
+	}
+
+	for _, test := range tests {
+		request, _ := http.NewRequest(test.method, ts.URL+test.path, strings.NewReader(test.body))
+		request.Header.Set("Authorization", "Bearer "+test.token)
+		response, err := ts.Client().Do(request)
+		if err != nil {
+			t.Fatalf("%s: Do() error: %s", test.name, err.Error())
+		}
+
+		var errorResponse ErrorResponse
+		err = json.NewDecoder(response.Body).Decode(&errorResponse)
+		response.Body.Close()
+		if err != nil {
+			t.Errorf("%s: JSON decoding error: %s", test.name, err.Error())
+			continue
+		}
+
+		got := errorResponse.Error
+		if response.StatusCode != test.status || got.Code != test.code || got.Message == "" ||
+			!maps.Equal(got.Details, test.details) {
+			t.Errorf("%s: expected %d %s %v, got %d %+v", test.name, test.status, test.code, test.details, response.StatusCode, got)
+		}
+		if got.RequestID == "" || got.RequestID != response.Header.Get(RequestIDHeader) {
+			t.Errorf("%s: expected the request ID of the %s header, got %q", test.name, RequestIDHeader, got.RequestID)
+		}
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	ts, _ := initTestServer(t)
+
+	for requestID, keep := range map[string]bool{"trace-42.a_b": true, "not valid": false, "": false} {
+		request, _ := http.NewRequest("GET", ts.URL+"/v1/jobs/fake_id", nil)
+		request.Header.Set("Authorization", "Bearer "+user1token)
+		request.Header.Set(RequestIDHeader, requestID)
+
+		response, err := ts.Client().Do(request)
+		if err != nil {
+			t.Fatalf("Do() error: %s", err.Error())
+		}
+		var apiErr *Error
+		err = responseErr(response)
+		response.Body.Close()
+		if !errors.As(err, &apiErr) {
+			t.Fatalf("responseErr() expected *Error, got %v", err)
+		}
+		if (apiErr.RequestID == requestID) != keep || apiErr.RequestID == "" {
+			t.Errorf("request ID %q: got %q, expected it kept: %v", requestID, apiErr.RequestID, keep)
+		}
+	}
+}
+
+func TestGRPCErrorDetails(t *testing.T) {
+	err := grpcClientError(grpcError(fmt.Errorf("%w: 2 jobs are running, the limit is 2", job.ErrTooManyJobs)))
+	if !errors.Is(err, job.ErrTooManyJobs) || errors.Is(err, job.ErrNotFound) {
+		t.Errorf("grpcClientError() expected %s, got %v", job.ErrTooManyJobs, err)
+	}
+	if !errors.Is(err, &Error{Code: CodeQuotaExceeded}) {
+		t.Errorf("grpcClientError() expected code %s, got %v", CodeQuotaExceeded, err)
+	}
+
+	var apiErr *Error
+	err = grpcClientError(grpcError(&job.PermissionError{Verb: job.VerbSignal, Scope: job.ScopeOwn}))
+	if !errors.As(err, &apiErr) || apiErr.Code != CodePolicyDenied || apiErr.Status != http.StatusForbidden ||
+		!maps.Equal(apiErr.Details, map[string]string{"verb": job.VerbSignal, "scope": job.ScopeOwn}) {
+		t.Errorf("grpcClientError() unexpected error: %+v", apiErr)
+	}
+}
+
+func TestInternalErrorMessage(t *testing.T) {
+	cause := errors.New("open /var/lib/jobserver/secret: permission denied")
+
+	if apiErr := apiError(cause); apiErr.Code != CodeInternal || strings.Contains(apiErr.Message, "secret") {
+		t.Errorf("apiError() expected a generic internal error, got %+v", apiErr)
+	}
+
+	var apiErr *Error
+	err := grpcClientError(grpcError(cause))
+	if !errors.As(err, &apiErr) || apiErr.Code != CodeInternal || strings.Contains(apiErr.Message, "secret") ||
+		!strings.Contains(apiErr.Message, "error ID") {
+		t.Errorf("grpcClientError() expected a generic internal error with an error ID, got %v", err)
+	}
+}
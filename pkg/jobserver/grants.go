@@ -0,0 +1,89 @@
+package jobserver
+
+import (
+	"net/http"
+	"teleport-jobworker/pkg/job"
+	"time"
+)
+
+// actionGrant is audited for the grants of jobs shared with other users.
+const actionGrant = "grant"
+
+// GrantRequest defines the Grant request body.
+type GrantRequest struct {
+	Users  []string `json:"users,omitempty"`
+	Groups []string `json:"groups,omitempty"`
+	// Access is read (status and output) or control (read, stop and signal).
+	Access string `json:"access"`
+	// ExpiresAt is when the grant stops applying, or never if not set.
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// Grant defines a grant of the Grant response body.
+type Grant struct {
+	Users     []string   `json:"users,omitempty"`
+	Groups    []string   `json:"groups,omitempty"`
+	Access    string     `json:"access"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	GrantedBy string     `json:"grantedBy"`
+}
+
+// GrantResponse defines the Grant response body, listing every grant of the job.
+type GrantResponse struct {
+	ID     string  `json:"id"`
+	Grants []Grant `json:"grants"`
+}
+
+// grantHandler handles HTTPS requests to POST /v1/jobs/{id}/grants
+func (s *Server) grantHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	var grantRequest GrantRequest
+	if err := decodeJSON(w, r, &grantRequest); err != nil {
+		responseError(w, err)
+		return
+	}
+
+	grant := job.Grant{Users: grantRequest.Users, Groups: grantRequest.Groups, Access: grantRequest.Access}
+	if grantRequest.ExpiresAt != nil {
+		grant.ExpiresAt = *grantRequest.ExpiresAt
+	}
+	auditRecord(r.Context()).Args = grantArgs(grant)
+
+	grants, err := s.manager.Grant(r.Context(), id, grant)
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+
+	response := GrantResponse{ID: id, Grants: make([]Grant, 0, len(grants))}
+	for _, grant := range grants {
+		response.Grants = append(response.Grants, newGrant(grant))
+	}
+	responseJSON(w, response, http.StatusOK)
+}
+
+// newGrant converts a grant of the job library to its response body.
+func newGrant(grant job.Grant) Grant {
+	converted := Grant{Users: grant.Users, Groups: grant.Groups, Access: grant.Access, GrantedBy: grant.GrantedBy}
+	if !grant.ExpiresAt.IsZero() {
+		converted.ExpiresAt = &grant.ExpiresAt
+	}
+	return converted
+}
+
+// grantArgs describes a grant in the arguments of its audit record,
+// eg. [access=read user=user2 group=ops expires=2025-01-02T15:04:05Z].
+func grantArgs(grant job.Grant) []string {
+	args := []string{"access=" + grant.Access}
+	for _, user := range grant.Users {
+		args = append(args, "user="+user)
+	}
+	for _, group := range grant.Groups {
+		args = append(args, "group="+group)
+	}
+	if !grant.ExpiresAt.IsZero() {
+		args = append(args, "expires="+grant.ExpiresAt.UTC().Format(time.RFC3339))
+	}
+	return args
+}
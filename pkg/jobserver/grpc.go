@@ -0,0 +1,357 @@
+package jobserver
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"teleport-jobworker/pkg/audit"
+	"teleport-jobworker/pkg/job"
+	"teleport-jobworker/pkg/jobpb"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const DefaultGRPCHost = "localhost:8444"
+
+// grpcActions maps the RPCs of the JobService to audited actions.
+var grpcActions = map[string]string{
+	jobpb.JobService_Start_FullMethodName:        actionStart,
+	jobpb.JobService_Stop_FullMethodName:         actionStop,
+	jobpb.JobService_Signal_FullMethodName:       actionSignal,
+	jobpb.JobService_Grant_FullMethodName:        actionGrant,
+	jobpb.JobService_GetStatus_FullMethodName:    actionStatus,
+	jobpb.JobService_Wait_FullMethodName:         actionWait,
+	jobpb.JobService_GetOutput_FullMethodName:    actionOutput,
+	jobpb.JobService_StreamOutput_FullMethodName: actionLogs,
+	jobpb.JobService_List_FullMethodName:         actionList,
+}
+
+// NewGRPCServer creates a gRPC server for the JobService, sharing the Manager, Bearer token
+// authentication, metrics and audit log of the job Server. opts configure the gRPC server,
+// eg. its TLS credentials.
+func (s *Server) NewGRPCServer(opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts,
+		grpc.ChainUnaryInterceptor(s.unaryInterceptor),
+		grpc.ChainStreamInterceptor(s.streamInterceptor),
+	)
+
+	server := grpc.NewServer(opts...)
+	jobpb.RegisterJobServiceServer(server, &jobService{manager: s.manager})
+	s.grpcEnabled.Store(true)
+	return server
+}
+
+// unaryInterceptor authenticates and audits unary RPCs.
+func (s *Server) unaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, record, err := s.grpcAuth(ctx, info.FullMethod)
+	if request, ok := req.(interface{ GetId() string }); ok {
+		record.JobID = request.GetId()
+	}
+
+	var response any
+	if err == nil {
+		response, err = handler(ctx, req)
+	}
+
+	s.auditGRPC(record, err, false)
+	return response, err
+}
+
+// streamInterceptor authenticates and audits streaming RPCs.
+func (s *Server) streamInterceptor(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, record, err := s.grpcAuth(stream.Context(), info.FullMethod)
+	if err == nil {
+		err = handler(srv, &authenticatedStream{ServerStream: stream, ctx: ctx})
+	}
+
+	// a client ends a server stream, eg. following output, by canceling it
+	s.auditGRPC(record, err, info.IsServerStream && !info.IsClientStream)
+	return err
+}
+
+// authenticatedStream carries the user information of an authenticated stream to its handler.
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (a *authenticatedStream) Context() context.Context {
+	return a.ctx
+}
+
+// grpcAuth inspects the authorization metadata or client certificate like bearerAuth, and stores the user
+// information and audit record of the RPC in the returned context.
+func (s *Server) grpcAuth(ctx context.Context, method string) (context.Context, *audit.Record, error) {
+	record := &audit.Record{
+		Time:   time.Now(),
+		Action: grpcActions[method],
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		record.SourceIP = p.Addr.String()
+		if host, _, err := net.SplitHostPort(record.SourceIP); err == nil {
+			record.SourceIP = host
+		}
+	}
+	ctx = context.WithValue(ctx, auditContextKey{}, record)
+
+	var authorization string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("authorization"); len(values) > 0 {
+			authorization = values[0]
+		}
+	}
+
+	var state *tls.ConnectionState
+	if p, ok := peer.FromContext(ctx); ok {
+		if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			state = &tlsInfo.State
+		}
+	}
+
+	claims, reason := s.authenticateRequest(state, authorization)
+	if reason != "" {
+		s.authFailure(reason)
+		return ctx, record, grpcError(unauthenticated())
+	}
+
+	record.User, record.Role = claims.userId, claims.role
+	return job.WithUserInfo(ctx, claims.userId, claims.role), record, nil
+}
+
+// statusClientClosedRequest is the non-standard HTTP status code of requests canceled by the client.
+const statusClientClosedRequest = 499
+
+// auditGRPC appends the record of an RPC to the audit log, if enabled,
+// with the HTTP status code equivalent to its result. A canceled RPC succeeded if endedByClient.
+func (s *Server) auditGRPC(record *audit.Record, err error, endedByClient bool) {
+	if s.auditLog == nil {
+		return
+	}
+
+	code := http.StatusOK
+	switch status.Code(err) {
+	case codes.OK:
+	case codes.Unauthenticated:
+		code = http.StatusUnauthorized
+	case codes.PermissionDenied:
+		code = http.StatusForbidden
+	case codes.NotFound:
+		code = http.StatusNotFound
+	case codes.InvalidArgument:
+		code = http.StatusBadRequest
+	case codes.FailedPrecondition, codes.AlreadyExists:
+		code = http.StatusConflict
+	case codes.ResourceExhausted:
+		code = http.StatusTooManyRequests
+	case codes.Unavailable:
+		code = http.StatusServiceUnavailable
+	case codes.Canceled:
+		if !endedByClient {
+			code = statusClientClosedRequest
+		}
+	case codes.DeadlineExceeded:
+		code = http.StatusGatewayTimeout
+	default:
+		code = http.StatusInternalServerError
+	}
+	s.appendAudit(record, code)
+}
+
+// jobService implements the JobService RPCs with job.Manager library calls.
+type jobService struct {
+	jobpb.UnimplementedJobServiceServer
+	manager *job.Manager
+}
+
+func (j *jobService) Start(ctx context.Context, request *jobpb.StartRequest) (*jobpb.StartResponse, error) {
+	commands, field := []job.Command{{Program: request.Program, Args: request.Args}}, ""
+	if len(request.Pipeline) > 0 {
+		if request.Program != "" {
+			return nil, grpcError(invalidField("program", "program and pipeline are mutually exclusive"))
+		}
+
+		commands, field = make([]job.Command, 0, len(request.Pipeline)), "pipeline"
+		for _, command := range request.Pipeline {
+			commands = append(commands, job.Command{Program: command.Program, Args: command.Args})
+		}
+	}
+
+	var opts []job.StartOption
+	if request.Pipefail {
+		opts = append(opts, job.WithPipefail())
+	}
+	if len(request.Labels) > 0 {
+		opts = append(opts, job.WithLabels(request.Labels))
+	}
+
+	record := auditRecord(ctx)
+	auditCommands(record, commands)
+	// validating the commands looks the programs up, which is only for users who may start them
+	if err := j.manager.AuthorizeStart(ctx, commands, opts...); err != nil {
+		return nil, grpcError(err)
+	}
+	if err := validateCommands(commands, field); err != nil {
+		return nil, grpcError(err)
+	}
+
+	jobID, err := j.manager.StartPipeline(ctx, commands, opts...)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	record.JobID = jobID
+	return &jobpb.StartResponse{Id: jobID}, nil
+}
+
+func (j *jobService) Stop(ctx context.Context, request *jobpb.StopRequest) (*jobpb.StopResponse, error) {
+	if err := j.manager.Stop(ctx, request.Id); err != nil {
+		return nil, grpcError(err)
+	}
+
+	return &jobpb.StopResponse{Id: request.Id}, nil
+}
+
+func (j *jobService) Signal(ctx context.Context, request *jobpb.SignalRequest) (*jobpb.SignalResponse, error) {
+	auditRecord(ctx).Args = []string{request.Signal}
+
+	sig, err := job.ParseSignal(request.Signal)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	if err := j.manager.Signal(ctx, request.Id, sig); err != nil {
+		return nil, grpcError(err)
+	}
+
+	return &jobpb.SignalResponse{Id: request.Id}, nil
+}
+
+func (j *jobService) Grant(ctx context.Context, request *jobpb.GrantRequest) (*jobpb.GrantResponse, error) {
+	var grant job.Grant
+	if request.Grant != nil {
+		grant = job.Grant{Users: request.Grant.Users, Groups: request.Grant.Groups, Access: request.Grant.Access}
+		if request.Grant.ExpiresAt != nil {
+			grant.ExpiresAt = request.Grant.ExpiresAt.AsTime()
+		}
+	}
+	auditRecord(ctx).Args = grantArgs(grant)
+
+	grants, err := j.manager.Grant(ctx, request.Id, grant)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	response := &jobpb.GrantResponse{Id: request.Id, Grants: make([]*jobpb.JobGrant, 0, len(grants))}
+	for _, grant := range grants {
+		converted := &jobpb.JobGrant{
+			Users:     grant.Users,
+			Groups:    grant.Groups,
+			Access:    grant.Access,
+			GrantedBy: grant.GrantedBy,
+		}
+		if !grant.ExpiresAt.IsZero() {
+			converted.ExpiresAt = timestamppb.New(grant.ExpiresAt)
+		}
+		response.Grants = append(response.Grants, converted)
+	}
+	return response, nil
+}
+
+func (j *jobService) GetStatus(ctx context.Context, request *jobpb.GetStatusRequest) (*jobpb.GetStatusResponse, error) {
+	jobStatus, err := j.manager.GetStatus(ctx, request.Id)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	response := &jobpb.GetStatusResponse{
+		Id:       request.Id,
+		Status:   jobStatus.State,
+		ExitCode: optionalInt32(jobStatus.ExitCode),
+		Signal:   int32(jobStatus.Signal),
+	}
+	for _, code := range jobStatus.StageExitCodes {
+		response.StageExitCodes = append(response.StageExitCodes, int32(code))
+	}
+	return response, nil
+}
+
+func (j *jobService) GetOutput(ctx context.Context, request *jobpb.GetOutputRequest) (*jobpb.GetOutputResponse, error) {
+	stdout, stderr, err := j.manager.GetOutput(ctx, request.Id)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	return &jobpb.GetOutputResponse{Id: request.Id, Stdout: stdout, Stderr: stderr}, nil
+}
+
+func (j *jobService) StreamOutput(request *jobpb.StreamOutputRequest, stream grpc.ServerStreamingServer[jobpb.OutputRecord]) error {
+	ctx := stream.Context()
+	auditRecord(ctx).JobID = request.Id
+
+	var since time.Time
+	if request.Since != nil {
+		since = request.Since.AsTime()
+	}
+
+	send := func(record job.OutputRecord) error {
+		return stream.Send(&jobpb.OutputRecord{
+			Seq:    record.Seq,
+			Time:   timestamppb.New(record.Time),
+			Stream: record.Stream,
+			Data:   record.Data,
+		})
+	}
+
+	if !request.Follow {
+		records, err := j.manager.GetOutputRecords(ctx, request.Id, since)
+		if err != nil {
+			return grpcError(err)
+		}
+		for _, record := range records {
+			if err := send(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := j.manager.FollowOutput(ctx, request.Id, since, send); err != nil {
+		return grpcError(err)
+	}
+	return nil
+}
+
+func (j *jobService) List(ctx context.Context, request *jobpb.ListRequest) (*jobpb.ListResponse, error) {
+	jobs, err := j.manager.List(ctx)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	response := &jobpb.ListResponse{Jobs: make([]*jobpb.Job, 0, len(jobs))}
+	for _, info := range jobs {
+		response.Jobs = append(response.Jobs, &jobpb.Job{
+			Id:       info.ID,
+			Owner:    info.UserID,
+			Labels:   info.Labels,
+			Status:   info.Status.State,
+			ExitCode: optionalInt32(info.Status.ExitCode),
+		})
+	}
+	return response, nil
+}
+
+// optionalInt32 converts an optional exit code to its protobuf field.
+func optionalInt32(value *int) *int32 {
+	if value == nil {
+		return nil
+	}
+	converted := int32(*value)
+	return &converted
+}
@@ -0,0 +1,289 @@
+package jobserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"teleport-jobworker/pkg/jobpb"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var ErrNotSupportedGRPC = errors.New("not supported by the gRPC API, use the HTTPS API")
+
+// GRPCClient sends job management requests to the gRPC API server.
+// It returns the same responses and errors as the HTTPS Client: errors reported by the server
+// are returned as an *Error.
+type GRPCClient struct {
+	conn   *grpc.ClientConn
+	client jobpb.JobServiceClient
+	token  string
+}
+
+// NewGRPCClient configures a gRPC client for communication with the job Server.
+func NewGRPCClient(opts ...ClientOption) (*GRPCClient, error) {
+	options := newClientOptions(opts)
+	tlsConfig, err := clientTLSConfig(options)
+	if err != nil {
+		return nil, err
+	}
+
+	return DialGRPC(DefaultGRPCHost, options.token, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+}
+
+// DialGRPC creates a gRPC client for the job Server at target, eg. with custom credentials.
+// Requests are authenticated with the access token, if any.
+func DialGRPC(target, token string, opts ...grpc.DialOption) (*GRPCClient, error) {
+	conn, err := grpc.NewClient(target, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &GRPCClient{conn: conn, client: jobpb.NewJobServiceClient(conn), token: token}, nil
+}
+
+// Close closes the connection to the server.
+func (c *GRPCClient) Close() error {
+	return c.conn.Close()
+}
+
+// authContext returns a child of ctx authenticating requests with the access token of the client, if any.
+func (c *GRPCClient) authContext(ctx context.Context) context.Context {
+	if c.token == "" {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+c.token)
+}
+
+// StartJob sends a Start RPC.
+func (c *GRPCClient) StartJob(program string, args []string) (*StartResponse, error) {
+	return c.StartJobRequest(StartRequest{
+		Program: program,
+		Args:    args,
+	})
+}
+
+// StartJobRequest is StartJob with StartRequest options. Jobs with an open stdin
+// or a terminal can only be started with the HTTPS Client.
+func (c *GRPCClient) StartJobRequest(requestBody StartRequest) (*StartResponse, error) {
+	if requestBody.Stdin || requestBody.TTY {
+		return nil, fmt.Errorf("jobs with stdin or a terminal are %w", ErrNotSupportedGRPC)
+	}
+
+	request := &jobpb.StartRequest{
+		Program:  requestBody.Program,
+		Args:     requestBody.Args,
+		Pipefail: requestBody.Pipefail,
+		Labels:   requestBody.Labels,
+	}
+	for _, command := range requestBody.Pipeline {
+		request.Pipeline = append(request.Pipeline, &jobpb.Command{Program: command.Program, Args: command.Args})
+	}
+
+	response, err := c.client.Start(c.authContext(context.Background()), request)
+	if err != nil {
+		return nil, grpcClientError(err)
+	}
+	return &StartResponse{ID: response.Id}, nil
+}
+
+// StopJob sends a Stop RPC.
+func (c *GRPCClient) StopJob(jobID string) (*StopResponse, error) {
+	response, err := c.client.Stop(c.authContext(context.Background()), &jobpb.StopRequest{Id: jobID})
+	if err != nil {
+		return nil, grpcClientError(err)
+	}
+	return &StopResponse{ID: response.Id}, nil
+}
+
+// SignalJob sends a Signal RPC.
+func (c *GRPCClient) SignalJob(jobID, signal string) (*SignalResponse, error) {
+	response, err := c.client.Signal(c.authContext(context.Background()), &jobpb.SignalRequest{Id: jobID, Signal: signal})
+	if err != nil {
+		return nil, grpcClientError(err)
+	}
+	return &SignalResponse{ID: response.Id}, nil
+}
+
+// GrantJob sends a Grant RPC.
+func (c *GRPCClient) GrantJob(jobID string, grant GrantRequest) (*GrantResponse, error) {
+	request := &jobpb.GrantRequest{Id: jobID, Grant: &jobpb.JobGrant{
+		Users:  grant.Users,
+		Groups: grant.Groups,
+		Access: grant.Access,
+	}}
+	if grant.ExpiresAt != nil {
+		request.Grant.ExpiresAt = timestamppb.New(*grant.ExpiresAt)
+	}
+
+	response, err := c.client.Grant(c.authContext(context.Background()), request)
+	if err != nil {
+		return nil, grpcClientError(err)
+	}
+
+	grantResponse := &GrantResponse{ID: response.Id, Grants: make([]Grant, 0, len(response.Grants))}
+	for _, granted := range response.Grants {
+		converted := Grant{
+			Users:     granted.Users,
+			Groups:    granted.Groups,
+			Access:    granted.Access,
+			GrantedBy: granted.GrantedBy,
+		}
+		if granted.ExpiresAt != nil {
+			expiresAt := granted.ExpiresAt.AsTime()
+			converted.ExpiresAt = &expiresAt
+		}
+		grantResponse.Grants = append(grantResponse.Grants, converted)
+	}
+	return grantResponse, nil
+}
+
+// WriteJobStdin is only supported by the HTTPS Client.
+func (c *GRPCClient) WriteJobStdin(jobID string, r io.Reader) (*StdinResponse, error) {
+	return nil, fmt.Errorf("writing stdin is %w", ErrNotSupportedGRPC)
+}
+
+// CloseJobStdin is only supported by the HTTPS Client.
+func (c *GRPCClient) CloseJobStdin(jobID string) (*StdinResponse, error) {
+	return nil, fmt.Errorf("closing stdin is %w", ErrNotSupportedGRPC)
+}
+
+// GetJobStatus sends a GetStatus RPC.
+func (c *GRPCClient) GetJobStatus(jobID string) (*StatusResponse, error) {
+	response, err := c.client.GetStatus(c.authContext(context.Background()), &jobpb.GetStatusRequest{Id: jobID})
+	if err != nil {
+		return nil, grpcClientError(err)
+	}
+
+	statusResponse := &StatusResponse{
+		ID:       response.Id,
+		Status:   response.Status,
+		ExitCode: optionalInt(response.ExitCode),
+		Signal:   int(response.Signal),
+	}
+	for _, code := range response.StageExitCodes {
+		statusResponse.StageExitCodes = append(statusResponse.StageExitCodes, int(code))
+	}
+	return statusResponse, nil
+}
+
+// WaitJob sends a Wait RPC, blocking until the job reached a final state or the timeout passed.
+// A zero timeout uses the server's default.
+func (c *GRPCClient) WaitJob(jobID string, timeout time.Duration) (*StatusResponse, error) {
+	request := &jobpb.WaitRequest{Id: jobID}
+	if timeout > 0 {
+		request.Timeout = durationpb.New(timeout)
+	}
+
+	response, err := c.client.Wait(c.authContext(context.Background()), request)
+	if err != nil {
+		return nil, grpcClientError(err)
+	}
+
+	statusResponse := &StatusResponse{
+		ID:       response.Id,
+		Status:   response.Status,
+		ExitCode: optionalInt(response.ExitCode),
+		Signal:   int(response.Signal),
+	}
+	for _, code := range response.StageExitCodes {
+		statusResponse.StageExitCodes = append(statusResponse.StageExitCodes, int(code))
+	}
+	return statusResponse, nil
+}
+
+// GetJobOutput sends a GetOutput RPC.
+func (c *GRPCClient) GetJobOutput(jobID string) (*OutputResponse, error) {
+	response, err := c.client.GetOutput(c.authContext(context.Background()), &jobpb.GetOutputRequest{Id: jobID})
+	if err != nil {
+		return nil, grpcClientError(err)
+	}
+	return &OutputResponse{ID: response.Id, Stdout: response.Stdout, Stderr: response.Stderr}, nil
+}
+
+// GetJobLogs returns the output records written at or after since, like the HTTPS Client.
+// A zero since returns every record.
+func (c *GRPCClient) GetJobLogs(jobID string, since time.Time) ([]LogRecord, error) {
+	records := []LogRecord{}
+	err := c.streamJobLogs(context.Background(), jobID, since, false, func(record LogRecord) error {
+		records = append(records, record)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// FollowJobLogs calls fn with the output records written at or after since, then with every
+// new record as it is written, until the job exited, ctx is done, or fn returns an error.
+func (c *GRPCClient) FollowJobLogs(ctx context.Context, jobID string, since time.Time, fn func(LogRecord) error) error {
+	return c.streamJobLogs(ctx, jobID, since, true, fn)
+}
+
+func (c *GRPCClient) streamJobLogs(ctx context.Context, jobID string, since time.Time, follow bool, fn func(LogRecord) error) error {
+	request := &jobpb.StreamOutputRequest{Id: jobID, Follow: follow}
+	if !since.IsZero() {
+		request.Since = timestamppb.New(since)
+	}
+
+	stream, err := c.client.StreamOutput(c.authContext(ctx), request)
+	if err != nil {
+		return grpcClientError(err)
+	}
+
+	for {
+		record, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return grpcClientError(err)
+		}
+
+		err = fn(LogRecord{
+			Seq:    record.Seq,
+			Time:   record.Time.AsTime(),
+			Stream: record.Stream,
+			Data:   record.Data,
+		})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// ListJobs sends a List RPC, returning the jobs the user may list.
+func (c *GRPCClient) ListJobs() ([]JobListing, error) {
+	response, err := c.client.List(c.authContext(context.Background()), &jobpb.ListRequest{})
+	if err != nil {
+		return nil, grpcClientError(err)
+	}
+
+	jobs := make([]JobListing, 0, len(response.Jobs))
+	for _, listed := range response.Jobs {
+		jobs = append(jobs, JobListing{
+			ID:       listed.Id,
+			Owner:    listed.Owner,
+			Status:   listed.Status,
+			ExitCode: optionalInt(listed.ExitCode),
+			Labels:   listed.Labels,
+		})
+	}
+	return jobs, nil
+}
+
+// optionalInt converts an optional protobuf exit code.
+func optionalInt(value *int32) *int {
+	if value == nil {
+		return nil
+	}
+	converted := int(*value)
+	return &converted
+}
@@ -0,0 +1,216 @@
+package jobserver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"path/filepath"
+	"teleport-jobworker/pkg/audit"
+	"teleport-jobworker/pkg/job"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// initTestGRPC spins up an in-memory gRPC server sharing a job Server, and returns a function
+// connecting clients to it, authenticated with an access token.
+func initTestGRPC(t *testing.T, opts ...ServerOption) func(token string) *GRPCClient {
+	t.Helper()
+
+	listener := bufconn.Listen(1 << 20)
+	grpcServer := NewServer(job.NewManager(), append([]ServerOption{withTestTokens()}, opts...)...).NewGRPCServer()
+	go grpcServer.Serve(listener)
+	t.Cleanup(grpcServer.Stop)
+
+	return func(token string) *GRPCClient {
+		client, err := DialGRPC("passthrough:///bufconn", token,
+			grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+				return listener.DialContext(ctx)
+			}),
+			grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			t.Fatalf("DialGRPC() error: %s", err.Error())
+		}
+		t.Cleanup(func() { client.Close() })
+		return client
+	}
+}
+
+func TestGRPCStartJob(t *testing.T) {
+	client := initTestGRPC(t)(user1token)
+
+	response, err := client.StartJob("/bin/echo", []string{"hello world"})
+	if err != nil {
+		t.Fatalf("StartJob() error: %s", err.Error())
+	}
+
+	var status *StatusResponse
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		status, err = client.GetJobStatus(response.ID)
+		if err != nil {
+			t.Fatalf("GetJobStatus() error: %s", err.Error())
+		}
+		if status.Status == job.Completed {
+			break
+		}
+	}
+	if status.Status != job.Completed || status.ExitCode == nil || *status.ExitCode != 0 {
+		t.Errorf("GetJobStatus() expected job completed with exit code 0, got %+v", status)
+	}
+
+	output, err := client.GetJobOutput(response.ID)
+	if err != nil {
+		t.Errorf("GetJobOutput() error: %s", err.Error())
+	}
+	if output.Stdout != "hello world\n" {
+		t.Errorf("GetJobOutput() expected stdout %q, got %q", "hello world\n", output.Stdout)
+	}
+}
+
+func TestGRPCUnauthorized(t *testing.T) {
+	dial := initTestGRPC(t)
+	client := dial(user1token)
+
+	_, err := dial(fakeusertoken).StartJob("/bin/echo", []string{"hello world"})
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.Code != CodeUnauthenticated || apiErr.Message != ErrBadAuthentication ||
+		apiErr.Status != http.StatusUnauthorized {
+		t.Errorf("StartJob() expected %s, got %v", ErrBadAuthentication, err)
+	}
+
+	response, _ := client.StartJob("/bin/sleep", []string{"2"})
+	defer client.StopJob(response.ID)
+
+	// jobs of other users are not found
+	_, err = dial(user2token).GetJobStatus(response.ID)
+	if !errors.Is(err, job.ErrNotFound) {
+		t.Errorf("GetJobStatus() expected %s, got %v", job.ErrNotFound, err)
+	}
+}
+
+func TestGRPCFollowJobLogs(t *testing.T) {
+	dial := initTestGRPC(t)
+	client := dial(user1token)
+
+	response, _ := client.StartJob("/bin/sh", []string{"-c", "echo one; sleep 0.2; echo two >&2; sleep 0.2; echo three"})
+
+	var records []LogRecord
+	err := client.FollowJobLogs(context.Background(), response.ID, time.Time{}, func(record LogRecord) error {
+		records = append(records, record)
+		return nil
+	})
+	if err != nil {
+		t.Errorf("FollowJobLogs() error: %s", err.Error())
+	}
+
+	// the stream ends once the job exited
+	expected := []LogRecord{{Seq: 1, Stream: job.Stdout, Data: "one\n"}, {Seq: 2, Stream: job.Stderr, Data: "two\n"},
+		{Seq: 3, Stream: job.Stdout, Data: "three\n"}}
+	if len(records) != len(expected) {
+		t.Fatalf("FollowJobLogs() expected %d records, got %+v", len(expected), records)
+	}
+	for i, record := range records {
+		if record.Seq != expected[i].Seq || record.Stream != expected[i].Stream || record.Data != expected[i].Data {
+			t.Errorf("FollowJobLogs() expected record %+v, got %+v", expected[i], record)
+		}
+	}
+
+	_, err = dial(user2token).GetJobLogs(response.ID, time.Time{})
+	if !errors.Is(err, job.ErrNotFound) {
+		t.Errorf("GetJobLogs() expected error: %s, got: %v", job.ErrNotFound, err)
+	}
+}
+
+func TestGRPCListJobs(t *testing.T) {
+	auditLog, err := audit.Open(filepath.Join(t.TempDir(), "audit.log"))
+	if err != nil {
+		t.Fatalf("Open() error: %s", err.Error())
+	}
+	defer auditLog.Close()
+	dial := initTestGRPC(t, WithAuditLog(auditLog))
+	client := dial(user1token)
+
+	first, _ := client.StartJob("/bin/echo", []string{"hello world"})
+	second, _ := dial(user2token).StartJob("/bin/echo", []string{"hello world"})
+
+	jobs, err := client.ListJobs()
+	if err != nil {
+		t.Errorf("ListJobs() error: %s", err.Error())
+	}
+	if len(jobs) != 1 || jobs[0].ID != first.ID || jobs[0].Owner != "user1" {
+		t.Errorf("ListJobs() expected job %s of user1, got %+v", first.ID, jobs)
+	}
+
+	jobs, _ = dial(admin1token).ListJobs()
+	if len(jobs) != 2 || jobs[0].ID != first.ID || jobs[1].ID != second.ID {
+		t.Errorf("ListJobs() expected jobs %s and %s for admin, got %+v", first.ID, second.ID, jobs)
+	}
+
+	// RPCs are audited like HTTPS requests
+	records, _ := auditLog.Query(audit.Filter{Action: actionList})
+	if len(records) != 2 || records[0].User != "user1" || records[1].Role != job.Admin ||
+		records[0].Result != audit.ResultSuccess {
+		t.Errorf("Query() expected list actions of user1 and admin1, got %+v", records)
+	}
+}
+
+func TestGRPCGrantJob(t *testing.T) {
+	dial := initTestGRPC(t)
+	owner, other := dial(user1token), dial(user2token)
+
+	started, _ := owner.StartJob("/bin/echo", []string{"hello world"})
+	if _, err := other.GetJobStatus(started.ID); !errors.Is(err, job.ErrNotFound) {
+		t.Errorf("GetJobStatus() expected %s before the grant, got %v", job.ErrNotFound, err)
+	}
+
+	response, err := owner.GrantJob(started.ID, GrantRequest{Groups: []string{job.User}, Access: job.AccessControl})
+	if err != nil {
+		t.Fatalf("GrantJob() error: %s", err.Error())
+	}
+	if len(response.Grants) != 1 || response.Grants[0].Access != job.AccessControl || response.Grants[0].ExpiresAt != nil {
+		t.Errorf("GrantJob() expected a control grant without expiry, got %+v", response.Grants)
+	}
+
+	if _, err := other.SignalJob(started.ID, "TERM"); err != nil {
+		t.Errorf("SignalJob() error with control access: %s", err.Error())
+	}
+}
+
+func TestGRPCAuditCanceled(t *testing.T) {
+	auditLog, err := audit.Open(filepath.Join(t.TempDir(), "audit.log"))
+	if err != nil {
+		t.Fatalf("Open() error: %s", err.Error())
+	}
+	defer auditLog.Close()
+	s := NewServer(job.NewManager(), WithAuditLog(auditLog))
+
+	tests := []struct {
+		err           error
+		endedByClient bool
+		code          int
+		result        string
+	}{
+		{status.Error(codes.Canceled, "context canceled"), true, http.StatusOK, audit.ResultSuccess},
+		{status.Error(codes.Canceled, "context canceled"), false, statusClientClosedRequest, audit.ResultError},
+		{status.Error(codes.DeadlineExceeded, "context deadline exceeded"), false, http.StatusGatewayTimeout, audit.ResultError},
+	}
+	for _, test := range tests {
+		s.auditGRPC(&audit.Record{Action: actionStart}, test.err, test.endedByClient)
+	}
+
+	records, _ := auditLog.Query(audit.Filter{Action: actionStart})
+	if len(records) != len(tests) {
+		t.Fatalf("Query() expected %d records, got %+v", len(tests), records)
+	}
+	for i, test := range tests {
+		if records[i].Code != test.code || records[i].Result != test.result {
+			t.Errorf("auditGRPC() %v expected %d %s, got %d %s", test.err, test.code, test.result, records[i].Code, records[i].Result)
+		}
+	}
+}
@@ -3,48 +3,117 @@ package jobserver
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
 	"teleport-jobworker/pkg/job"
+	"time"
 )
 
 // StartRequest defines the Start request body.
+// A job runs either a single program, or a pipeline of commands.
 type StartRequest struct {
+	Program  string    `json:"program"`
+	Args     []string  `json:"args"`
+	Pipeline []Command `json:"pipeline,omitempty"`
+	Pipefail bool      `json:"pipefail,omitempty"`
+	Stdin    bool      `json:"stdin,omitempty"`
+	TTY      bool      `json:"tty,omitempty"`
+	// Labels are attached to the job, eg. to grant permissions on jobs by label.
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// Command defines one stage of a pipeline.
+type Command struct {
 	Program string   `json:"program"`
 	Args    []string `json:"args"`
 }
 
 // StartResponse defines the Start response body.
 type StartResponse struct {
-	ID    string  `json:"id"`
-	Error *string `json:"error"`
+	ID string `json:"id"`
 }
 
 // StopResponse defines the Stop response body.
 type StopResponse struct {
-	ID    string  `json:"id"`
-	Error *string `json:"error"`
+	ID string `json:"id"`
+}
+
+// SignalRequest defines the Signal request body.
+type SignalRequest struct {
+	// Signal is a signal name, eg. SIGTERM or HUP.
+	Signal string `json:"signal"`
+}
+
+// SignalResponse defines the Signal response body.
+type SignalResponse struct {
+	ID string `json:"id"`
+}
+
+// StdinResponse defines the WriteStdin and CloseStdin response body.
+type StdinResponse struct {
+	ID      string `json:"id"`
+	Written int64  `json:"written"`
 }
 
 // StatusResponse defines the GetStatus response body.
 type StatusResponse struct {
-	ID       string  `json:"id"`
-	Status   string  `json:"status"`
-	ExitCode *int    `json:"exitCode"`
-	Error    *string `json:"error"`
+	ID             string `json:"id"`
+	Status         string `json:"status"`
+	ExitCode       *int   `json:"exitCode"`
+	StageExitCodes []int  `json:"stageExitCodes,omitempty"`
+	// Signal is the number of the signal which terminated the job, if any, eg. 9 for SIGKILL.
+	Signal int `json:"signal,omitempty"`
+}
+
+// JobListing describes a job of the List response.
+type JobListing struct {
+	ID       string            `json:"id"`
+	Owner    string            `json:"owner"`
+	Status   string            `json:"status"`
+	ExitCode *int              `json:"exitCode"`
+	Labels   map[string]string `json:"labels,omitempty"`
+}
+
+// ListResponse defines the List response body, oldest job first.
+type ListResponse struct {
+	Jobs []JobListing `json:"jobs"`
 }
 
 // OutputResponse defines the GetOutput response body.
 type OutputResponse struct {
-	ID     string  `json:"id"`
-	Stdout string  `json:"stdout"`
-	Stderr string  `json:"stderr"`
-	Error  *string `json:"error"`
+	ID     string `json:"id"`
+	Stdout string `json:"stdout"`
+	Stderr string `json:"stderr"`
+}
+
+// LogRecord defines a single timestamped output record.
+type LogRecord struct {
+	Seq    uint64    `json:"seq"`
+	Time   time.Time `json:"time"`
+	Stream string    `json:"stream"`
+	Data   string    `json:"data"`
+}
+
+// LogsResponse defines the GetOutputRecords response body.
+type LogsResponse struct {
+	ID      string      `json:"id"`
+	Records []LogRecord `json:"records"`
 }
 
-// ErrorResponse defines error response body for status codes: 400, 401, 404, 500.
+// Log formats
+const (
+	formatJSON   = "json"
+	formatNDJSON = "ndjson"
+)
+
+// ErrorResponse defines the error response body of every endpoint.
 type ErrorResponse struct {
-	Error string `json:"error"`
+	Error Error `json:"error"`
 }
 
 // responseJSON prepares the response body as JSON.
@@ -57,37 +126,140 @@ func responseJSON(w http.ResponseWriter, payload any, code int) {
 	}
 }
 
-// responseError prepares the error response body as JSON.
-func responseError(w http.ResponseWriter, err error) {
-	if errors.Is(err, job.ErrNotFound) {
-		responseJSON(w, ErrorResponse{err.Error()}, http.StatusNotFound)
-		return
+// decodeJSON decodes the JSON request body into v, rejecting unknown fields and bodies larger than
+// maxRequestBody. A malformed body is reported as an INVALID_REQUEST error, naming the offending field
+// when there is one.
+func decodeJSON(w http.ResponseWriter, r *http.Request, v any) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBody))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(v)
+	if err == nil {
+		return nil
 	}
-	if errors.Is(err, job.ErrUnauthorized) {
-		responseJSON(w, ErrorResponse{err.Error()}, http.StatusUnauthorized)
-		return
+
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var sizeErr *http.MaxBytesError
+	switch {
+	case errors.Is(err, io.EOF):
+		return invalidRequest("request body is empty")
+	case errors.As(err, &sizeErr):
+		return invalidRequest("request body exceeds %d bytes", sizeErr.Limit)
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return invalidRequest("request body is truncated JSON")
+	case errors.As(err, &syntaxErr):
+		return newError(CodeInvalidRequest, fmt.Sprintf("request body is malformed JSON at offset %d", syntaxErr.Offset),
+			map[string]string{"offset": strconv.FormatInt(syntaxErr.Offset, 10)})
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		return invalidField(typeErr.Field, "field %s must be %s", typeErr.Field, jsonKind(typeErr.Type.Kind()))
 	}
-	responseJSON(w, ErrorResponse{err.Error()}, http.StatusInternalServerError)
+	// encoding/json reports unknown fields without a dedicated error type
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		field, _ = strconv.Unquote(field)
+		return invalidField(field, "unknown field %s", field)
+	}
+	return invalidRequest("request body must be a JSON object")
 }
 
-// startHandler handles HTTPS requests to POST /jobs/start
+// jsonKind describes the JSON value expected for a Go kind.
+func jsonKind(kind reflect.Kind) string {
+	switch kind {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Map, reflect.Struct:
+		return "an object"
+	}
+	return "a number"
+}
+
+// startHandler handles HTTPS requests to POST /v1/jobs/start
 func (s *Server) startHandler(w http.ResponseWriter, r *http.Request) {
 	var startRequest StartRequest
-	if err := json.NewDecoder(r.Body).Decode(&startRequest); err != nil {
-		responseJSON(w, ErrorResponse{err.Error()}, http.StatusBadRequest)
+	if err := decodeJSON(w, r, &startRequest); err != nil {
+		responseError(w, err)
 		return
 	}
 
-	jobID, err := s.manager.Start(r.Context(), startRequest.Program, startRequest.Args)
+	commands, field := []job.Command{{Program: startRequest.Program, Args: startRequest.Args}}, ""
+	if len(startRequest.Pipeline) > 0 {
+		if startRequest.Program != "" {
+			responseError(w, invalidField("program", "program and pipeline are mutually exclusive"))
+			return
+		}
+
+		commands, field = make([]job.Command, 0, len(startRequest.Pipeline)), "pipeline"
+		for _, command := range startRequest.Pipeline {
+			commands = append(commands, job.Command(command))
+		}
+	}
+
+	var opts []job.StartOption
+	if startRequest.Pipefail {
+		opts = append(opts, job.WithPipefail())
+	}
+	if startRequest.Stdin {
+		opts = append(opts, job.WithStdin())
+	}
+	if startRequest.TTY {
+		opts = append(opts, job.WithTTY())
+	}
+	if len(startRequest.Labels) > 0 {
+		opts = append(opts, job.WithLabels(startRequest.Labels))
+	}
+
+	record := auditRecord(r.Context())
+	auditCommands(record, commands)
+	// validating the commands looks the programs up, which is only for users who may start them
+	if err := s.manager.AuthorizeStart(r.Context(), commands, opts...); err != nil {
+		responseError(w, err)
+		return
+	}
+	if err := validateCommands(commands, field); err != nil {
+		responseError(w, err)
+		return
+	}
+
+	start := func() (string, error) {
+		return s.manager.StartPipeline(r.Context(), commands, opts...)
+	}
+
+	// with an idempotency key, a retried request returns the job started by the original request
+	var jobID string
+	var err error
+	if key := r.Header.Get(IdempotencyKeyHeader); key != "" {
+		if len(key) > maxIdempotencyKeyLength {
+			responseError(w, newError(CodeInvalidRequest,
+				fmt.Sprintf("idempotency key must be at most %d bytes", maxIdempotencyKeyLength),
+				map[string]string{"header": IdempotencyKeyHeader}))
+			return
+		}
+
+		userID, _, _ := job.UserInfo(r.Context())
+		request, _ := json.Marshal(startRequest)
+
+		var replayed bool
+		jobID, replayed, err = s.idempotency.do(userID, key, request, start)
+		if replayed {
+			w.Header().Set(IdempotentReplayedHeader, "true")
+		}
+	} else {
+		jobID, err = start()
+	}
+
 	if err != nil {
 		responseError(w, err)
 		return
 	}
 
+	record.JobID = jobID
 	responseJSON(w, StartResponse{ID: jobID}, http.StatusCreated)
 }
 
-// stopHandler handles HTTPS requests to POST /jobs/{id}/stop
+// stopHandler handles HTTPS requests to POST /v1/jobs/{id}/stop
 func (s *Server) stopHandler(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
 
@@ -100,7 +272,59 @@ func (s *Server) stopHandler(w http.ResponseWriter, r *http.Request) {
 	responseJSON(w, StopResponse{ID: id}, http.StatusOK)
 }
 
-// getStatusHandler handles HTTPS requests to GET /jobs/{id}
+// signalHandler handles HTTPS requests to POST /v1/jobs/{id}/signal
+func (s *Server) signalHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	var signalRequest SignalRequest
+	if err := decodeJSON(w, r, &signalRequest); err != nil {
+		responseError(w, err)
+		return
+	}
+	auditRecord(r.Context()).Args = []string{signalRequest.Signal}
+
+	sig, err := job.ParseSignal(signalRequest.Signal)
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+
+	if err := s.manager.Signal(r.Context(), id, sig); err != nil {
+		responseError(w, err)
+		return
+	}
+
+	responseJSON(w, SignalResponse{ID: id}, http.StatusOK)
+}
+
+// writeStdinHandler handles HTTPS requests to POST /v1/jobs/{id}/stdin
+// The request body is streamed into the job's stdin as it arrives.
+func (s *Server) writeStdinHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	written, err := s.manager.WriteStdin(r.Context(), id, r.Body)
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+
+	responseJSON(w, StdinResponse{ID: id, Written: written}, http.StatusOK)
+}
+
+// closeStdinHandler handles HTTPS requests to POST /v1/jobs/{id}/stdin/close
+func (s *Server) closeStdinHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	err := s.manager.CloseStdin(r.Context(), id)
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+
+	responseJSON(w, StdinResponse{ID: id}, http.StatusOK)
+}
+
+// getStatusHandler handles HTTPS requests to GET /v1/jobs/{id}
 func (s *Server) getStatusHandler(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
 
@@ -111,13 +335,37 @@ func (s *Server) getStatusHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	responseJSON(w, StatusResponse{
-		ID:       id,
-		Status:   status.State,
-		ExitCode: status.ExitCode,
+		ID:             id,
+		Status:         status.State,
+		ExitCode:       status.ExitCode,
+		StageExitCodes: status.StageExitCodes,
+		Signal:         int(status.Signal),
 	}, http.StatusOK)
 }
 
-// getOutputHandler handles HTTPS requests to GET /jobs/{id}/output
+// listHandler handles HTTPS requests to GET /v1/jobs, listing the jobs the user may list,
+// eg. its own jobs, or every job for admins.
+func (s *Server) listHandler(w http.ResponseWriter, r *http.Request) {
+	jobs, err := s.manager.List(r.Context())
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+
+	response := ListResponse{Jobs: make([]JobListing, 0, len(jobs))}
+	for _, info := range jobs {
+		response.Jobs = append(response.Jobs, JobListing{
+			ID:       info.ID,
+			Owner:    info.UserID,
+			Status:   info.Status.State,
+			ExitCode: info.Status.ExitCode,
+			Labels:   info.Labels,
+		})
+	}
+	responseJSON(w, response, http.StatusOK)
+}
+
+// getOutputHandler handles HTTPS requests to GET /v1/jobs/{id}/output
 func (s *Server) getOutputHandler(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
 
@@ -133,3 +381,92 @@ func (s *Server) getOutputHandler(w http.ResponseWriter, r *http.Request) {
 		Stderr: stderr,
 	}, http.StatusOK)
 }
+
+// getLogsHandler handles HTTPS requests to GET /v1/jobs/{id}/logs?since=<ts>&format=<json|ndjson>&follow=<bool>
+// With follow, ndjson records are streamed as they are written, until the job exited.
+func (s *Server) getLogsHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	var since time.Time
+	if value := r.URL.Query().Get("since"); value != "" {
+		var err error
+		since, err = time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			responseError(w, invalidParameter("since", "invalid since timestamp %q, expected RFC 3339", value))
+			return
+		}
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = formatJSON
+	}
+	if format != formatJSON && format != formatNDJSON {
+		responseError(w, invalidParameter("format", "unsupported format %q", format))
+		return
+	}
+
+	var follow bool
+	if value := r.URL.Query().Get("follow"); value != "" {
+		var err error
+		follow, err = strconv.ParseBool(value)
+		if err != nil {
+			responseError(w, invalidParameter("follow", "invalid follow %q, expected true or false", value))
+			return
+		}
+		if follow && format != formatNDJSON {
+			responseError(w, invalidParameter("follow", "follow requires format %s", formatNDJSON))
+			return
+		}
+	}
+
+	records, err := s.manager.GetOutputRecords(r.Context(), id, since)
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+
+	logRecords := make([]LogRecord, 0, len(records))
+	for _, record := range records {
+		logRecords = append(logRecords, LogRecord(record))
+	}
+
+	if format == formatJSON {
+		responseJSON(w, LogsResponse{ID: id, Records: logRecords}, http.StatusOK)
+		return
+	}
+
+	// ndjson: one record per line, in sequence order
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	encoder := json.NewEncoder(w)
+	for _, record := range logRecords {
+		if err := encoder.Encode(record); err != nil {
+			log.Printf("json.Encoder.Encode() failed to encode log record: %v", err)
+			return
+		}
+	}
+	if !follow {
+		return
+	}
+
+	// follow new records, skipping the records already sent
+	var lastSeq uint64
+	if len(records) > 0 {
+		lastSeq = records[len(records)-1].Seq
+	}
+	controller := http.NewResponseController(w)
+	controller.Flush()
+	err = s.manager.FollowOutput(r.Context(), id, since, func(record job.OutputRecord) error {
+		if record.Seq <= lastSeq {
+			return nil
+		}
+		if err := encoder.Encode(LogRecord(record)); err != nil {
+			return err
+		}
+		return controller.Flush()
+	})
+	if err != nil && r.Context().Err() == nil {
+		log.Printf("failed to follow output of job %s: %v", id, err)
+	}
+}
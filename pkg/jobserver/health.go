@@ -0,0 +1,128 @@
+package jobserver
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"teleport-jobworker/pkg/version"
+	"time"
+)
+
+const actionInfo = "info"
+
+// Health statuses
+const (
+	statusOK          = "ok"
+	statusUnavailable = "unavailable"
+)
+
+// HealthResponse defines the /healthz and /readyz response body.
+type HealthResponse struct {
+	Status string `json:"status"`
+	// Checks maps each readiness check to "ok", or to the reason it failed.
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// InfoResponse defines the Info response body.
+type InfoResponse struct {
+	Version    string    `json:"version"`
+	Commit     string    `json:"commit"`
+	APIVersion string    `json:"apiVersion"`
+	StartedAt  time.Time `json:"startedAt"`
+	// UptimeSeconds is the time since the server started, in seconds.
+	UptimeSeconds int64 `json:"uptimeSeconds"`
+	// Features are the optional features enabled on the server, eg. login or grpc.
+	Features []string   `json:"features"`
+	Limits   InfoLimits `json:"limits"`
+}
+
+// InfoLimits defines the limits of the server. Zero job limits mean no limit.
+type InfoLimits struct {
+	MaxJobs        int `json:"maxJobs"`
+	MaxJobsPerUser int `json:"maxJobsPerUser"`
+	MaxRequestBody int `json:"maxRequestBody"`
+	MaxArgs        int `json:"maxArgs"`
+	MaxArgsSize    int `json:"maxArgsSize"`
+}
+
+// readinessCheck is a named check of GET /readyz.
+type readinessCheck struct {
+	name  string
+	check func() error
+}
+
+// WithReadinessCheck adds a check to GET /readyz, eg. that a data directory is writable.
+// The server is ready when every check returns nil.
+func WithReadinessCheck(name string, check func() error) ServerOption {
+	return func(s *Server) {
+		s.readinessChecks = append(s.readinessChecks, readinessCheck{name: name, check: check})
+	}
+}
+
+// healthzHandler handles requests to GET /healthz, without authentication: the server is live
+// as long as it answers.
+func (s *Server) healthzHandler(w http.ResponseWriter, r *http.Request) {
+	responseJSON(w, HealthResponse{Status: statusOK}, http.StatusOK)
+}
+
+// readyzHandler handles requests to GET /readyz, without authentication: the server is ready
+// to accept jobs unless it is draining or a readiness check fails.
+func (s *Server) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	response := HealthResponse{Status: statusOK, Checks: map[string]string{"draining": statusOK}}
+	if s.manager.Draining() {
+		response.Checks["draining"] = "shutting down, new jobs are refused"
+		response.Status = statusUnavailable
+	}
+	for _, readiness := range s.readinessChecks {
+		response.Checks[readiness.name] = statusOK
+		if err := readiness.check(); err != nil {
+			response.Checks[readiness.name] = err.Error()
+			response.Status = statusUnavailable
+		}
+	}
+
+	code := http.StatusOK
+	if response.Status != statusOK {
+		code = http.StatusServiceUnavailable
+	}
+	responseJSON(w, response, code)
+}
+
+// infoHandler handles HTTPS requests to GET /v1/info
+func (s *Server) infoHandler(w http.ResponseWriter, r *http.Request) {
+	maxJobs, maxJobsPerUser := s.manager.JobLimits()
+	responseJSON(w, InfoResponse{
+		Version:       version.Version,
+		Commit:        version.BuildCommit(),
+		APIVersion:    strings.TrimPrefix(APIPrefix, "/"),
+		StartedAt:     s.startedAt,
+		UptimeSeconds: int64(time.Since(s.startedAt).Seconds()),
+		Features:      s.features(),
+		Limits: InfoLimits{
+			MaxJobs:        maxJobs,
+			MaxJobsPerUser: maxJobsPerUser,
+			MaxRequestBody: maxRequestBody,
+			MaxArgs:        maxArgs,
+			MaxArgsSize:    maxArgsSize,
+		},
+	}, http.StatusOK)
+}
+
+// features lists the optional features enabled on the server.
+func (s *Server) features() []string {
+	features := []string{}
+	for feature, enabled := range map[string]bool{
+		"tokens":    s.verifier != nil && s.mutualTLS == nil,
+		"login":     s.login != nil && s.verifier != nil,
+		"mutualTLS": s.mutualTLS != nil,
+		"audit":     s.auditLog != nil,
+		"metrics":   s.metrics != nil && s.metricsEndpoint,
+		"grpc":      s.grpcEnabled.Load(),
+	} {
+		if enabled {
+			features = append(features, feature)
+		}
+	}
+	slices.Sort(features)
+	return features
+}
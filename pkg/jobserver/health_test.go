@@ -0,0 +1,88 @@
+package jobserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"teleport-jobworker/pkg/job"
+	"testing"
+)
+
+func TestHealthz(t *testing.T) {
+	ts, _ := initTestServer(t)
+
+	response, err := ts.Client().Get(ts.URL + "/healthz")
+	if err != nil {
+		t.Fatalf("Get() error: %s", err.Error())
+	}
+	defer response.Body.Close()
+
+	var health HealthResponse
+	json.NewDecoder(response.Body).Decode(&health)
+	if response.StatusCode != http.StatusOK || health.Status != statusOK {
+		t.Errorf("GET /healthz expected 200 %s, got %d %+v", statusOK, response.StatusCode, health)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	var checkErr error
+	manager := job.NewManager()
+	ts := httptest.NewTLSServer(NewServer(manager, withTestTokens(),
+		WithReadinessCheck("dataDir", func() error { return checkErr })))
+	t.Cleanup(ts.Close)
+
+	readyz := func() (int, HealthResponse) {
+		t.Helper()
+		response, err := ts.Client().Get(ts.URL + "/readyz")
+		if err != nil {
+			t.Fatalf("Get() error: %s", err.Error())
+		}
+		defer response.Body.Close()
+
+		var health HealthResponse
+		json.NewDecoder(response.Body).Decode(&health)
+		return response.StatusCode, health
+	}
+
+	if code, health := readyz(); code != http.StatusOK || health.Checks["dataDir"] != statusOK || health.Checks["draining"] != statusOK {
+		t.Errorf("GET /readyz expected 200 with every check ok, got %d %+v", code, health)
+	}
+
+	checkErr = errors.New("data directory is not writable")
+	if code, health := readyz(); code != http.StatusServiceUnavailable || health.Checks["dataDir"] != checkErr.Error() {
+		t.Errorf("GET /readyz expected 503 with dataDir %q, got %d %+v", checkErr, code, health)
+	}
+
+	checkErr = nil
+	if _, err := manager.Shutdown(context.Background(), job.ShutdownWait); err != nil {
+		t.Fatalf("Shutdown() error: %s", err.Error())
+	}
+	if code, health := readyz(); code != http.StatusServiceUnavailable || health.Checks["draining"] == statusOK {
+		t.Errorf("GET /readyz expected 503 while draining, got %d %+v", code, health)
+	}
+}
+
+func TestInfo(t *testing.T) {
+	ts, _ := initTestServer(t)
+
+	if _, err := testClient(ts, "").GetInfo(); !errors.Is(err, &Error{Code: CodeUnauthenticated}) {
+		t.Errorf("GetInfo() expected %s without a token, got %v", CodeUnauthenticated, err)
+	}
+
+	info, err := testClient(ts, user1token).GetInfo()
+	if err != nil {
+		t.Fatalf("GetInfo() error: %s", err.Error())
+	}
+	if info.APIVersion != "v1" || info.Version == "" || info.StartedAt.IsZero() {
+		t.Errorf("GetInfo() unexpected version: %+v", info)
+	}
+	if !slices.Contains(info.Features, "tokens") || slices.Contains(info.Features, "mutualTLS") {
+		t.Errorf("GetInfo() unexpected features: %v", info.Features)
+	}
+	if info.Limits.MaxRequestBody != maxRequestBody || info.Limits.MaxArgs != maxArgs {
+		t.Errorf("GetInfo() unexpected limits: %+v", info.Limits)
+	}
+}
@@ -0,0 +1,150 @@
+package jobserver
+
+import (
+	"crypto/sha256"
+	"errors"
+	"sync"
+	"time"
+)
+
+// IdempotencyKeyHeader carries a client-generated key making POST /jobs/start safe to retry.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// IdempotentReplayedHeader is set on responses replayed from an earlier request with the same key.
+const IdempotentReplayedHeader = "Idempotent-Replayed"
+
+// DefaultIdempotencyWindow is how long an idempotency key is remembered by default.
+const DefaultIdempotencyWindow = 24 * time.Hour
+
+// Bounds of the idempotency keys remembered, so clients cannot grow the memory of the server without bound.
+const (
+	maxIdempotencyKeyLength   = 255
+	maxIdempotencyKeysPerUser = 1000
+)
+
+var errIdempotencyConflict = errors.New("idempotency key was already used with a different request")
+var errTooManyIdempotencyKeys = errors.New("too many idempotency keys used within the idempotency window")
+
+// idempotencyStore remembers the job started for each (user, key) pair during a window,
+// so retried start requests return the original job ID instead of starting a new job.
+type idempotencyStore struct {
+	window     time.Duration
+	maxPerUser int
+	entries    map[idempotencyKey]idempotencyEntry
+	// pending is closed once the start in progress with a key is done
+	pending map[idempotencyKey]chan struct{}
+	// userKeys counts the entries and pending starts of each user
+	userKeys  map[string]int
+	lastSweep time.Time
+	mutex     sync.Mutex
+}
+
+// idempotencyKey scopes client keys to the user who sent them.
+type idempotencyKey struct {
+	userID string
+	key    string
+}
+
+// idempotencyEntry records the request a key was first used with, and the job it started.
+type idempotencyEntry struct {
+	requestHash [sha256.Size]byte
+	jobID       string
+	expires     time.Time
+}
+
+func newIdempotencyStore(window time.Duration) *idempotencyStore {
+	return &idempotencyStore{
+		window:     window,
+		maxPerUser: maxIdempotencyKeysPerUser,
+		entries:    map[idempotencyKey]idempotencyEntry{},
+		pending:    map[idempotencyKey]chan struct{}{},
+		userKeys:   map[string]int{},
+	}
+}
+
+// do runs start once per (userID, key) pair within the window, and returns its job ID.
+// Repeated calls with an identical request return the original job ID with replayed set,
+// while a different request returns errIdempotencyConflict.
+// Failed starts are not remembered, so they can be retried with the same key.
+// Concurrent calls with the same key wait for the first one, while other keys start concurrently.
+// Users with too many keys within the window get errTooManyIdempotencyKeys.
+func (s *idempotencyStore) do(userID, key string, request []byte, start func() (string, error)) (jobID string, replayed bool, err error) {
+	requestHash := sha256.Sum256(request)
+	entryKey := idempotencyKey{userID, key}
+
+	s.mutex.Lock()
+	for {
+		now := time.Now()
+		s.sweep(now, false)
+
+		if entry, ok := s.entries[entryKey]; ok && now.Before(entry.expires) {
+			s.mutex.Unlock()
+			if entry.requestHash != requestHash {
+				return "", false, errIdempotencyConflict
+			}
+			return entry.jobID, true, nil
+		}
+
+		// a concurrent retry is starting the job, wait for its entry
+		done, ok := s.pending[entryKey]
+		if !ok {
+			break
+		}
+		s.mutex.Unlock()
+		<-done
+		s.mutex.Lock()
+	}
+
+	if s.userKeys[userID] >= s.maxPerUser {
+		s.sweep(time.Now(), true)
+		if s.userKeys[userID] >= s.maxPerUser {
+			s.mutex.Unlock()
+			return "", false, errTooManyIdempotencyKeys
+		}
+	}
+	done := make(chan struct{})
+	s.pending[entryKey] = done
+	s.userKeys[userID]++
+	s.mutex.Unlock()
+
+	jobID, err = start()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.pending, entryKey)
+	close(done)
+
+	if err != nil {
+		s.removeUserKey(userID)
+		return "", false, err
+	}
+	s.entries[entryKey] = idempotencyEntry{
+		requestHash: requestHash,
+		jobID:       jobID,
+		expires:     time.Now().Add(s.window),
+	}
+	return jobID, false, nil
+}
+
+// sweep drops expired entries, at most once per window fraction unless forced. Caller must hold mutex.
+func (s *idempotencyStore) sweep(now time.Time, force bool) {
+	if !force && now.Sub(s.lastSweep) < s.window/10 {
+		return
+	}
+	s.lastSweep = now
+
+	for key, entry := range s.entries {
+		if !now.Before(entry.expires) {
+			delete(s.entries, key)
+			s.removeUserKey(key.userID)
+		}
+	}
+}
+
+// removeUserKey uncounts a key of userID. Caller must hold mutex.
+func (s *idempotencyStore) removeUserKey(userID string) {
+	s.userKeys[userID]--
+	if s.userKeys[userID] <= 0 {
+		delete(s.userKeys, userID)
+	}
+}
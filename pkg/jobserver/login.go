@@ -0,0 +1,181 @@
+package jobserver
+
+import (
+	"errors"
+	"net/http"
+	"teleport-jobworker/pkg/token"
+	"time"
+)
+
+// Default lifetimes of the tokens issued by login.
+const (
+	DefaultAccessTokenTTL  = 15 * time.Minute
+	DefaultRefreshTokenTTL = 7 * 24 * time.Hour
+)
+
+// Audited actions of the login endpoints
+const (
+	actionLogin   = "login"
+	actionRefresh = "refresh"
+	actionLogout  = "logout"
+)
+
+// Authentication failure reason of logins, reported in metrics
+const authInvalidCredentials = "invalid_credentials"
+
+// LoginRequest defines the Login request body.
+type LoginRequest struct {
+	User     string `json:"user"`
+	Password string `json:"password"`
+}
+
+// RefreshRequest defines the Refresh and Logout request body.
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+// TokenResponse defines the Login and Refresh response body.
+type TokenResponse struct {
+	AccessToken      string    `json:"accessToken"`
+	ExpiresAt        time.Time `json:"expiresAt"`
+	RefreshToken     string    `json:"refreshToken"`
+	RefreshExpiresAt time.Time `json:"refreshExpiresAt"`
+}
+
+// login holds the users and token lifetimes of the login endpoints.
+type login struct {
+	users      *token.Users
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+}
+
+// WithLogin serves POST /auth/login, checking passwords against users, and POST /auth/refresh
+// and POST /auth/logout. Tokens are issued by the verifier set with WithTokenVerifier.
+func WithLogin(users *token.Users, accessTTL, refreshTTL time.Duration) ServerOption {
+	return func(s *Server) {
+		s.login = &login{users: users, accessTTL: accessTTL, refreshTTL: refreshTTL}
+	}
+}
+
+// issueTokens responds with a new access token and refresh token for user.
+func (s *Server) issueTokens(w http.ResponseWriter, user, role string) {
+	accessToken, accessClaims, err := s.verifier.Issue(user, role, token.TypeAccess, s.login.accessTTL)
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+	refreshToken, refreshClaims, err := s.verifier.Issue(user, role, token.TypeRefresh, s.login.refreshTTL)
+	if err != nil {
+		responseError(w, err)
+		return
+	}
+
+	responseJSON(w, TokenResponse{
+		AccessToken:      accessToken,
+		ExpiresAt:        accessClaims.Expiry(),
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: refreshClaims.Expiry(),
+	}, http.StatusOK)
+}
+
+// loginHandler handles HTTPS requests to POST /v1/auth/login
+func (s *Server) loginHandler(w http.ResponseWriter, r *http.Request) {
+	var loginRequest LoginRequest
+	if err := decodeJSON(w, r, &loginRequest); err != nil {
+		responseError(w, err)
+		return
+	}
+
+	record := auditRecord(r.Context())
+	record.User = loginRequest.User
+
+	role, err := s.login.users.Authenticate(loginRequest.User, loginRequest.Password)
+	if err != nil {
+		s.authFailure(authInvalidCredentials)
+		responseError(w, err)
+		return
+	}
+	record.Role = role
+
+	s.issueTokens(w, loginRequest.User, role)
+}
+
+// refreshHandler handles HTTPS requests to POST /v1/auth/refresh.
+// The refresh token is rotated: the one used is revoked, and a new one is issued.
+func (s *Server) refreshHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := s.refreshClaims(w, r)
+	if !ok {
+		return
+	}
+
+	// the current role applies, and removed users can no longer refresh
+	role, ok := s.login.users.Role(claims.Subject)
+	if !ok {
+		s.authFailure(authInvalidCredentials)
+		responseError(w, unauthenticated())
+		return
+	}
+	auditRecord(r.Context()).Role = role
+
+	if err := s.revokeRefreshToken(w, claims); err != nil {
+		return
+	}
+	s.issueTokens(w, claims.Subject, role)
+}
+
+// logoutHandler handles HTTPS requests to POST /v1/auth/logout, revoking the refresh token,
+// and the access token of the Authorization header, if any.
+func (s *Server) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := s.refreshClaims(w, r)
+	if !ok {
+		return
+	}
+	auditRecord(r.Context()).Role = claims.Role
+
+	if err := s.revokeRefreshToken(w, claims); err != nil {
+		return
+	}
+
+	if accessToken, ok := bearerToken(r.Header.Get("Authorization")); ok {
+		if accessClaims, err := s.verifier.Verify(accessToken); err == nil && accessClaims.Subject == claims.Subject {
+			if err := s.verifier.Revoke(accessClaims); err != nil && !errors.Is(err, token.ErrRevoked) {
+				responseError(w, err)
+				return
+			}
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// refreshClaims decodes and verifies the refresh token of a request body.
+// Responds with an error and returns false if the refresh token is invalid.
+func (s *Server) refreshClaims(w http.ResponseWriter, r *http.Request) (token.Claims, bool) {
+	var refreshRequest RefreshRequest
+	if err := decodeJSON(w, r, &refreshRequest); err != nil {
+		responseError(w, err)
+		return token.Claims{}, false
+	}
+
+	claims, err := s.verifier.VerifyRefresh(refreshRequest.RefreshToken)
+	if err != nil {
+		s.authFailure(tokenFailureReason(err))
+		responseError(w, unauthenticated())
+		return token.Claims{}, false
+	}
+	auditRecord(r.Context()).User = claims.Subject
+	return claims, true
+}
+
+// revokeRefreshToken revokes a refresh token on use. Responds with an error if revoking failed,
+// including when a concurrent request already used the refresh token.
+func (s *Server) revokeRefreshToken(w http.ResponseWriter, claims token.Claims) error {
+	err := s.verifier.Revoke(claims)
+	if errors.Is(err, token.ErrRevoked) {
+		s.authFailure(authRevokedToken)
+		responseError(w, unauthenticated())
+	} else if err != nil {
+		responseError(w, err)
+	}
+	return err
+}
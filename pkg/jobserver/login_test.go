@@ -0,0 +1,101 @@
+package jobserver
+
+import (
+	"errors"
+	"net/http/httptest"
+	"path/filepath"
+	"teleport-jobworker/pkg/job"
+	"teleport-jobworker/pkg/token"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// initLoginServer spins up a test HTTPS API server with login for user1, whose password is "secret".
+func initLoginServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	dir := t.TempDir()
+	keysPath, usersPath := filepath.Join(dir, "keys.json"), filepath.Join(dir, "users.json")
+	testKeys.Save(keysPath)
+	hash, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	file := token.UserFile{Users: []token.User{{Name: "user1", Role: job.User, PasswordHash: string(hash)}}}
+	file.Save(usersPath)
+
+	verifier, err := token.LoadVerifier(keysPath, filepath.Join(dir, "revoked.json"), DefaultAudience)
+	if err != nil {
+		t.Fatalf("LoadVerifier() error: %s", err.Error())
+	}
+	users, err := token.LoadUsers(usersPath)
+	if err != nil {
+		t.Fatalf("LoadUsers() error: %s", err.Error())
+	}
+
+	ts := httptest.NewTLSServer(NewServer(job.NewManager(), WithTokenVerifier(verifier),
+		WithLogin(users, time.Minute, time.Hour)))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestLogin(t *testing.T) {
+	ts := initLoginServer(t)
+	client := testClient(ts, "")
+
+	_, err := client.Login("user1", "wrong")
+	if !errors.Is(err, token.ErrInvalidCredentials) || err.Error() != token.ErrInvalidCredentials.Error() {
+		t.Errorf("Login() expected %s, got %v", token.ErrInvalidCredentials, err)
+	}
+
+	response, err := client.Login("user1", "secret")
+	if err != nil {
+		t.Fatalf("Login() error: %s", err.Error())
+	}
+	if time.Until(response.ExpiresAt) > time.Minute || time.Until(response.RefreshExpiresAt) < 59*time.Minute {
+		t.Errorf("Login() unexpected expiration times: %v, %v", response.ExpiresAt, response.RefreshExpiresAt)
+	}
+
+	// the access token authenticates requests, unlike the refresh token
+	_, err = testClient(ts, response.AccessToken).GetJobStatus("fake_id")
+	if !errors.Is(err, job.ErrNotFound) {
+		t.Errorf("GetJobStatus() expected %s, got %v", job.ErrNotFound, err)
+	}
+	_, err = testClient(ts, response.RefreshToken).GetJobStatus("fake_id")
+	if !errors.Is(err, job.ErrUnauthorized) {
+		t.Errorf("GetJobStatus() with refresh token expected %s, got %v", ErrBadAuthentication, err)
+	}
+}
+
+func TestRefreshLogout(t *testing.T) {
+	ts := initLoginServer(t)
+	login, _ := testClient(ts, "").Login("user1", "secret")
+
+	refreshed, err := testClient(ts, "").RefreshToken(login.RefreshToken)
+	if err != nil {
+		t.Fatalf("RefreshToken() error: %s", err.Error())
+	}
+	if refreshed.AccessToken == "" || refreshed.RefreshToken == login.RefreshToken {
+		t.Errorf("RefreshToken() expected new tokens, got %+v", refreshed)
+	}
+
+	// refresh tokens are rotated on use
+	_, err = testClient(ts, "").RefreshToken(login.RefreshToken)
+	if !errors.Is(err, job.ErrUnauthorized) {
+		t.Errorf("RefreshToken() reused expected %s, got %v", ErrBadAuthentication, err)
+	}
+
+	client := testClient(ts, refreshed.AccessToken)
+	if err := client.Logout(refreshed.RefreshToken); err != nil {
+		t.Errorf("Logout() error: %s", err.Error())
+	}
+
+	// logout revokes both tokens
+	_, err = client.GetJobStatus("fake_id")
+	if !errors.Is(err, job.ErrUnauthorized) {
+		t.Errorf("GetJobStatus() after logout expected %s, got %v", ErrBadAuthentication, err)
+	}
+	_, err = testClient(ts, "").RefreshToken(refreshed.RefreshToken)
+	if !errors.Is(err, job.ErrUnauthorized) {
+		t.Errorf("RefreshToken() after logout expected %s, got %v", ErrBadAuthentication, err)
+	}
+}
@@ -0,0 +1,247 @@
+package jobserver
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"sync"
+	"sync/atomic"
+	"teleport-jobworker/internal/fileutil"
+	"time"
+)
+
+var ErrRevokedCertificate = errors.New("client certificate revoked")
+
+// Authentication failure reasons of client certificates, reported in metrics
+const (
+	authMissingCertificate = "missing_certificate"
+	authInvalidCertificate = "invalid_certificate"
+)
+
+// MutualTLS authenticates users by client certificates signed by a user CA,
+// instead of Bearer tokens. The user ID is the certificate's subject common name,
+// and the role its subject organizational unit (user or admin).
+type MutualTLS struct {
+	userCAs *x509.CertPool
+	caCerts []*x509.Certificate
+
+	// revoked is replaced as a whole by Revoke and reloads, and read without the mutex
+	revoked atomic.Pointer[revokedSet]
+	mutex   sync.Mutex
+	crlFile fileutil.Watched
+}
+
+// revokedCertificate identifies a certificate by its issuer and serial number,
+// since serial numbers are only unique for an issuer.
+type revokedCertificate struct {
+	issuer string
+	serial string
+}
+
+// revokedSet holds the revoked client certificates.
+type revokedSet map[revokedCertificate]bool
+
+// contains reports whether cert is revoked.
+func (s revokedSet) contains(cert *x509.Certificate) bool {
+	return s[revokedCertificate{issuer: string(cert.RawIssuer), serial: cert.SerialNumber.String()}]
+}
+
+// LoadMutualTLS loads the PEM certificates of the user CA from caFile and,
+// if crlFile is not empty, a PEM or DER revocation list signed by the user CA,
+// which is reloaded when it changes (see Watch), or on Reload.
+func LoadMutualTLS(caFile, crlFile string) (*MutualTLS, error) {
+	caPEM, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var caCerts []*x509.Certificate
+	for block, rest := pem.Decode(caPEM); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		caCert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("user CA %s: %w", caFile, err)
+		}
+		caCerts = append(caCerts, caCert)
+	}
+	if len(caCerts) == 0 {
+		return nil, fmt.Errorf("user CA %s: no PEM certificate found", caFile)
+	}
+
+	mutualTLS := NewMutualTLS(caCerts...)
+	if crlFile == "" {
+		return mutualTLS, nil
+	}
+
+	mutualTLS.crlFile = fileutil.Watched{Path: crlFile}
+	mutualTLS.crlFile.Changed()
+	if err := mutualTLS.Reload(); err != nil {
+		return nil, err
+	}
+	return mutualTLS, nil
+}
+
+// NewMutualTLS creates a MutualTLS trusting client certificates signed by caCerts.
+func NewMutualTLS(caCerts ...*x509.Certificate) *MutualTLS {
+	userCAs := x509.NewCertPool()
+	for _, caCert := range caCerts {
+		userCAs.AddCert(caCert)
+	}
+
+	m := &MutualTLS{userCAs: userCAs, caCerts: caCerts}
+	m.revoked.Store(&revokedSet{})
+	return m
+}
+
+// Revoke rejects the client certificates listed in crl, in addition to those already revoked,
+// once its signature is verified against one of caCerts.
+func (m *MutualTLS) Revoke(crl *x509.RevocationList, caCerts ...*x509.Certificate) error {
+	listed, err := revokedCertificates(crl, caCerts)
+	if err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	revoked := maps.Clone(*m.revoked.Load())
+	maps.Copy(revoked, listed)
+	m.revoked.Store(&revoked)
+	return nil
+}
+
+// revokedCertificates returns the certificates listed in crl, once its signature is verified
+// against one of caCerts.
+func revokedCertificates(crl *x509.RevocationList, caCerts []*x509.Certificate) (revokedSet, error) {
+	var err error
+	for _, caCert := range caCerts {
+		if err = crl.CheckSignatureFrom(caCert); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("not signed by the user CA: %w", err)
+	}
+
+	revoked := revokedSet{}
+	for _, entry := range crl.RevokedCertificateEntries {
+		revoked[revokedCertificate{issuer: string(crl.RawIssuer), serial: entry.SerialNumber.String()}] = true
+	}
+	return revoked, nil
+}
+
+// Reload reads the revocation list file given to LoadMutualTLS, replacing the revoked certificates
+// if it is valid. Returns an error and keeps the previous revocations otherwise.
+func (m *MutualTLS) Reload() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.reload()
+}
+
+// reload reads the revocation list file, if any. Caller must hold mutex.
+func (m *MutualTLS) reload() error {
+	if m.crlFile.Path == "" {
+		return nil
+	}
+
+	crlData, err := os.ReadFile(m.crlFile.Path)
+	if err != nil {
+		return err
+	}
+	if block, _ := pem.Decode(crlData); block != nil {
+		crlData = block.Bytes
+	}
+	crl, err := x509.ParseRevocationList(crlData)
+	if err != nil {
+		return fmt.Errorf("revocation list %s: %w", m.crlFile.Path, err)
+	}
+	revoked, err := revokedCertificates(crl, m.caCerts)
+	if err != nil {
+		return fmt.Errorf("revocation list %s: %w", m.crlFile.Path, err)
+	}
+
+	m.revoked.Store(&revoked)
+	return nil
+}
+
+// Watch reloads the revocation list file when it changes, checking it every interval, until ctx is done.
+func (m *MutualTLS) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.reloadChanged()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// reloadChanged reloads the revocation list file if it changed since the last check.
+func (m *MutualTLS) reloadChanged() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if !m.crlFile.Changed() {
+		return
+	}
+	if err := m.reload(); err != nil {
+		// a partially written file is retried once it changes again
+		log.Printf("failed to reload revocation list, keeping the previous one: %v", err)
+		return
+	}
+	log.Printf("reloaded revocation list %s, %d certificates revoked", m.crlFile.Path, len(*m.revoked.Load()))
+}
+
+// ConfigureTLS makes a server TLS config verify client certificates signed by the user CA,
+// and reject invalid or revoked certificates during the handshake. Connections without
+// a certificate are accepted, so the health probes stay reachable, and their requests
+// to authenticated routes are rejected by the Server.
+func (m *MutualTLS) ConfigureTLS(config *tls.Config) {
+	config.ClientAuth = tls.VerifyClientCertIfGiven
+	config.ClientCAs = m.userCAs
+	config.VerifyConnection = func(state tls.ConnectionState) error {
+		for _, chain := range state.VerifiedChains {
+			if len(chain) > 0 && m.revoked.Load().contains(chain[0]) {
+				return ErrRevokedCertificate
+			}
+		}
+		return nil
+	}
+}
+
+// certificateClaims returns the user information of a verified client certificate.
+// Returns the failure reason if there is none, or its subject has no valid user ID and role.
+func (m *MutualTLS) certificateClaims(state *tls.ConnectionState) (tokenClaims, string) {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return tokenClaims{}, authMissingCertificate
+	}
+
+	leaf := state.VerifiedChains[0][0]
+	if m.revoked.Load().contains(leaf) {
+		return tokenClaims{}, authInvalidCertificate
+	}
+
+	subject := leaf.Subject
+	if subject.CommonName == "" || len(subject.OrganizationalUnit) != 1 {
+		return tokenClaims{}, authInvalidCertificate
+	}
+
+	role := subject.OrganizationalUnit[0]
+	if role == "" {
+		return tokenClaims{}, authInvalidCertificate
+	}
+
+	return tokenClaims{userId: subject.CommonName, role: role}, ""
+}
@@ -0,0 +1,290 @@
+package jobserver
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"teleport-jobworker/pkg/job"
+	"testing"
+	"time"
+)
+
+// testCA issues client certificates for tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	// CAs are distinct issuers, as their revocation lists apply to their own certificates
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test user CA " + rand.Text()},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate() error: %s", err.Error())
+	}
+	cert, _ := x509.ParseCertificate(der)
+
+	return &testCA{cert: cert, key: key}
+}
+
+// issue creates a client certificate for user and role, valid until notAfter.
+func (ca *testCA) issue(t *testing.T, serial int64, user, role string, notAfter time.Time) tls.Certificate {
+	t.Helper()
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	// CAs are distinct issuers, as their revocation lists apply to their own certificates
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: user, OrganizationalUnit: []string{role}},
+		NotBefore:    time.Now().Add(-2 * time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("CreateCertificate() error: %s", err.Error())
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// revocationList creates a revocation list of serials, signed by the CA.
+func (ca *testCA) revocationList(t *testing.T, serials ...int64) *x509.RevocationList {
+	t.Helper()
+
+	template := &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: time.Now(),
+		NextUpdate: time.Now().Add(time.Hour),
+	}
+	for _, serial := range serials {
+		template.RevokedCertificateEntries = append(template.RevokedCertificateEntries,
+			x509.RevocationListEntry{SerialNumber: big.NewInt(serial), RevocationTime: time.Now()})
+	}
+	der, err := x509.CreateRevocationList(rand.Reader, template, ca.cert, ca.key)
+	if err != nil {
+		t.Fatalf("CreateRevocationList() error: %s", err.Error())
+	}
+	crl, _ := x509.ParseRevocationList(der)
+
+	return crl
+}
+
+// initMutualTLSServer spins up a test HTTPS API server requiring client certificates of ca.
+func initMutualTLSServer(t *testing.T, mutualTLS *MutualTLS) *httptest.Server {
+	t.Helper()
+
+	ts := httptest.NewUnstartedServer(NewServer(job.NewManager(), WithMutualTLS(mutualTLS)))
+	ts.TLS = &tls.Config{MinVersion: tls.VersionTLS13}
+	ts.Config.ErrorLog = log.New(io.Discard, "", 0)
+	mutualTLS.ConfigureTLS(ts.TLS)
+	ts.StartTLS()
+	t.Cleanup(ts.Close)
+
+	return ts
+}
+
+// clientWithCertificate returns a Client of ts presenting cert.
+func clientWithCertificate(ts *httptest.Server, cert tls.Certificate) *Client {
+	httpClient := ts.Client()
+	transport := httpClient.Transport.(*http.Transport).Clone()
+	transport.TLSClientConfig.Certificates = []tls.Certificate{cert}
+
+	return &Client{client: &http.Client{Transport: transport}, url: ts.URL}
+}
+
+func TestMutualTLS(t *testing.T) {
+	ca := newTestCA(t)
+	mutualTLS := NewMutualTLS(ca.cert)
+	if err := mutualTLS.Revoke(ca.revocationList(t, 3), ca.cert); err != nil {
+		t.Fatalf("Revoke() error: %s", err.Error())
+	}
+	ts := initMutualTLSServer(t, mutualTLS)
+
+	// the user ID comes from the certificate, not the Bearer token
+	client := clientWithCertificate(ts, ca.issue(t, 2, "user1", job.User, time.Now().Add(time.Hour)))
+	client.token = user2token
+	response, err := client.StartJob("/bin/echo", []string{"hello world"})
+	if err != nil {
+		t.Fatalf("StartJob() error: %s", err.Error())
+	}
+
+	other := clientWithCertificate(ts, ca.issue(t, 4, "user2", job.User, time.Now().Add(time.Hour)))
+	if _, err := other.GetJobStatus(response.ID); !errors.Is(err, job.ErrNotFound) {
+		t.Errorf("GetJobStatus() expected %s for another user, got %v", job.ErrNotFound, err)
+	}
+
+	admin := clientWithCertificate(ts, ca.issue(t, 5, "admin1", job.Admin, time.Now().Add(time.Hour)))
+	if _, err := admin.GetJobStatus(response.ID); err != nil {
+		t.Errorf("GetJobStatus() error for admin: %s", err.Error())
+	}
+
+	// a group without roles is authenticated, but denied every action
+	unbound := clientWithCertificate(ts, ca.issue(t, 6, "user3", "superuser", time.Now().Add(time.Hour)))
+	_, err = unbound.StartJob("/bin/echo", []string{"hello world"})
+	want := (&job.PermissionError{Verb: job.VerbStart, Scope: job.ScopeOwn}).Error()
+	if !errors.Is(err, job.ErrForbidden) || err.Error() != want {
+		t.Errorf("StartJob() expected %s for a group without roles, got %v", want, err)
+	}
+}
+
+func TestMutualTLSRejected(t *testing.T) {
+	ca := newTestCA(t)
+	mutualTLS := NewMutualTLS(ca.cert)
+	if err := mutualTLS.Revoke(ca.revocationList(t, 3), ca.cert); err != nil {
+		t.Fatalf("Revoke() error: %s", err.Error())
+	}
+	ts := initMutualTLSServer(t, mutualTLS)
+
+	tests := []struct {
+		name string
+		cert *tls.Certificate
+	}{
+		{"expired", ptr(ca.issue(t, 2, "user1", job.User, time.Now().Add(-time.Hour)))},
+		{"wrong-CA", ptr(newTestCA(t).issue(t, 2, "user1", job.User, time.Now().Add(time.Hour)))},
+		{"revoked", ptr(ca.issue(t, 3, "user1", job.User, time.Now().Add(time.Hour)))},
+	}
+
+	for _, test := range tests {
+		client := &Client{client: ts.Client(), url: ts.URL}
+		if test.cert != nil {
+			client = clientWithCertificate(ts, *test.cert)
+		}
+
+		// the TLS handshake fails before any request is served, unless the client has no certificate
+		// of the user CA to send, when the request is not authenticated
+		_, err := client.GetJobStatus("fake_id")
+		var apiErr *Error
+		if err == nil || errors.As(err, &apiErr) && apiErr.Code != CodeUnauthenticated {
+			t.Errorf("GetJobStatus() with %s certificate expected a TLS error, got %v", test.name, err)
+		}
+	}
+}
+
+func TestMutualTLSWithoutCertificate(t *testing.T) {
+	ca := newTestCA(t)
+	ts := initMutualTLSServer(t, NewMutualTLS(ca.cert))
+
+	// requests without a certificate are served, but not authenticated, even with a Bearer token
+	client := &Client{client: ts.Client(), url: ts.URL, token: user1token}
+	if _, err := client.GetJobStatus("fake_id"); !errors.Is(err, &Error{Code: CodeUnauthenticated}) {
+		t.Errorf("GetJobStatus() without certificate expected %s, got %v", CodeUnauthenticated, err)
+	}
+
+	// the health probes are reachable without a certificate
+	for _, path := range []string{"/healthz", "/readyz"} {
+		response, err := ts.Client().Get(ts.URL + path)
+		if err != nil {
+			t.Fatalf("Get(%s) error: %s", path, err.Error())
+		}
+		response.Body.Close()
+		if response.StatusCode != http.StatusOK {
+			t.Errorf("Get(%s) expected status 200, got %d", path, response.StatusCode)
+		}
+	}
+}
+
+func TestRevokeByIssuer(t *testing.T) {
+	ca, otherCA := newTestCA(t), newTestCA(t)
+	mutualTLS := NewMutualTLS(ca.cert, otherCA.cert)
+	if err := mutualTLS.Revoke(ca.revocationList(t, 3), ca.cert); err != nil {
+		t.Fatalf("Revoke() error: %s", err.Error())
+	}
+	ts := initMutualTLSServer(t, mutualTLS)
+
+	// the revocation list of a CA does not revoke the certificates of another CA with the same serial
+	client := clientWithCertificate(ts, otherCA.issue(t, 3, "user1", job.User, time.Now().Add(time.Hour)))
+	if _, err := client.StartJob("/bin/echo", []string{"hello world"}); err != nil {
+		t.Errorf("StartJob() error with a certificate of another CA: %s", err.Error())
+	}
+
+	revoked := clientWithCertificate(ts, ca.issue(t, 3, "user1", job.User, time.Now().Add(time.Hour)))
+	if _, err := revoked.StartJob("/bin/echo", []string{"hello world"}); err == nil {
+		t.Errorf("StartJob() expected a TLS error with a revoked certificate")
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestLoadMutualTLS(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+
+	caFile := filepath.Join(dir, "ca.pem")
+	os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw}), 0600)
+	crlFile := filepath.Join(dir, "crl.pem")
+	os.WriteFile(crlFile, pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: ca.revocationList(t, 3).Raw}), 0600)
+
+	mutualTLS, err := LoadMutualTLS(caFile, crlFile)
+	if err != nil {
+		t.Fatalf("LoadMutualTLS() error: %s", err.Error())
+	}
+	revoked := ca.issue(t, 3, "user1", job.User, time.Now().Add(time.Hour))
+	if leaf, _ := x509.ParseCertificate(revoked.Certificate[0]); !mutualTLS.revoked.Load().contains(leaf) {
+		t.Errorf("LoadMutualTLS() expected serial 3 revoked")
+	}
+
+	// a replaced revocation list is reloaded once Watch sees it change
+	os.WriteFile(crlFile, pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: ca.revocationList(t, 4).Raw}), 0600)
+	ctx, cancel := context.WithCancel(context.Background())
+	watching := make(chan struct{})
+	go func() {
+		defer close(watching)
+		mutualTLS.Watch(ctx, 10*time.Millisecond)
+	}()
+	replaced := ca.issue(t, 4, "user1", job.User, time.Now().Add(time.Hour))
+	replacedLeaf, _ := x509.ParseCertificate(replaced.Certificate[0])
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if mutualTLS.revoked.Load().contains(replacedLeaf) {
+			break
+		}
+	}
+	cancel()
+	<-watching
+	if !mutualTLS.revoked.Load().contains(replacedLeaf) {
+		t.Errorf("Watch() expected serial 4 revoked by the replaced revocation list")
+	}
+
+	// an invalid revocation list keeps the previous one
+	os.WriteFile(crlFile, []byte("not a revocation list"), 0600)
+	if err := mutualTLS.Reload(); err == nil {
+		t.Errorf("Reload() expected error with an invalid revocation list")
+	}
+	if !mutualTLS.revoked.Load().contains(replacedLeaf) {
+		t.Errorf("Reload() expected the previous revocation list kept")
+	}
+
+	// revocation lists must be signed by the user CA
+	otherCRLFile := filepath.Join(dir, "other-crl.pem")
+	os.WriteFile(otherCRLFile, newTestCA(t).revocationList(t, 3).Raw, 0600)
+	if _, err := LoadMutualTLS(caFile, otherCRLFile); err == nil {
+		t.Errorf("LoadMutualTLS() expected an error for a revocation list of another CA")
+	}
+}
@@ -0,0 +1,18 @@
+package jobserver
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// openAPISpec is the OpenAPI 3 document of the routes under APIPrefix, maintained along with the handlers:
+// the contract test checks that it documents every route, and the fields of every request and response.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// openAPIHandler handles HTTPS requests to GET /v1/openapi.json, without authentication.
+func openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPISpec)
+}
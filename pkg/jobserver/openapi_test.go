@@ -0,0 +1,353 @@
+package jobserver
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"teleport-jobworker/pkg/audit"
+	"teleport-jobworker/pkg/job"
+	"testing"
+	"time"
+)
+
+// openAPIDocument is the subset of the OpenAPI document checked by the contract tests.
+type openAPIDocument struct {
+	OpenAPI    string                                 `json:"openapi"`
+	Paths      map[string]map[string]openAPIOperation `json:"paths"`
+	Components struct {
+		Responses map[string]openAPIResponse  `json:"responses"`
+		Schemas   map[string]openAPIObjectDef `json:"schemas"`
+	} `json:"components"`
+}
+
+type openAPIOperation struct {
+	RequestBody *struct {
+		Content map[string]openAPIMedia `json:"content"`
+	} `json:"requestBody"`
+	Responses map[string]openAPIResponse `json:"responses"`
+}
+
+type openAPIResponse struct {
+	Ref     string                  `json:"$ref"`
+	Content map[string]openAPIMedia `json:"content"`
+}
+
+type openAPIMedia struct {
+	Schema map[string]any `json:"schema"`
+}
+
+type openAPIObjectDef struct {
+	Properties map[string]map[string]any `json:"properties"`
+}
+
+func loadOpenAPIDocument(t *testing.T) openAPIDocument {
+	t.Helper()
+
+	var document openAPIDocument
+	if err := json.Unmarshal(openAPISpec, &document); err != nil {
+		t.Fatalf("json.Unmarshal() error for openapi.json: %s", err.Error())
+	}
+	return document
+}
+
+// schemaTypes are the request and response structs documented by the spec, by schema name.
+var schemaTypes = map[string]reflect.Type{
+	"StartRequest":    reflect.TypeFor[StartRequest](),
+	"Command":         reflect.TypeFor[Command](),
+	"StartResponse":   reflect.TypeFor[StartResponse](),
+	"StopResponse":    reflect.TypeFor[StopResponse](),
+	"SignalRequest":   reflect.TypeFor[SignalRequest](),
+	"SignalResponse":  reflect.TypeFor[SignalResponse](),
+	"GrantRequest":    reflect.TypeFor[GrantRequest](),
+	"Grant":           reflect.TypeFor[Grant](),
+	"GrantResponse":   reflect.TypeFor[GrantResponse](),
+	"StdinResponse":   reflect.TypeFor[StdinResponse](),
+	"StatusResponse":  reflect.TypeFor[StatusResponse](),
+	"JobListing":      reflect.TypeFor[JobListing](),
+	"ListResponse":    reflect.TypeFor[ListResponse](),
+	"OutputResponse":  reflect.TypeFor[OutputResponse](),
+	"LogRecord":       reflect.TypeFor[LogRecord](),
+	"LogsResponse":    reflect.TypeFor[LogsResponse](),
+	"TerminalMessage": reflect.TypeFor[TerminalMessage](),
+	"LoginRequest":    reflect.TypeFor[LoginRequest](),
+	"RefreshRequest":  reflect.TypeFor[RefreshRequest](),
+	"TokenResponse":   reflect.TypeFor[TokenResponse](),
+	"AuditRecord":     reflect.TypeFor[audit.Record](),
+	"AuditResponse":   reflect.TypeFor[AuditResponse](),
+	"InfoResponse":    reflect.TypeFor[InfoResponse](),
+	"InfoLimits":      reflect.TypeFor[InfoLimits](),
+	"ErrorResponse":   reflect.TypeFor[ErrorResponse](),
+	"Error":           reflect.TypeFor[Error](),
+}
+
+// schemaRef returns the reference to the schema of a struct type.
+func schemaRef(t *testing.T, typ reflect.Type) string {
+	t.Helper()
+
+	for name, schemaType := range schemaTypes {
+		if schemaType == typ {
+			return "#/components/schemas/" + name
+		}
+	}
+	t.Fatalf("no schema for type %s", typ)
+	return ""
+}
+
+// expectedSchema returns the JSON schema of the values of typ encoded by encoding/json.
+func expectedSchema(t *testing.T, typ reflect.Type) map[string]any {
+	if typ == reflect.TypeFor[time.Time]() {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+
+	switch typ.Kind() {
+	case reflect.Pointer:
+		schema := expectedSchema(t, typ.Elem())
+		schema["type"] = []any{schema["type"], "null"}
+		return schema
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int64, reflect.Uint16, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Slice:
+		return map[string]any{"type": "array", "items": expectedSchema(t, typ.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": expectedSchema(t, typ.Elem())}
+	case reflect.Struct:
+		return map[string]any{"$ref": schemaRef(t, typ)}
+	}
+	t.Fatalf("no JSON schema for type %s", typ)
+	return nil
+}
+
+// structuralSchema keeps the keywords of a spec schema describing the shape of values,
+// dropping documentation such as descriptions, examples and enums.
+func structuralSchema(schema map[string]any) map[string]any {
+	structural := map[string]any{}
+	for key, value := range schema {
+		switch key {
+		case "type", "$ref":
+			structural[key] = value
+		case "format":
+			if value == "date-time" {
+				structural[key] = value
+			}
+		case "items", "additionalProperties":
+			structural[key] = structuralSchema(value.(map[string]any))
+		}
+	}
+	return structural
+}
+
+// jsonFields returns the JSON field names of a struct type, with their types.
+func jsonFields(typ reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	for i := range typ.NumField() {
+		field := typ.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = field.Type
+	}
+	return fields
+}
+
+func TestOpenAPISchemas(t *testing.T) {
+	document := loadOpenAPIDocument(t)
+
+	for name := range document.Components.Schemas {
+		if _, ok := schemaTypes[name]; !ok {
+			t.Errorf("openapi.json schema %s has no Go type", name)
+		}
+	}
+
+	for name, typ := range schemaTypes {
+		schema, ok := document.Components.Schemas[name]
+		if !ok {
+			t.Errorf("openapi.json expected schema %s of %s", name, typ)
+			continue
+		}
+
+		fields := jsonFields(typ)
+		for property := range schema.Properties {
+			if _, ok := fields[property]; !ok {
+				t.Errorf("openapi.json schema %s has property %s, missing from %s", name, property, typ)
+			}
+		}
+		for field, fieldType := range fields {
+			property, ok := schema.Properties[field]
+			if !ok {
+				t.Errorf("openapi.json schema %s expected property %s of %s", name, field, typ)
+				continue
+			}
+			// compare as decoded JSON
+			var want map[string]any
+			data, _ := json.Marshal(expectedSchema(t, fieldType))
+			json.Unmarshal(data, &want)
+			if got := structuralSchema(property); !reflect.DeepEqual(got, want) {
+				t.Errorf("openapi.json schema %s property %s = %v, expected %v for %s", name, field, got, want, fieldType)
+			}
+		}
+	}
+}
+
+// contractServer creates a Server with every optional route.
+func contractServer(t *testing.T) *Server {
+	t.Helper()
+
+	auditLog, err := audit.Open(filepath.Join(t.TempDir(), "audit.log"))
+	if err != nil {
+		t.Fatalf("audit.Open() error: %s", err.Error())
+	}
+	t.Cleanup(func() { auditLog.Close() })
+
+	return NewServer(job.NewManager(), withTestTokens(), WithAuditLog(auditLog), WithLogin(nil, time.Minute, time.Hour))
+}
+
+func TestOpenAPIContract(t *testing.T) {
+	document := loadOpenAPIDocument(t)
+	server := contractServer(t)
+
+	// every route is documented, and every documented route is served
+	documented := []string{}
+	for path, operations := range document.Paths {
+		for method := range operations {
+			documented = append(documented, strings.ToUpper(method)+" "+APIPrefix+path)
+		}
+	}
+	for _, route := range server.routes {
+		if !slices.Contains(documented, route) {
+			t.Errorf("openapi.json expected route %s", route)
+		}
+	}
+	for _, route := range documented {
+		if !slices.Contains(server.routes, route) && route != "GET "+APIPrefix+"/openapi.json" {
+			t.Errorf("openapi.json documents route %s, not served", route)
+		}
+	}
+
+	// request and response bodies of each handler
+	tests := []struct {
+		route    string
+		request  any
+		code     string
+		response any
+	}{
+		{"POST /jobs/start", StartRequest{}, "201", StartResponse{}},
+		{"POST /jobs/{id}/stop", nil, "200", StopResponse{}},
+		{"POST /jobs/{id}/signal", SignalRequest{}, "200", SignalResponse{}},
+		{"POST /jobs/{id}/grants", GrantRequest{}, "200", GrantResponse{}},
+		{"POST /jobs/{id}/stdin", nil, "200", StdinResponse{}},
+		{"POST /jobs/{id}/stdin/close", nil, "200", StdinResponse{}},
+		{"GET /jobs/{id}/attach", nil, "101", TerminalMessage{}},
+		{"GET /jobs/{id}/output", nil, "200", OutputResponse{}},
+		{"GET /jobs/{id}/logs", nil, "200", LogsResponse{}},
+		{"GET /jobs", nil, "200", ListResponse{}},
+		{"GET /jobs/{id}/wait", nil, "200", StatusResponse{}},
+		{"GET /jobs/{id}", nil, "200", StatusResponse{}},
+		{"POST /auth/login", LoginRequest{}, "200", TokenResponse{}},
+		{"POST /auth/refresh", RefreshRequest{}, "200", TokenResponse{}},
+		{"POST /auth/logout", RefreshRequest{}, "204", nil},
+		{"GET /audit", nil, "200", AuditResponse{}},
+		{"GET /info", nil, "200", InfoResponse{}},
+	}
+	if len(tests) != len(server.routes) {
+		t.Errorf("contract test covers %d routes, expected every %d routes", len(tests), len(server.routes))
+	}
+
+	errorRef := schemaRef(t, reflect.TypeFor[ErrorResponse]())
+	for _, test := range tests {
+		method, path, _ := strings.Cut(test.route, " ")
+		operation, ok := document.Paths[path][strings.ToLower(method)]
+		if !ok {
+			t.Errorf("openapi.json expected route %s", test.route)
+			continue
+		}
+
+		if test.request != nil {
+			if operation.RequestBody == nil || operation.RequestBody.Content["application/json"].Schema["$ref"] != schemaRef(t, reflect.TypeOf(test.request)) {
+				t.Errorf("openapi.json %s expected request body %T", test.route, test.request)
+			}
+		} else if operation.RequestBody != nil && operation.RequestBody.Content["application/json"].Schema != nil {
+			t.Errorf("openapi.json %s expected no JSON request body", test.route)
+		}
+
+		response, ok := operation.Responses[test.code]
+		switch {
+		case !ok:
+			t.Errorf("openapi.json %s expected response %s", test.route, test.code)
+		case test.response == nil && response.Content != nil:
+			t.Errorf("openapi.json %s expected no response body for %s", test.route, test.code)
+		case test.response != nil && response.Content["application/json"].Schema["$ref"] != schemaRef(t, reflect.TypeOf(test.response)):
+			t.Errorf("openapi.json %s expected response body %T for %s", test.route, test.response, test.code)
+		}
+
+		// errors are ErrorResponse bodies
+		for code, response := range operation.Responses {
+			if code < "400" {
+				continue
+			}
+			if name, ok := strings.CutPrefix(response.Ref, "#/components/responses/"); ok {
+				response = document.Components.Responses[name]
+			}
+			if response.Content["application/json"].Schema["$ref"] != errorRef {
+				t.Errorf("openapi.json %s expected ErrorResponse body for %s", test.route, code)
+			}
+		}
+	}
+}
+
+func TestAPIVersions(t *testing.T) {
+	ts, id := initTestServer(t)
+
+	// the spec is served without authentication
+	response, err := ts.Client().Get(ts.URL + "/v1/openapi.json")
+	if err != nil {
+		t.Fatalf("GET /v1/openapi.json error: %s", err.Error())
+	}
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	var document openAPIDocument
+	if response.StatusCode != http.StatusOK || json.Unmarshal(body, &document) != nil || document.OpenAPI != "3.1.0" {
+		t.Errorf("GET /v1/openapi.json expected an OpenAPI 3.1 document, got %d: %.100s", response.StatusCode, body)
+	}
+
+	for _, test := range []struct {
+		path       string
+		deprecated bool
+	}{
+		{"/v1/jobs/" + id, false},
+		{"/jobs/" + id, true},
+	} {
+		request, _ := http.NewRequest("GET", ts.URL+test.path, nil)
+		request.Header.Set("Authorization", "Bearer "+user1token)
+		response, err := ts.Client().Do(request)
+		if err != nil {
+			t.Fatalf("GET %s error: %s", test.path, err.Error())
+		}
+		response.Body.Close()
+
+		if response.StatusCode != http.StatusOK {
+			t.Errorf("GET %s expected %d, got %d", test.path, http.StatusOK, response.StatusCode)
+		}
+		deprecation, link := response.Header.Get("Deprecation"), response.Header.Get("Link")
+		if test.deprecated && (deprecation != "true" || link != `</v1/jobs/`+id+`>; rel="successor-version"`) {
+			t.Errorf("GET %s expected Deprecation and Link headers, got %q and %q", test.path, deprecation, link)
+		}
+		if !test.deprecated && (deprecation != "" || link != "") {
+			t.Errorf("GET %s expected no Deprecation header, got %q", test.path, deprecation)
+		}
+	}
+}
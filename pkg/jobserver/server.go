@@ -4,35 +4,170 @@ package jobserver
 
 import (
 	"net/http"
+	"sync/atomic"
+	"teleport-jobworker/pkg/audit"
 	"teleport-jobworker/pkg/job"
+	"teleport-jobworker/pkg/metrics"
+	"teleport-jobworker/pkg/token"
+	"time"
 )
 
 const DefaultHost = "localhost:8443"
 
+// APIPrefix is the path prefix of the current version of the API.
+// The routes without prefix are deprecated aliases of the same routes.
+const APIPrefix = "/v1"
+
 // Server provides a mux with API endpoints that wrap job.Manager library calls.
 type Server struct {
 	mux     *http.ServeMux
 	manager *job.Manager
+
+	// routes are the API routes, as "METHOD /v1/path" patterns, each documented by the OpenAPI spec
+	routes []string
+
+	idempotency *idempotencyStore
+
+	metrics         *metrics.Metrics
+	metricsEndpoint bool
+	handler         http.Handler
+
+	auditLog *audit.Log
+
+	mutualTLS *MutualTLS
+	verifier  *token.Verifier
+	login     *login
+
+	startedAt       time.Time
+	readinessChecks []readinessCheck
+	// grpcEnabled is set once the gRPC API is created with NewGRPCServer
+	grpcEnabled atomic.Bool
+}
+
+// ServerOption configures optional behaviour of the job Server.
+type ServerOption func(*Server)
+
+// WithIdempotencyWindow sets how long the idempotency keys of start requests are remembered.
+func WithIdempotencyWindow(window time.Duration) ServerOption {
+	return func(s *Server) {
+		s.idempotency = newIdempotencyStore(window)
+	}
+}
+
+// WithMetrics collects request counts, latencies and authentication failures into m.
+func WithMetrics(m *metrics.Metrics) ServerOption {
+	return func(s *Server) {
+		s.metrics = m
+	}
+}
+
+// WithMetricsEndpoint serves the metrics set by WithMetrics at GET /metrics, without authentication.
+// Without it, metrics can be served on a separate listener with metrics.Metrics.Handler.
+func WithMetricsEndpoint() ServerOption {
+	return func(s *Server) {
+		s.metricsEndpoint = true
+	}
+}
+
+// WithAuditLog records every authenticated action into auditLog, including denied ones,
+// and lets admins query it at GET /audit.
+func WithAuditLog(auditLog *audit.Log) ServerOption {
+	return func(s *Server) {
+		s.auditLog = auditLog
+	}
+}
+
+// WithTokenVerifier authenticates users by access tokens verified by verifier,
+// sent as an Authorization: Bearer header.
+func WithTokenVerifier(verifier *token.Verifier) ServerOption {
+	return func(s *Server) {
+		s.verifier = verifier
+	}
+}
+
+// WithMutualTLS authenticates users by their client certificates instead of Bearer tokens.
+// The TLS config of the listener must be configured with MutualTLS.ConfigureTLS.
+func WithMutualTLS(mutualTLS *MutualTLS) ServerOption {
+	return func(s *Server) {
+		s.mutualTLS = mutualTLS
+	}
 }
 
 // NewServer creates an HTTP mux with API endpoints for job functions.
-func NewServer(manager *job.Manager) *Server {
+func NewServer(manager *job.Manager, opts ...ServerOption) *Server {
 	mux := http.NewServeMux()
 
 	jobServer := &Server{
-		mux:     mux,
-		manager: manager,
+		mux:         mux,
+		manager:     manager,
+		idempotency: newIdempotencyStore(DefaultIdempotencyWindow),
+		startedAt:   time.Now(),
+	}
+
+	for _, opt := range opts {
+		opt(jobServer)
 	}
 
-	mux.HandleFunc("POST /jobs/start", bearerAuth(jobServer.startHandler))
-	mux.HandleFunc("POST /jobs/{id}/stop", bearerAuth(jobServer.stopHandler))
-	mux.HandleFunc("GET /jobs/{id}/output", bearerAuth(jobServer.getOutputHandler))
-	mux.HandleFunc("GET /jobs/{id}", bearerAuth(jobServer.getStatusHandler))
+	jobServer.handle("POST", "/jobs/start", jobServer.route(actionStart, jobServer.startHandler))
+	jobServer.handle("POST", "/jobs/{id}/stop", jobServer.route(actionStop, jobServer.stopHandler))
+	jobServer.handle("POST", "/jobs/{id}/signal", jobServer.route(actionSignal, jobServer.signalHandler))
+	jobServer.handle("POST", "/jobs/{id}/grants", jobServer.route(actionGrant, jobServer.grantHandler))
+	jobServer.handle("POST", "/jobs/{id}/stdin", jobServer.route(actionWriteStdin, jobServer.writeStdinHandler))
+	jobServer.handle("POST", "/jobs/{id}/stdin/close", jobServer.route(actionCloseStdin, jobServer.closeStdinHandler))
+	jobServer.handle("GET", "/jobs/{id}/attach", jobServer.route(actionAttach, jobServer.attachHandler))
+	jobServer.handle("GET", "/jobs/{id}/output", jobServer.route(actionOutput, jobServer.getOutputHandler))
+	jobServer.handle("GET", "/jobs/{id}/logs", jobServer.route(actionLogs, jobServer.getLogsHandler))
+	jobServer.handle("GET", "/jobs", jobServer.route(actionList, jobServer.listHandler))
+	jobServer.handle("GET", "/jobs/{id}/wait", jobServer.route(actionWait, jobServer.waitHandler))
+	jobServer.handle("GET", "/jobs/{id}", jobServer.route(actionStatus, jobServer.getStatusHandler))
+	jobServer.handle("GET", "/info", jobServer.route(actionInfo, jobServer.infoHandler))
+	if jobServer.login != nil && jobServer.verifier != nil {
+		jobServer.handle("POST", "/auth/login", jobServer.audited(actionLogin, jobServer.loginHandler))
+		jobServer.handle("POST", "/auth/refresh", jobServer.audited(actionRefresh, jobServer.refreshHandler))
+		jobServer.handle("POST", "/auth/logout", jobServer.audited(actionLogout, jobServer.logoutHandler))
+	}
+	if jobServer.auditLog != nil {
+		jobServer.handle("GET", "/audit", jobServer.route(actionAuditQuery, jobServer.getAuditHandler))
+	}
+	mux.HandleFunc("GET "+APIPrefix+"/openapi.json", openAPIHandler)
+	mux.HandleFunc("GET /healthz", jobServer.healthzHandler)
+	mux.HandleFunc("GET /readyz", jobServer.readyzHandler)
+
+	jobServer.handler = mux
+	if jobServer.metrics != nil {
+		if jobServer.metricsEndpoint {
+			mux.Handle("GET /metrics", jobServer.metrics.Handler())
+		}
+		jobServer.handler = jobServer.metrics.Middleware(mux)
+	}
 
 	return jobServer
 }
 
-// ServeHTTP allows the job Server to be used with http.Server.
+// handle registers handler for the route under APIPrefix, and as a deprecated alias without prefix.
+func (s *Server) handle(method, path string, handler http.HandlerFunc) {
+	s.mux.HandleFunc(method+" "+APIPrefix+path, handler)
+	s.mux.HandleFunc(method+" "+path, deprecated(handler))
+	s.routes = append(s.routes, method+" "+APIPrefix+path)
+}
+
+// deprecated marks the responses of a route without prefix as deprecated,
+// with a link to the same route under APIPrefix.
+func deprecated(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", "<"+APIPrefix+r.URL.Path+`>; rel="successor-version"`)
+		handler(w, r)
+	}
+}
+
+// route authenticates and audits requests to an API endpoint.
+func (s *Server) route(action string, handler http.HandlerFunc) http.HandlerFunc {
+	return s.audited(action, s.bearerAuth(handler))
+}
+
+// ServeHTTP allows the job Server to be used with http.Server. Every response carries a request ID.
 func (js *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	js.mux.ServeHTTP(w, r)
+	withRequestID(w, r)
+	js.handler.ServeHTTP(w, r)
 }
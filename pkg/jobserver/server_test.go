@@ -5,25 +5,60 @@ import (
 	"context"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"teleport-jobworker/pkg/audit"
 	"teleport-jobworker/pkg/job"
+	"teleport-jobworker/pkg/metrics"
+	"teleport-jobworker/pkg/token"
 	"testing"
 	"testing/synctest"
+	"time"
 )
 
-const (
-	user1token    = "user1_token"
-	user2token    = "user2_token"
+// testKeys signs the access tokens of test users.
+var testKeys = func() *token.KeySet {
+	key, err := token.GenerateKey(token.AlgHS256, "test")
+	if err != nil {
+		panic(err)
+	}
+	keys := &token.KeySet{}
+	keys.Add(key)
+	return keys
+}()
+
+var (
+	user1token    = testToken("user1", job.User)
+	user2token    = testToken("user2", job.User)
+	admin1token   = testToken("admin1", job.Admin)
 	fakeusertoken = "fakeuser_token"
 )
 
+// testToken issues an access token for a test user.
+func testToken(user, role string) string {
+	signed, err := testKeys.Sign(token.NewClaims(user, role, DefaultAudience, time.Hour))
+	if err != nil {
+		panic(err)
+	}
+	return signed
+}
+
+// withTestTokens verifies the access tokens issued by testToken.
+func withTestTokens() ServerOption {
+	return WithTokenVerifier(token.NewVerifier(testKeys, nil, DefaultAudience))
+}
+
 // initTestServer spins up a test HTTPS API server and pre-generated dummy ID for testing.
 func initTestServer(t *testing.T) (*httptest.Server, string) {
 	t.Helper()
 
 	manager := job.NewManager()
-	jobServer := NewServer(manager)
+	jobServer := NewServer(manager, withTestTokens())
 
 	var id string
 	var err error
@@ -56,7 +91,7 @@ func TestStartHandler(t *testing.T) {
 	ts, _ := initTestServer(t)
 
 	shortCmd := `{"program":"/bin/echo","args":["hello world"]}`
-	request, _ := http.NewRequest("POST", ts.URL+"/jobs/start", bytes.NewBufferString(shortCmd))
+	request, _ := http.NewRequest("POST", ts.URL+"/v1/jobs/start", bytes.NewBufferString(shortCmd))
 	request.Header.Set("Authorization", "Bearer "+user1token)
 	request.Header.Set("Content-Type", "application/json")
 
@@ -73,7 +108,7 @@ func TestStartHandler(t *testing.T) {
 func TestStopHandler(t *testing.T) {
 	ts, id := initTestServer(t)
 
-	request, _ := http.NewRequest("POST", ts.URL+"/jobs/"+id+"/stop", nil)
+	request, _ := http.NewRequest("POST", ts.URL+"/v1/jobs/"+id+"/stop", nil)
 	request.Header.Set("Authorization", "Bearer "+user1token)
 	request.Header.Set("Content-Type", "application/json")
 
@@ -87,10 +122,110 @@ func TestStopHandler(t *testing.T) {
 	response.Body.Close()
 }
 
+func TestSignalHandler(t *testing.T) {
+	ts, id := initTestServer(t)
+
+	tests := []struct {
+		body string
+		code int
+	}{
+		{`{"signal":"SIGHUP"}`, http.StatusOK},
+		{`{"signal":"term"}`, http.StatusOK},
+		{`{"signal":"SIGSEGV"}`, http.StatusBadRequest},
+		{`{"signal":`, http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		request, _ := http.NewRequest("POST", ts.URL+"/v1/jobs/"+id+"/signal", bytes.NewBufferString(test.body))
+		request.Header.Set("Authorization", "Bearer "+user1token)
+		request.Header.Set("Content-Type", "application/json")
+
+		response, err := ts.Client().Do(request)
+		if err != nil {
+			t.Fatalf("Do() error: %s", err.Error())
+		}
+		response.Body.Close()
+
+		if response.StatusCode != test.code {
+			t.Errorf("signalHandler() %s expected %d, got %d", test.body, test.code, response.StatusCode)
+		}
+	}
+}
+
+func TestForbidden(t *testing.T) {
+	// users may only view the jobs of every user
+	policy := job.DefaultPolicy()
+	policy.Roles[0].Rules = []job.Rule{{Verbs: []string{job.VerbStatus}, Scope: job.ScopeAll}}
+	authorizer, err := job.NewRBAC(policy)
+	if err != nil {
+		t.Fatalf("NewRBAC() error: %s", err.Error())
+	}
+	manager := job.NewManager(job.WithAuthorizer(authorizer))
+	ts := httptest.NewTLSServer(NewServer(manager, withTestTokens()))
+	defer ts.Close()
+
+	adminCtx := job.WithUserInfo(context.Background(), "admin1", job.Admin)
+	id, err := manager.Start(adminCtx, "/bin/echo", []string{"hello world"})
+	if err != nil {
+		t.Fatalf("Start() error: %s", err.Error())
+	}
+
+	// the job is visible, so the missing permission is named rather than reported as not found
+	request, _ := http.NewRequest("POST", ts.URL+"/v1/jobs/"+id+"/stop", nil)
+	request.Header.Set("Authorization", "Bearer "+user1token)
+	response, err := ts.Client().Do(request)
+	if err != nil {
+		t.Fatalf("Do() error: %s", err.Error())
+	}
+	var errorResponse ErrorResponse
+	json.NewDecoder(response.Body).Decode(&errorResponse)
+	response.Body.Close()
+
+	want := "permission denied: missing stop permission on all jobs"
+	if response.StatusCode != http.StatusForbidden || errorResponse.Error.Code != CodePolicyDenied ||
+		errorResponse.Error.Message != want || errorResponse.Error.Details["scope"] != job.ScopeAll {
+		t.Errorf("stopHandler() expected %d %q, got %d %+v", http.StatusForbidden, want, response.StatusCode, errorResponse.Error)
+	}
+}
+
+func TestStartForbidden(t *testing.T) {
+	// users may only view the jobs of every user
+	policy := job.DefaultPolicy()
+	policy.Roles[0].Rules = []job.Rule{{Verbs: []string{job.VerbStatus}, Scope: job.ScopeAll}}
+	authorizer, err := job.NewRBAC(policy)
+	if err != nil {
+		t.Fatalf("NewRBAC() error: %s", err.Error())
+	}
+	ts := httptest.NewTLSServer(NewServer(job.NewManager(job.WithAuthorizer(authorizer)), withTestTokens()))
+	defer ts.Close()
+
+	// whether the program exists is not revealed to users who may not start it
+	for _, program := range []string{"/bin/echo", "/nonexistent/program"} {
+		body := fmt.Sprintf(`{"program":%q}`, program)
+		request, _ := http.NewRequest("POST", ts.URL+"/v1/jobs/start", bytes.NewBufferString(body))
+		request.Header.Set("Authorization", "Bearer "+user1token)
+		request.Header.Set("Content-Type", "application/json")
+
+		response, err := ts.Client().Do(request)
+		if err != nil {
+			t.Fatalf("Do() error: %s", err.Error())
+		}
+		var errorResponse ErrorResponse
+		json.NewDecoder(response.Body).Decode(&errorResponse)
+		response.Body.Close()
+
+		want := "permission denied: missing start permission on own jobs"
+		if response.StatusCode != http.StatusForbidden || errorResponse.Error.Message != want {
+			t.Errorf("startHandler() %s expected %d %q, got %d %+v",
+				program, http.StatusForbidden, want, response.StatusCode, errorResponse.Error)
+		}
+	}
+}
+
 func TestStatusHandler(t *testing.T) {
 	ts, id := initTestServer(t)
 
-	request, _ := http.NewRequest("GET", ts.URL+"/jobs/"+id, nil)
+	request, _ := http.NewRequest("GET", ts.URL+"/v1/jobs/"+id, nil)
 	request.Header.Set("Authorization", "Bearer "+user1token)
 	request.Header.Set("Content-Type", "application/json")
 
@@ -117,7 +252,7 @@ func TestStatusHandler(t *testing.T) {
 func TestOutputHandler(t *testing.T) {
 	ts, id := initTestServer(t)
 
-	request, _ := http.NewRequest("GET", ts.URL+"/jobs/"+id+"/output", nil)
+	request, _ := http.NewRequest("GET", ts.URL+"/v1/jobs/"+id+"/output", nil)
 	request.Header.Set("Authorization", "Bearer "+user1token)
 	request.Header.Set("Content-Type", "application/json")
 
@@ -135,7 +270,7 @@ func TestJobNotFound(t *testing.T) {
 	ts, _ := initTestServer(t)
 
 	// GetStatus request, with fake id of a job that doesn't exist
-	request, _ := http.NewRequest("GET", ts.URL+"/jobs/fake_id", nil)
+	request, _ := http.NewRequest("GET", ts.URL+"/v1/jobs/fake_id", nil)
 	request.Header.Set("Authorization", "Bearer "+user1token)
 	request.Header.Set("Content-Type", "application/json")
 
@@ -148,14 +283,14 @@ func TestJobNotFound(t *testing.T) {
 	}
 	defer response.Body.Close()
 
-	var statusResponse StatusResponse
-	err = json.NewDecoder(response.Body).Decode(&statusResponse)
+	var errorResponse ErrorResponse
+	err = json.NewDecoder(response.Body).Decode(&errorResponse)
 	if err != nil {
 		t.Errorf("JSON decoding error: %s", err.Error())
 	}
 
-	if *statusResponse.Error != job.ErrNotFound.Error() {
-		t.Errorf("GetStatus() expected error: %v, got %v", job.ErrNotFound.Error(), *statusResponse.Error)
+	if errorResponse.Error.Code != CodeJobNotFound || errorResponse.Error.Message != job.ErrNotFound.Error() {
+		t.Errorf("GetStatus() expected error: %v, got %+v", job.ErrNotFound.Error(), errorResponse.Error)
 	}
 }
 
@@ -163,7 +298,7 @@ func TestWrongUserNotFound(t *testing.T) {
 	ts, id := initTestServer(t)
 
 	// GetStatus request, with wrong token (user2token)
-	request, _ := http.NewRequest("GET", ts.URL+"/jobs/"+id, nil)
+	request, _ := http.NewRequest("GET", ts.URL+"/v1/jobs/"+id, nil)
 	request.Header.Set("Authorization", "Bearer "+user2token)
 	request.Header.Set("Content-Type", "application/json")
 
@@ -176,21 +311,21 @@ func TestWrongUserNotFound(t *testing.T) {
 	}
 	defer response.Body.Close()
 
-	var statusResponse StatusResponse
-	err = json.NewDecoder(response.Body).Decode(&statusResponse)
+	var errorResponse ErrorResponse
+	err = json.NewDecoder(response.Body).Decode(&errorResponse)
 	if err != nil {
 		t.Errorf("JSON decoding error: %s", err.Error())
 	}
 
-	if *statusResponse.Error != job.ErrNotFound.Error() {
-		t.Errorf("GetStatus() expected error: %v, got %v", job.ErrNotFound.Error(), *statusResponse.Error)
+	if errorResponse.Error.Code != CodeJobNotFound || errorResponse.Error.Message != job.ErrNotFound.Error() {
+		t.Errorf("GetStatus() expected error: %v, got %+v", job.ErrNotFound.Error(), errorResponse.Error)
 	}
 }
 
 func TestUnauthorized(t *testing.T) {
 	ts, id := initTestServer(t)
 
-	request, _ := http.NewRequest("GET", ts.URL+"/jobs/"+id, nil)
+	request, _ := http.NewRequest("GET", ts.URL+"/v1/jobs/"+id, nil)
 	request.Header.Set("Authorization", "Bearer "+fakeusertoken)
 	request.Header.Set("Content-Type", "application/json")
 
@@ -203,3 +338,393 @@ func TestUnauthorized(t *testing.T) {
 	}
 	response.Body.Close()
 }
+
+func TestLogsHandlerBadSince(t *testing.T) {
+	ts, id := initTestServer(t)
+
+	request, _ := http.NewRequest("GET", ts.URL+"/v1/jobs/"+id+"/logs?since=yesterday", nil)
+	request.Header.Set("Authorization", "Bearer "+user1token)
+
+	response, err := ts.Client().Do(request)
+	if err != nil {
+		t.Errorf("Do() error: %s", err.Error())
+	}
+	if response.StatusCode != http.StatusBadRequest {
+		t.Errorf("getLogsHandler() expected %d, got %d", http.StatusBadRequest, response.StatusCode)
+	}
+	response.Body.Close()
+}
+
+func TestStartHandlerPipeline(t *testing.T) {
+	ts, _ := initTestServer(t)
+
+	pipeline := `{"pipeline":[{"program":"/bin/echo","args":["hello world"]},{"program":"/usr/bin/tr","args":["a-z","A-Z"]}]}`
+	request, _ := http.NewRequest("POST", ts.URL+"/v1/jobs/start", bytes.NewBufferString(pipeline))
+	request.Header.Set("Authorization", "Bearer "+user1token)
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := ts.Client().Do(request)
+	if err != nil {
+		t.Errorf("Do() error: %s", err.Error())
+	}
+	if response.StatusCode != http.StatusCreated {
+		t.Errorf("startHandler() expected %d, got %d", http.StatusCreated, response.StatusCode)
+	}
+	response.Body.Close()
+
+	// a job is either a program or a pipeline
+	invalid := `{"program":"/bin/echo","pipeline":[{"program":"/bin/cat"}]}`
+	request, _ = http.NewRequest("POST", ts.URL+"/v1/jobs/start", bytes.NewBufferString(invalid))
+	request.Header.Set("Authorization", "Bearer "+user1token)
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err = ts.Client().Do(request)
+	if err != nil {
+		t.Errorf("Do() error: %s", err.Error())
+	}
+	if response.StatusCode != http.StatusBadRequest {
+		t.Errorf("startHandler() expected %d, got %d", http.StatusBadRequest, response.StatusCode)
+	}
+	response.Body.Close()
+}
+
+// startWithKey sends a start request with an idempotency key, and returns the response status and job ID.
+func startWithKey(t *testing.T, ts *httptest.Server, token, key, body string) (int, string) {
+	t.Helper()
+
+	request, _ := http.NewRequest("POST", ts.URL+"/v1/jobs/start", bytes.NewBufferString(body))
+	request.Header.Set("Authorization", "Bearer "+token)
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(IdempotencyKeyHeader, key)
+
+	response, err := ts.Client().Do(request)
+	if err != nil {
+		t.Fatalf("Do() error: %s", err.Error())
+	}
+	defer response.Body.Close()
+
+	var startResponse StartResponse
+	json.NewDecoder(response.Body).Decode(&startResponse)
+	return response.StatusCode, startResponse.ID
+}
+
+func TestStartHandlerIdempotencyKey(t *testing.T) {
+	ts, _ := initTestServer(t)
+
+	shortCmd := `{"program":"/bin/echo","args":["hello world"]}`
+	code, id := startWithKey(t, ts, user1token, "key-1", shortCmd)
+	if code != http.StatusCreated {
+		t.Errorf("startHandler() expected %d, got %d", http.StatusCreated, code)
+	}
+
+	// retry with the same key and body returns the original job
+	code, retryID := startWithKey(t, ts, user1token, "key-1", ` {"args":["hello world"], "program":"/bin/echo"}`)
+	if code != http.StatusCreated || retryID != id {
+		t.Errorf("startHandler() expected %d with ID %s, got %d with ID %s", http.StatusCreated, id, code, retryID)
+	}
+
+	// same key with a different body is a conflict
+	code, _ = startWithKey(t, ts, user1token, "key-1", `{"program":"/bin/echo","args":["bye"]}`)
+	if code != http.StatusConflict {
+		t.Errorf("startHandler() expected %d, got %d", http.StatusConflict, code)
+	}
+
+	// keys are scoped to the user
+	code, otherID := startWithKey(t, ts, user2token, "key-1", shortCmd)
+	if code != http.StatusCreated || otherID == id {
+		t.Errorf("startHandler() expected %d with a new ID, got %d with ID %s", http.StatusCreated, code, otherID)
+	}
+}
+
+func TestIdempotencyWindow(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		store := newIdempotencyStore(time.Minute)
+		starts := 0
+		start := func() (string, error) {
+			starts++
+			return fmt.Sprintf("job-%d", starts), nil
+		}
+
+		first, _, _ := store.do("user1", "key", []byte("request"), start)
+		second, replayed, _ := store.do("user1", "key", []byte("request"), start)
+		if !replayed || second != first {
+			t.Errorf("do() expected replayed %s, got %s", first, second)
+		}
+
+		// the key is forgotten after the window
+		time.Sleep(2 * time.Minute)
+		third, replayed, _ := store.do("user1", "key", []byte("request"), start)
+		if replayed || third == first {
+			t.Errorf("do() expected a new job after the window, got %s", third)
+		}
+	})
+}
+
+func TestIdempotencyLimits(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		store := newIdempotencyStore(time.Minute)
+		store.maxPerUser = 2
+		start := func() (string, error) { return "job", nil }
+
+		for _, key := range []string{"key-1", "key-2"} {
+			if _, _, err := store.do("user1", key, []byte("request"), start); err != nil {
+				t.Errorf("do() error: %s", err.Error())
+			}
+		}
+		if _, _, err := store.do("user1", "key-3", []byte("request"), start); !errors.Is(err, errTooManyIdempotencyKeys) {
+			t.Errorf("do() expected error: %s, got: %v", errTooManyIdempotencyKeys, err)
+		}
+		if _, _, err := store.do("user2", "key-3", []byte("request"), start); err != nil {
+			t.Errorf("do() error for another user: %s", err.Error())
+		}
+
+		// expired keys no longer count
+		time.Sleep(2 * time.Minute)
+		if _, _, err := store.do("user1", "key-3", []byte("request"), start); err != nil {
+			t.Errorf("do() error after the window: %s", err.Error())
+		}
+	})
+}
+
+func TestIdempotencyConcurrentKeys(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		store := newIdempotencyStore(time.Minute)
+		release := make(chan struct{})
+		starts := 0
+		blockedStart := func() (string, error) {
+			starts++
+			<-release
+			return "job-1", nil
+		}
+
+		first := make(chan string)
+		go func() {
+			jobID, _, _ := store.do("user1", "key-1", []byte("request"), blockedStart)
+			first <- jobID
+		}()
+		synctest.Wait()
+
+		// another key is not blocked by the start in progress
+		jobID, _, err := store.do("user2", "key-2", []byte("request"), func() (string, error) { return "job-2", nil })
+		if err != nil || jobID != "job-2" {
+			t.Errorf("do() expected job-2, got %s, %v", jobID, err)
+		}
+
+		// a retry with the same key waits for the start in progress, and replays it
+		retry := make(chan string)
+		go func() {
+			jobID, replayed, _ := store.do("user1", "key-1", []byte("request"), blockedStart)
+			if !replayed {
+				jobID = "not replayed"
+			}
+			retry <- jobID
+		}()
+		synctest.Wait()
+
+		close(release)
+		if jobID, retryID := <-first, <-retry; jobID != "job-1" || retryID != "job-1" || starts != 1 {
+			t.Errorf("do() expected one start of job-1, got %s and %s after %d starts", jobID, retryID, starts)
+		}
+	})
+}
+
+func TestStartHandlerIdempotencyKeyLength(t *testing.T) {
+	ts, _ := initTestServer(t)
+
+	code, _ := startWithKey(t, ts, user1token, strings.Repeat("k", maxIdempotencyKeyLength+1),
+		`{"program":"/bin/echo","args":["hello world"]}`)
+	if code != http.StatusBadRequest {
+		t.Errorf("startHandler() expected %d, got %d", http.StatusBadRequest, code)
+	}
+}
+
+func TestStartHandlerDraining(t *testing.T) {
+	manager := job.NewManager()
+	ts := httptest.NewTLSServer(NewServer(manager, withTestTokens()))
+	defer ts.Close()
+
+	if _, err := manager.Shutdown(context.Background(), job.ShutdownStop); err != nil {
+		t.Errorf("Shutdown() error: %s", err.Error())
+	}
+
+	shortCmd := `{"program":"/bin/echo","args":["hello world"]}`
+	request, _ := http.NewRequest("POST", ts.URL+"/v1/jobs/start", bytes.NewBufferString(shortCmd))
+	request.Header.Set("Authorization", "Bearer "+user1token)
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := ts.Client().Do(request)
+	if err != nil {
+		t.Errorf("Do() error: %s", err.Error())
+	}
+	if response.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("startHandler() expected %d, got %d", http.StatusServiceUnavailable, response.StatusCode)
+	}
+	response.Body.Close()
+}
+
+func TestTokenAuthentication(t *testing.T) {
+	revocations := &token.RevocationList{Revoked: map[string]int64{}}
+	revoked := token.NewClaims("user1", job.User, DefaultAudience, time.Hour)
+	revocations.Revoke(revoked.ID, revoked.Expiry())
+	expired := token.NewClaims("user1", job.User, DefaultAudience, time.Hour)
+	expired.ExpiresAt = time.Now().Add(-time.Minute).Unix()
+
+	jobMetrics := metrics.New()
+	verifier := token.NewVerifier(testKeys, revocations, DefaultAudience)
+	ts := httptest.NewTLSServer(NewServer(job.NewManager(), WithTokenVerifier(verifier), WithMetrics(jobMetrics)))
+	defer ts.Close()
+
+	sign := func(claims token.Claims) string {
+		signed, _ := testKeys.Sign(claims)
+		return signed
+	}
+	tests := []struct {
+		token  string
+		code   int
+		reason string
+	}{
+		{user1token, http.StatusNotFound, ""},
+		{"", http.StatusUnauthorized, authMissingToken},
+		{sign(expired), http.StatusUnauthorized, authExpiredToken},
+		{sign(revoked), http.StatusUnauthorized, authRevokedToken},
+		{sign(token.NewClaims("user1", job.User, "another", time.Hour)), http.StatusUnauthorized, authInvalidToken},
+		{sign(token.NewClaims("user1", "", DefaultAudience, time.Hour)), http.StatusUnauthorized, authInvalidToken},
+	}
+
+	for _, test := range tests {
+		request, _ := http.NewRequest("GET", ts.URL+"/v1/jobs/fake_id", nil)
+		if test.token != "" {
+			request.Header.Set("Authorization", "Bearer "+test.token)
+		}
+		response, err := ts.Client().Do(request)
+		if err != nil {
+			t.Fatalf("Do() error: %s", err.Error())
+		}
+		response.Body.Close()
+
+		if response.StatusCode != test.code {
+			t.Errorf("bearerAuth() %s expected %d, got %d", test.reason, test.code, response.StatusCode)
+		}
+	}
+
+	body := scrapeMetrics(t, jobMetrics)
+	for _, reason := range []string{authMissingToken, authExpiredToken, authRevokedToken} {
+		want := fmt.Sprintf(`jobworker_auth_failures_total{reason="%s"} 1`, reason)
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics expected %s", want)
+		}
+	}
+	if want := `jobworker_auth_failures_total{reason="invalid_token"} 2`; !strings.Contains(body, want) {
+		t.Errorf("metrics expected %s", want)
+	}
+}
+
+// scrapeMetrics returns the text exposition of jobMetrics.
+func scrapeMetrics(t *testing.T, jobMetrics *metrics.Metrics) string {
+	t.Helper()
+
+	recorder := httptest.NewRecorder()
+	jobMetrics.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	return recorder.Body.String()
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	jobMetrics := metrics.New()
+	ts := httptest.NewTLSServer(NewServer(job.NewManager(), withTestTokens(), WithMetrics(jobMetrics), WithMetricsEndpoint()))
+	defer ts.Close()
+
+	request, _ := http.NewRequest("GET", ts.URL+"/v1/jobs/fake_id", nil)
+	request.Header.Set("Authorization", "Bearer "+fakeusertoken)
+	response, err := ts.Client().Do(request)
+	if err != nil {
+		t.Fatalf("Do() error: %s", err.Error())
+	}
+	response.Body.Close()
+
+	// metrics are served without authentication
+	response, err = ts.Client().Get(ts.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("Get() error: %s", err.Error())
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		t.Errorf("metrics endpoint expected %d, got %d", http.StatusOK, response.StatusCode)
+	}
+
+	body, _ := io.ReadAll(response.Body)
+	for _, want := range []string{
+		`jobworker_auth_failures_total{reason="invalid_token"} 1`,
+		`jobworker_http_requests_total{code="401",route="GET /v1/jobs/{id}"} 1`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("metrics endpoint expected metric %s", want)
+		}
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	auditLog, err := audit.Open(filepath.Join(t.TempDir(), "audit.log"))
+	if err != nil {
+		t.Fatalf("Open() error: %s", err.Error())
+	}
+	defer auditLog.Close()
+
+	ts := httptest.NewTLSServer(NewServer(job.NewManager(), withTestTokens(), WithAuditLog(auditLog)))
+	defer ts.Close()
+
+	do := func(method, path, token, body string) int {
+		request, _ := http.NewRequest(method, ts.URL+path, bytes.NewBufferString(body))
+		request.Header.Set("Authorization", "Bearer "+token)
+		response, err := ts.Client().Do(request)
+		if err != nil {
+			t.Fatalf("Do() error: %s", err.Error())
+		}
+		response.Body.Close()
+		return response.StatusCode
+	}
+
+	do("POST", "/v1/jobs/start", user1token, `{"program":"/bin/echo","args":["hello world"]}`)
+	records, _ := auditLog.Query(audit.Filter{})
+	if len(records) != 1 {
+		t.Fatalf("Query() expected 1 record, got %d", len(records))
+	}
+	jobID := records[0].JobID
+
+	// denied: another user's job, an invalid token, and a non-admin querying the audit log
+	do("POST", "/v1/jobs/"+jobID+"/stop", user2token, "")
+	do("GET", "/v1/jobs/"+jobID, fakeusertoken, "")
+	if code := do("GET", "/v1/audit", user1token, ""); code != http.StatusForbidden {
+		t.Errorf("getAuditHandler() expected %d, got %d", http.StatusForbidden, code)
+	}
+
+	request, _ := http.NewRequest("GET", ts.URL+"/v1/audit?job="+jobID, nil)
+	request.Header.Set("Authorization", "Bearer "+admin1token)
+	response, err := ts.Client().Do(request)
+	if err != nil {
+		t.Fatalf("Do() error: %s", err.Error())
+	}
+	defer response.Body.Close()
+
+	var auditResponse AuditResponse
+	json.NewDecoder(response.Body).Decode(&auditResponse)
+	if response.StatusCode != http.StatusOK {
+		t.Errorf("getAuditHandler() expected %d, got %d", http.StatusOK, response.StatusCode)
+	}
+
+	expected := []audit.Record{
+		{User: "user1", Role: job.User, Action: actionStart, Program: "/bin/echo", Result: audit.ResultSuccess, Code: http.StatusCreated},
+		{User: "user2", Role: job.User, Action: actionStop, Result: audit.ResultDenied, Code: http.StatusNotFound},
+		{Action: actionStatus, Result: audit.ResultDenied, Code: http.StatusUnauthorized},
+	}
+	if len(auditResponse.Records) != len(expected) {
+		t.Fatalf("getAuditHandler() expected %d records, got %+v", len(expected), auditResponse.Records)
+	}
+	for i, record := range auditResponse.Records {
+		want := expected[i]
+		if record.User != want.User || record.Role != want.Role || record.Action != want.Action ||
+			record.Program != want.Program || record.Result != want.Result || record.Code != want.Code ||
+			record.JobID != jobID || record.SourceIP != "127.0.0.1" {
+			t.Errorf("getAuditHandler() expected record %+v, got %+v", want, record)
+		}
+	}
+}
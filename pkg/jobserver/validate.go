@@ -0,0 +1,89 @@
+package jobserver
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"teleport-jobworker/pkg/job"
+)
+
+// Limits of request bodies and job commands
+const (
+	// maxRequestBody bounds the size of JSON request bodies.
+	maxRequestBody = 1 << 20
+	// maxArgs bounds the number of arguments of each command.
+	maxArgs = 1024
+	// maxArgsSize bounds the total size of the arguments of every command of a job.
+	maxArgsSize = 256 << 10
+)
+
+// invalidField creates a field-level INVALID_REQUEST error.
+func invalidField(field, format string, args ...any) *Error {
+	return newError(CodeInvalidRequest, fmt.Sprintf(format, args...), map[string]string{"field": field})
+}
+
+// invalidCommand creates a field-level INVALID_COMMAND error.
+func invalidCommand(field, format string, args ...any) *Error {
+	return newError(CodeInvalidCommand, fmt.Sprintf("%s: %s", job.ErrInvalidCommand, fmt.Sprintf(format, args...)),
+		map[string]string{"field": field})
+}
+
+// validateCommands checks the commands of a job before starting it: each program must be an absolute
+// path to an executable file, and the arguments must stay within the limits. prefix is the field
+// of the commands in the request, eg. "pipeline" for a pipeline, or empty for a single program.
+func validateCommands(commands []job.Command, prefix string) error {
+	var argsSize int
+	for i, command := range commands {
+		field := func(name string) string {
+			if prefix == "" {
+				return name
+			}
+			return fmt.Sprintf("%s[%d].%s", prefix, i, name)
+		}
+
+		if err := validateProgram(command.Program); err != nil {
+			return invalidCommand(field("program"), "%s", err)
+		}
+
+		if len(command.Args) > maxArgs {
+			return invalidCommand(field("args"), "%d arguments, the limit is %d", len(command.Args), maxArgs)
+		}
+		for j, arg := range command.Args {
+			if strings.ContainsRune(arg, 0) {
+				return invalidCommand(fmt.Sprintf("%s[%d]", field("args"), j), "argument contains a NUL byte")
+			}
+			argsSize += len(arg)
+		}
+		if argsSize > maxArgsSize {
+			return invalidCommand(field("args"), "arguments exceed %d bytes", maxArgsSize)
+		}
+	}
+	return nil
+}
+
+// validateProgram checks that program is an absolute path to an executable file.
+func validateProgram(program string) error {
+	switch {
+	case program == "":
+		return errors.New("program is required")
+	case !filepath.IsAbs(program):
+		return fmt.Errorf("program %q must be an absolute path", program)
+	case strings.ContainsRune(program, 0):
+		return errors.New("program contains a NUL byte")
+	}
+
+	info, err := os.Stat(program)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("program %s not found", program)
+	}
+	if err != nil {
+		return fmt.Errorf("program %s cannot be accessed", program)
+	}
+	if !info.Mode().IsRegular() || info.Mode().Perm()&0o111 == 0 {
+		return fmt.Errorf("program %s is not an executable file", program)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package jobserver
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"teleport-jobworker/pkg/job"
+	"testing"
+)
+
+func TestStartValidation(t *testing.T) {
+	ts, _ := initTestServer(t)
+
+	notExecutable := filepath.Join(t.TempDir(), "script.sh")
+	if err := os.WriteFile(notExecutable, []byte("#!/bin/sh\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile() error: %s", err.Error())
+	}
+	manyArgs, _ := json.Marshal(make([]string, maxArgs+1))
+	largeArgs, _ := json.Marshal([]string{strings.Repeat("a", maxArgsSize/2), strings.Repeat("a", maxArgsSize/2+1)})
+
+	tests := []struct {
+		name  string
+		body  string
+		code  ErrorCode
+		field string
+	}{
+		{"empty program", `{"program": ""}`, CodeInvalidCommand, "program"},
+		{"relative program", `{"program": "echo"}`, CodeInvalidCommand, "program"},
+		{"missing program", `{"program": "/nonexistent/echo"}`, CodeInvalidCommand, "program"},
+		{"directory", `{"program": "/bin"}`, CodeInvalidCommand, "program"},
+		{"not executable", `{"program": "` + notExecutable + `"}`, CodeInvalidCommand, "program"},
+		{"too many arguments", `{"program": "/bin/echo", "args": ` + string(manyArgs) + `}`, CodeInvalidCommand, "args"},
+		{"arguments too large", `{"program": "/bin/echo", "args": ` + string(largeArgs) + `}`, CodeInvalidCommand, "args"},
+		{"NUL byte", `{"program": "/bin/echo", "args": ["a", "b\u0000"]}`, CodeInvalidCommand, "args[1]"},
+		{"pipeline stage", `{"pipeline": [{"program": "/bin/echo"}, {"program": "cat"}]}`, CodeInvalidCommand, "pipeline[1].program"},
+		{"program and pipeline", `{"program": "/bin/echo", "pipeline": [{"program": "/bin/cat"}]}`, CodeInvalidRequest, "program"},
+		{"unknown field", `{"program": "/bin/echo", "argv": ["hello"]}`, CodeInvalidRequest, "argv"},
+		{"wrong type", `{"program": "/bin/echo", "args": "hello"}`, CodeInvalidRequest, "args"},
+		{"body too large", `{"program": "/bin/echo", "args": ["` + strings.Repeat("a", maxRequestBody) + `"]}`, CodeInvalidRequest, ""},
+	}
+
+	for _, test := range tests {
+		request, _ := http.NewRequest("POST", ts.URL+"/v1/jobs/start", strings.NewReader(test.body))
+		request.Header.Set("Authorization", "Bearer "+user1token)
+		response, err := ts.Client().Do(request)
+		if err != nil {
+			t.Fatalf("%s: Do() error: %s", test.name, err.Error())
+		}
+
+		var errorResponse ErrorResponse
+		json.NewDecoder(response.Body).Decode(&errorResponse)
+		response.Body.Close()
+
+		got := errorResponse.Error
+		if response.StatusCode != http.StatusBadRequest || got.Code != test.code || got.Details["field"] != test.field {
+			t.Errorf("%s: expected 400 %s for field %q, got %d %+v", test.name, test.code, test.field, response.StatusCode, got)
+		}
+	}
+
+	// valid requests still start jobs
+	if _, err := testClient(ts, user1token).StartJob("/bin/echo", []string{"hello world"}); err != nil {
+		t.Errorf("StartJob() error: %s", err.Error())
+	}
+}
+
+func TestGRPCStartValidation(t *testing.T) {
+	client := initTestGRPC(t)(user1token)
+
+	_, err := client.StartJob("bin/echo", nil)
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || !errors.Is(err, job.ErrInvalidCommand) || apiErr.Details["field"] != "program" {
+		t.Errorf("StartJob() expected %s for program, got %v", job.ErrInvalidCommand, err)
+	}
+}
@@ -0,0 +1,93 @@
+package jobserver
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"teleport-jobworker/pkg/jobpb"
+	"time"
+)
+
+// Timeouts of long-polling wait requests
+const (
+	DefaultWaitTimeout = 30 * time.Second
+	// MaxWaitTimeout caps the timeout of wait requests, so they don't hold connections indefinitely.
+	MaxWaitTimeout = 5 * time.Minute
+)
+
+// waitTimeout applies the default and maximum wait timeouts to a requested timeout, zero if unset.
+func waitTimeout(timeout time.Duration) time.Duration {
+	if timeout == 0 {
+		return DefaultWaitTimeout
+	}
+	return min(timeout, MaxWaitTimeout)
+}
+
+// waitHandler handles HTTPS requests to GET /v1/jobs/{id}/wait?timeout=<duration>, blocking until the job
+// reached a final state or the timeout passed, then responding with the job status.
+func (s *Server) waitHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	var timeout time.Duration
+	if value := r.URL.Query().Get("timeout"); value != "" {
+		var err error
+		timeout, err = time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			responseError(w, invalidParameter("timeout", "invalid timeout %q, expected a positive duration, eg. 60s", value))
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), waitTimeout(timeout))
+	defer cancel()
+
+	status, err := s.manager.Wait(ctx, id)
+	if r.Context().Err() != nil {
+		// the client went away
+		return
+	}
+	if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		responseError(w, err)
+		return
+	}
+
+	responseJSON(w, StatusResponse{
+		ID:             id,
+		Status:         status.State,
+		ExitCode:       status.ExitCode,
+		StageExitCodes: status.StageExitCodes,
+		Signal:         int(status.Signal),
+	}, http.StatusOK)
+}
+
+func (j *jobService) Wait(ctx context.Context, request *jobpb.WaitRequest) (*jobpb.WaitResponse, error) {
+	var timeout time.Duration
+	if request.Timeout != nil {
+		if err := request.Timeout.CheckValid(); err != nil || request.Timeout.AsDuration() <= 0 {
+			return nil, grpcError(invalidField("timeout", "invalid timeout, expected a positive duration"))
+		}
+		timeout = request.Timeout.AsDuration()
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, waitTimeout(timeout))
+	defer cancel()
+
+	jobStatus, err := j.manager.Wait(waitCtx, request.Id)
+	if ctx.Err() != nil {
+		return nil, grpcError(ctx.Err())
+	}
+	if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		return nil, grpcError(err)
+	}
+
+	response := &jobpb.WaitResponse{
+		Id:       request.Id,
+		Status:   jobStatus.State,
+		ExitCode: optionalInt32(jobStatus.ExitCode),
+		Signal:   int32(jobStatus.Signal),
+	}
+	for _, code := range jobStatus.StageExitCodes {
+		response.StageExitCodes = append(response.StageExitCodes, int32(code))
+	}
+	return response, nil
+}
@@ -0,0 +1,90 @@
+package jobserver
+
+import (
+	"errors"
+	"net/http"
+	"teleport-jobworker/pkg/job"
+	"testing"
+	"time"
+)
+
+func TestWaitHandler(t *testing.T) {
+	ts, _ := initTestServer(t)
+	client := testClient(ts, user1token)
+
+	started, err := client.StartJob("/bin/sleep", []string{"0.5"})
+	if err != nil {
+		t.Fatalf("StartJob() error: %s", err.Error())
+	}
+
+	// the timeout passes first, returning the current status
+	status, err := client.WaitJob(started.ID, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("WaitJob() error: %s", err.Error())
+	}
+	if status.Status != job.Running || status.ExitCode != nil {
+		t.Errorf("WaitJob() expected job %s running, got %+v", started.ID, status)
+	}
+
+	status, err = client.WaitJob(started.ID, time.Minute)
+	if err != nil {
+		t.Fatalf("WaitJob() error: %s", err.Error())
+	}
+	if status.Status != job.Completed || status.ExitCode == nil || *status.ExitCode != 0 {
+		t.Errorf("WaitJob() expected job %s completed, got %+v", started.ID, status)
+	}
+
+	// other users don't see the job
+	if _, err := testClient(ts, user2token).WaitJob(started.ID, 0); !errors.Is(err, job.ErrNotFound) {
+		t.Errorf("WaitJob() expected %s, got %v", job.ErrNotFound, err)
+	}
+
+	for _, timeout := range []string{"soon", "-1s", "0s"} {
+		request, _ := http.NewRequest("GET", ts.URL+"/v1/jobs/"+started.ID+"/wait?timeout="+timeout, nil)
+		request.Header.Set("Authorization", "Bearer "+user1token)
+		response, err := ts.Client().Do(request)
+		if err != nil {
+			t.Fatalf("Do() error: %s", err.Error())
+		}
+		err = responseErr(response)
+		response.Body.Close()
+
+		var apiErr *Error
+		if !errors.As(err, &apiErr) || apiErr.Code != CodeInvalidRequest || apiErr.Details["parameter"] != "timeout" {
+			t.Errorf("GET /wait?timeout=%s expected %s for timeout, got %v", timeout, CodeInvalidRequest, err)
+		}
+	}
+}
+
+func TestGRPCWaitJob(t *testing.T) {
+	client := initTestGRPC(t)(user1token)
+
+	started, err := client.StartJob("/bin/sh", []string{"-c", "sleep 0.2; exit 3"})
+	if err != nil {
+		t.Fatalf("StartJob() error: %s", err.Error())
+	}
+
+	status, err := client.WaitJob(started.ID, time.Minute)
+	if err != nil {
+		t.Fatalf("WaitJob() error: %s", err.Error())
+	}
+	if status.Status != job.Completed || status.ExitCode == nil || *status.ExitCode != 3 {
+		t.Errorf("WaitJob() expected job %s completed with exit code 3, got %+v", started.ID, status)
+	}
+}
+
+func TestWaitTimeout(t *testing.T) {
+	tests := []struct {
+		requested, expected time.Duration
+	}{
+		{0, DefaultWaitTimeout},
+		{time.Second, time.Second},
+		{time.Hour, MaxWaitTimeout},
+	}
+
+	for _, test := range tests {
+		if got := waitTimeout(test.requested); got != test.expected {
+			t.Errorf("waitTimeout(%s) = %s, expected %s", test.requested, got, test.expected)
+		}
+	}
+}
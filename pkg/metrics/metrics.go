@@ -0,0 +1,215 @@
+// Package metrics collects Prometheus metrics of the job service,
+// from job.Manager lifecycle events and from middleware around the HTTPS API.
+package metrics
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"teleport-jobworker/pkg/job"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "jobworker"
+
+// Metrics holds every metric of the job service in its own registry.
+// It implements job.Observer to collect job lifecycle events.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	jobsStarted  *prometheus.CounterVec
+	jobsFinished *prometheus.CounterVec
+	jobsFailed   *prometheus.CounterVec
+	jobDuration  *prometheus.HistogramVec
+
+	httpRequests *prometheus.CounterVec
+	httpDuration *prometheus.HistogramVec
+	authFailures *prometheus.CounterVec
+}
+
+// New creates the metrics of the job service, along with Go runtime and process metrics.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+
+		jobsStarted: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "jobs_started_total",
+			Help:      "Number of jobs started, by user.",
+		}, []string{"user"}),
+		jobsFinished: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "jobs_finished_total",
+			Help:      "Number of jobs that reached a final state, by user and state.",
+		}, []string{"user", "state"}),
+		jobsFailed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "jobs_failed_total",
+			Help:      "Number of jobs whose processes failed to start, by user.",
+		}, []string{"user"}),
+		jobDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "job_duration_seconds",
+			Help:      "Duration of jobs from start to final state, by state.",
+			Buckets:   prometheus.ExponentialBuckets(0.1, 4, 9),
+		}, []string{"state"}),
+
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "Number of HTTP requests, by route and status code.",
+		}, []string{"route", "code"}),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Latency of HTTP requests, by route and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "code"}),
+		authFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "auth_failures_total",
+			Help:      "Number of requests that failed authentication, by reason.",
+		}, []string{"reason"}),
+	}
+
+	m.registry.MustRegister(
+		m.jobsStarted, m.jobsFinished, m.jobsFailed, m.jobDuration,
+		m.httpRequests, m.httpDuration, m.authFailures,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	return m
+}
+
+// RegisterManager adds gauges computed from the Manager's jobs at scrape time.
+func (m *Metrics) RegisterManager(manager *job.Manager) {
+	gauge := func(name, help string, value func(job.Stats) int) prometheus.GaugeFunc {
+		return prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      name,
+			Help:      help,
+		}, func() float64 {
+			return float64(value(manager.Stats()))
+		})
+	}
+
+	m.registry.MustRegister(
+		gauge("jobs_running", "Number of jobs currently running.",
+			func(s job.Stats) int { return s.Running }),
+		gauge("jobs_queued", "Number of jobs created and waiting for their processes to start.",
+			func(s job.Stats) int { return s.Starting }),
+		gauge("output_bytes", "Bytes of stdout and stderr records stored for every job, including their overhead.",
+			func(s job.Stats) int { return s.OutputBytes }),
+	)
+}
+
+// RegisterCertificate adds a gauge of the expiry time of the server TLS certificate, computed at scrape time
+// to follow certificate reloads.
+func (m *Metrics) RegisterCertificate(notAfter func() time.Time) {
+	m.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "tls_certificate_expiry_timestamp_seconds",
+		Help:      "Expiry time of the server TLS certificate, in seconds since the Unix epoch.",
+	}, func() float64 {
+		return float64(notAfter().Unix())
+	}))
+}
+
+// JobStarted implements job.Observer.
+func (m *Metrics) JobStarted(userID string) {
+	m.jobsStarted.WithLabelValues(userID).Inc()
+}
+
+// JobFinished implements job.Observer.
+func (m *Metrics) JobFinished(userID string, status job.JobStatus, duration time.Duration) {
+	m.jobsFinished.WithLabelValues(userID, status.State).Inc()
+	if status.State == job.Failed {
+		m.jobsFailed.WithLabelValues(userID).Inc()
+	}
+	m.jobDuration.WithLabelValues(status.State).Observe(duration.Seconds())
+}
+
+// AuthFailure counts a request that failed authentication.
+func (m *Metrics) AuthFailure(reason string) {
+	m.authFailures.WithLabelValues(reason).Inc()
+}
+
+// Registry returns the registry of the metrics, eg. to register more collectors.
+func (m *Metrics) Registry() *prometheus.Registry {
+	return m.registry
+}
+
+// Handler serves the metrics in the Prometheus text exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// Middleware counts requests and observes their latency, by route pattern and status code.
+// next must be a http.ServeMux, or a handler passing requests to one, for routes to be known.
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := NewStatusRecorder(w)
+
+		next.ServeHTTP(recorder, r)
+
+		// the mux records the matched pattern on the request
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		code := strconv.Itoa(recorder.Code)
+		m.httpRequests.WithLabelValues(route, code).Inc()
+		m.httpDuration.WithLabelValues(route, code).Observe(time.Since(start).Seconds())
+	})
+}
+
+// StatusRecorder captures the status code written by a handler, eg. for metrics and audit logs.
+type StatusRecorder struct {
+	http.ResponseWriter
+	// Code is the status code written by the handler, 200 OK unless it wrote another.
+	Code        int
+	wroteHeader bool
+}
+
+// NewStatusRecorder wraps w to capture the status code written to it.
+func NewStatusRecorder(w http.ResponseWriter) *StatusRecorder {
+	return &StatusRecorder{ResponseWriter: w, Code: http.StatusOK}
+}
+
+func (s *StatusRecorder) WriteHeader(code int) {
+	if !s.wroteHeader {
+		s.Code = code
+		s.wroteHeader = true
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+// Flush allows streaming responses through the recorder.
+func (s *StatusRecorder) Flush() {
+	if flusher, ok := s.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack allows WebSocket upgrades through the recorder, recorded as 101 Switching Protocols.
+func (s *StatusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := s.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response does not implement http.Hijacker")
+	}
+	s.Code = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
+
+// Unwrap allows http.ResponseController to reach the underlying ResponseWriter.
+func (s *StatusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
@@ -0,0 +1,98 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"teleport-jobworker/pkg/job"
+	"testing"
+	"time"
+)
+
+// scrape returns the metrics served by the Handler in the text exposition format.
+func scrape(t *testing.T, m *Metrics) string {
+	t.Helper()
+
+	recorder := httptest.NewRecorder()
+	m.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(recorder.Body)
+	return string(body)
+}
+
+// waitFinished polls the status of a job until it reached a final state.
+func waitFinished(ctx context.Context, manager *job.Manager, id string) {
+	for {
+		status, _ := manager.GetStatus(ctx, id)
+		if status.State != job.Starting && status.State != job.Running {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestJobMetrics(t *testing.T) {
+	m := New()
+	manager := job.NewManager(job.WithObserver(m))
+	m.RegisterManager(manager)
+	ctx := job.WithUserInfo(context.Background(), "user1", job.User)
+
+	completedID, _ := manager.Start(ctx, "/bin/echo", []string{"hello world"})
+	failedID, _ := manager.Start(ctx, "/invalid/cmd", nil)
+	waitFinished(ctx, manager, completedID)
+	waitFinished(ctx, manager, failedID)
+	// observer notifications are asynchronous
+	time.Sleep(50 * time.Millisecond)
+
+	body := scrape(t, m)
+	for _, want := range []string{
+		`jobworker_jobs_started_total{user="user1"} 2`,
+		`jobworker_jobs_finished_total{state="completed",user="user1"} 1`,
+		`jobworker_jobs_finished_total{state="failed",user="user1"} 1`,
+		`jobworker_jobs_failed_total{user="user1"} 1`,
+		`jobworker_job_duration_seconds_count{state="completed"} 1`,
+		`jobworker_jobs_running 0`,
+		`jobworker_output_bytes 76`, // one record of 12 bytes, and its overhead
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Handler() expected metric %s", want)
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	m := New()
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /jobs/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	handler := m.Middleware(mux)
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/jobs/12345", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/unknown", nil))
+	m.AuthFailure("invalid_token")
+
+	body := scrape(t, m)
+	for _, want := range []string{
+		`jobworker_http_requests_total{code="404",route="GET /jobs/{id}"} 1`,
+		`jobworker_http_requests_total{code="404",route="unmatched"} 1`,
+		`jobworker_http_request_duration_seconds_count{code="404",route="GET /jobs/{id}"} 1`,
+		`jobworker_auth_failures_total{reason="invalid_token"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Handler() expected metric %s", want)
+		}
+	}
+}
+
+func TestCertificateMetrics(t *testing.T) {
+	m := New()
+	notAfter := time.Unix(1700000000, 0)
+	m.RegisterCertificate(func() time.Time { return notAfter })
+
+	want := `jobworker_tls_certificate_expiry_timestamp_seconds 1.7e+09`
+	if body := scrape(t, m); !strings.Contains(body, want) {
+		t.Errorf("Handler() expected metric %s", want)
+	}
+}
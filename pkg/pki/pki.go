@@ -0,0 +1,201 @@
+// Package pki creates a local certificate authority, and issues the server certificate of jobserver
+// and the client certificates of users with it, with ECDSA P-256 or Ed25519 keys.
+package pki
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"teleport-jobworker/internal/fileutil"
+	"time"
+)
+
+// Key types
+const (
+	KeyECDSA   = "ecdsa"
+	KeyEd25519 = "ed25519"
+)
+
+// Default lifetimes. Server certificates are reloaded by a running jobserver, so they can be short-lived.
+const (
+	DefaultCATTL     = 5 * 365 * 24 * time.Hour
+	DefaultServerTTL = 90 * 24 * time.Hour
+	DefaultClientTTL = 30 * 24 * time.Hour
+)
+
+// clockSkew backdates certificates, so they are valid on hosts with clocks slightly behind.
+const clockSkew = 5 * time.Minute
+
+// KeyPair is a certificate and its private key.
+type KeyPair struct {
+	Certificate *x509.Certificate
+	Key         crypto.Signer
+}
+
+// CA issues certificates signed by its key pair.
+type CA struct {
+	KeyPair
+}
+
+// generateKey creates a private key of keyType.
+func generateKey(keyType string) (crypto.Signer, error) {
+	switch keyType {
+	case KeyECDSA:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case KeyEd25519:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	}
+	return nil, fmt.Errorf("unknown key type %q, expected %s or %s", keyType, KeyECDSA, KeyEd25519)
+}
+
+// serialNumber returns a random 128-bit serial number.
+func serialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
+
+// NewCA creates a self-signed CA named name, valid for ttl.
+func NewCA(name, keyType string, ttl time.Duration) (*CA, error) {
+	if ttl <= 0 {
+		return nil, errors.New("lifetime must be positive")
+	}
+	key, err := generateKey(keyType)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := serialNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             now.Add(-clockSkew),
+		NotAfter:              now.Add(ttl),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		MaxPathLenZero:        true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+	cert, err := createCertificate(template, template, key.Public(), key)
+	if err != nil {
+		return nil, err
+	}
+	return &CA{KeyPair{Certificate: cert, Key: key}}, nil
+}
+
+// LoadCA loads the PEM certificate and private key of a CA created by NewCA.
+func LoadCA(certFile, keyFile string) (*CA, error) {
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	if !pair.Leaf.IsCA {
+		return nil, fmt.Errorf("%s is not a CA certificate", certFile)
+	}
+	key, ok := pair.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%s: unsupported private key", keyFile)
+	}
+	return &CA{KeyPair{Certificate: pair.Leaf, Key: key}}, nil
+}
+
+// IssueServer creates a server certificate for the DNS names and IP addresses of sans, valid for ttl.
+func (ca *CA) IssueServer(sans []string, keyType string, ttl time.Duration) (*KeyPair, error) {
+	if len(sans) == 0 {
+		return nil, errors.New("at least one DNS name or IP address is required")
+	}
+
+	template := &x509.Certificate{
+		Subject:     pkix.Name{CommonName: sans[0]},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, san := range sans {
+		if ip := net.ParseIP(san); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, san)
+		}
+	}
+	return ca.issue(template, keyType, ttl)
+}
+
+// IssueClient creates a client certificate for user, with role as organizational unit, valid for ttl.
+func (ca *CA) IssueClient(user, role, keyType string, ttl time.Duration) (*KeyPair, error) {
+	if user == "" {
+		return nil, errors.New("user is empty")
+	}
+	if role == "" {
+		return nil, errors.New("role is empty")
+	}
+
+	template := &x509.Certificate{
+		Subject:     pkix.Name{CommonName: user, OrganizationalUnit: []string{role}},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	return ca.issue(template, keyType, ttl)
+}
+
+// issue signs template with a new key, valid for ttl.
+func (ca *CA) issue(template *x509.Certificate, keyType string, ttl time.Duration) (*KeyPair, error) {
+	if ttl <= 0 {
+		return nil, errors.New("lifetime must be positive")
+	}
+	now := time.Now()
+	if notAfter := now.Add(ttl); notAfter.After(ca.Certificate.NotAfter) {
+		return nil, fmt.Errorf("certificate would outlive the CA, valid until %s",
+			ca.Certificate.NotAfter.Format(time.RFC3339))
+	}
+
+	key, err := generateKey(keyType)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := serialNumber()
+	if err != nil {
+		return nil, err
+	}
+	template.SerialNumber = serial
+	template.NotBefore = now.Add(-clockSkew)
+	template.NotAfter = now.Add(ttl)
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+
+	cert, err := createCertificate(template, ca.Certificate, key.Public(), ca.Key)
+	if err != nil {
+		return nil, err
+	}
+	return &KeyPair{Certificate: cert, Key: key}, nil
+}
+
+func createCertificate(template, parent *x509.Certificate, public crypto.PublicKey, signer crypto.Signer) (*x509.Certificate, error) {
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, public, signer)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(der)
+}
+
+// Save writes the PEM certificate to certFile, readable by everyone, and the PEM private key to keyFile,
+// readable by the owner only.
+func (k *KeyPair) Save(certFile, keyFile string) error {
+	keyDER, err := x509.MarshalPKCS8PrivateKey(k.Key)
+	if err != nil {
+		return err
+	}
+	if err := fileutil.WriteAtomic(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		return err
+	}
+	return fileutil.WriteAtomic(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: k.Certificate.Raw}), 0o644)
+}
@@ -0,0 +1,108 @@
+package pki
+
+import (
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestIssue(t *testing.T) {
+	for _, keyType := range []string{KeyECDSA, KeyEd25519} {
+		ca, err := NewCA("test CA", keyType, DefaultCATTL)
+		if err != nil {
+			t.Fatalf("NewCA(%s) error: %s", keyType, err.Error())
+		}
+		roots := x509.NewCertPool()
+		roots.AddCert(ca.Certificate)
+
+		server, err := ca.IssueServer([]string{"localhost", "127.0.0.1", "::1"}, keyType, DefaultServerTTL)
+		if err != nil {
+			t.Fatalf("IssueServer(%s) error: %s", keyType, err.Error())
+		}
+		for _, host := range []string{"localhost", "127.0.0.1", "::1"} {
+			if _, err := server.Certificate.Verify(x509.VerifyOptions{
+				DNSName: host,
+				Roots:   roots,
+			}); err != nil {
+				t.Errorf("IssueServer(%s) certificate invalid for %s: %s", keyType, host, err.Error())
+			}
+		}
+
+		client, err := ca.IssueClient("user1", "admin", keyType, DefaultClientTTL)
+		if err != nil {
+			t.Fatalf("IssueClient(%s) error: %s", keyType, err.Error())
+		}
+		if _, err := client.Certificate.Verify(x509.VerifyOptions{
+			Roots:     roots,
+			KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}); err != nil {
+			t.Errorf("IssueClient(%s) certificate invalid: %s", keyType, err.Error())
+		}
+		if subject := client.Certificate.Subject; subject.CommonName != "user1" ||
+			len(subject.OrganizationalUnit) != 1 || subject.OrganizationalUnit[0] != "admin" {
+			t.Errorf("IssueClient(%s) subject = %s, expected CN=user1,OU=admin", keyType, subject)
+		}
+	}
+}
+
+func TestIssueInvalid(t *testing.T) {
+	if _, err := NewCA("test CA", "rsa", DefaultCATTL); err == nil {
+		t.Errorf("NewCA() expected error with an unknown key type")
+	}
+
+	ca, err := NewCA("test CA", KeyECDSA, time.Hour)
+	if err != nil {
+		t.Fatalf("NewCA() error: %s", err.Error())
+	}
+	if _, err := ca.IssueServer(nil, KeyECDSA, time.Minute); err == nil {
+		t.Errorf("IssueServer() expected error without names")
+	}
+	if _, err := ca.IssueServer([]string{"localhost"}, KeyECDSA, 2*time.Hour); err == nil {
+		t.Errorf("IssueServer() expected error outliving the CA")
+	}
+	if _, err := ca.IssueClient("user1", "", KeyECDSA, time.Minute); err == nil {
+		t.Errorf("IssueClient() expected error without role")
+	}
+}
+
+func TestSaveLoadCA(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "ca.pem"), filepath.Join(dir, "ca-key.pem")
+
+	ca, err := NewCA("test CA", KeyEd25519, DefaultCATTL)
+	if err != nil {
+		t.Fatalf("NewCA() error: %s", err.Error())
+	}
+	if err := ca.Save(certFile, keyFile); err != nil {
+		t.Fatalf("Save() error: %s", err.Error())
+	}
+	if info, _ := os.Stat(keyFile); info.Mode().Perm() != 0o600 {
+		t.Errorf("Save() key file mode = %s, expected -rw-------", info.Mode().Perm())
+	}
+
+	loaded, err := LoadCA(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("LoadCA() error: %s", err.Error())
+	}
+	if !loaded.Certificate.Equal(ca.Certificate) {
+		t.Errorf("LoadCA() expected the saved certificate")
+	}
+	client, err := loaded.IssueClient("user1", "user", KeyECDSA, DefaultClientTTL)
+	if err != nil {
+		t.Fatalf("IssueClient() error: %s", err.Error())
+	}
+	if err := client.Certificate.CheckSignatureFrom(ca.Certificate); err != nil {
+		t.Errorf("IssueClient() certificate not signed by the saved CA: %s", err.Error())
+	}
+
+	// certificates which are not CAs are rejected
+	clientCert, clientKey := filepath.Join(dir, "user1.pem"), filepath.Join(dir, "user1-key.pem")
+	if err := client.Save(clientCert, clientKey); err != nil {
+		t.Fatalf("Save() error: %s", err.Error())
+	}
+	if _, err := LoadCA(clientCert, clientKey); err == nil {
+		t.Errorf("LoadCA() expected error with a client certificate")
+	}
+}
@@ -0,0 +1,139 @@
+package token
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"teleport-jobworker/internal/fileutil"
+	"time"
+)
+
+// KeySet holds the signing keys of tokens. New tokens are signed with the Active key,
+// while tokens signed by any key of the set are verified.
+type KeySet struct {
+	Active string `json:"active"`
+	Keys   []Key  `json:"keys"`
+}
+
+// Add adds key to the key set and makes it the active signing key.
+func (s *KeySet) Add(key Key) error {
+	if _, ok := s.key(key.ID); ok {
+		return fmt.Errorf("key %s already exists", key.ID)
+	}
+
+	s.Keys = append(s.Keys, key)
+	s.Active = key.ID
+	return nil
+}
+
+// Remove removes the key of kid, so tokens it signed are no longer valid.
+// The active signing key cannot be removed.
+func (s *KeySet) Remove(kid string) error {
+	if kid == s.Active {
+		return fmt.Errorf("key %s is the active signing key", kid)
+	}
+
+	for i, key := range s.Keys {
+		if key.ID == kid {
+			s.Keys = append(s.Keys[:i], s.Keys[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("key %s not found", kid)
+}
+
+func (s *KeySet) key(kid string) (Key, bool) {
+	for _, key := range s.Keys {
+		if key.ID == kid {
+			return key, true
+		}
+	}
+	return Key{}, false
+}
+
+// LoadKeySet reads a key set from a JSON file.
+func LoadKeySet(path string) (*KeySet, error) {
+	var keys KeySet
+	if err := readJSON(path, &keys); err != nil {
+		return nil, err
+	}
+	return &keys, nil
+}
+
+// Save writes the key set to a JSON file readable only by its owner.
+func (s *KeySet) Save(path string) error {
+	return writeJSON(path, s)
+}
+
+// RevocationList holds the IDs of revoked tokens, with their expiration time
+// so that entries can be dropped once the token expired anyway.
+type RevocationList struct {
+	Revoked map[string]int64 `json:"revoked"`
+}
+
+// LoadRevocationList reads a revocation list from a JSON file.
+// A missing file is an empty revocation list.
+func LoadRevocationList(path string) (*RevocationList, error) {
+	revocations := &RevocationList{Revoked: map[string]int64{}}
+	err := readJSON(path, revocations)
+	if errors.Is(err, os.ErrNotExist) {
+		return revocations, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if revocations.Revoked == nil {
+		revocations.Revoked = map[string]int64{}
+	}
+	return revocations, nil
+}
+
+// Save writes the revocation list to a JSON file readable only by its owner.
+func (r *RevocationList) Save(path string) error {
+	return writeJSON(path, r)
+}
+
+// Revoke adds a token ID to the revocation list, and drops entries of expired tokens.
+// A zero expiresAt keeps the entry forever.
+func (r *RevocationList) Revoke(id string, expiresAt time.Time) {
+	now := time.Now().Unix()
+	for revokedID, expiry := range r.Revoked {
+		if expiry != 0 && expiry <= now {
+			delete(r.Revoked, revokedID)
+		}
+	}
+
+	var expiry int64
+	if !expiresAt.IsZero() {
+		expiry = expiresAt.Unix()
+	}
+	r.Revoked[id] = expiry
+}
+
+// Contains reports whether the token ID was revoked.
+func (r *RevocationList) Contains(id string) bool {
+	_, ok := r.Revoked[id]
+	return ok
+}
+
+func readJSON(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// writeJSON replaces the file atomically, so readers never see a partial write.
+func writeJSON(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return fileutil.WriteAtomic(path, append(data, '\n'), 0o600)
+}
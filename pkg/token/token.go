@@ -0,0 +1,232 @@
+// Package token issues and verifies signed, expiring access tokens, as JSON Web Tokens
+// signed with HMAC-SHA256 (HS256) or Ed25519 (EdDSA) keys. Keys are identified by a
+// key ID, so signing keys can be rotated while tokens signed by previous keys stay valid.
+package token
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Signing algorithms
+const (
+	AlgHS256 = "HS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// Token types. Refresh tokens are only accepted to issue new tokens, never to authenticate requests.
+const (
+	TypeAccess  = ""
+	TypeRefresh = "refresh"
+)
+
+var (
+	ErrMalformed   = errors.New("malformed token")
+	ErrUnknownKey  = errors.New("token signed by an unknown key")
+	ErrSignature   = errors.New("invalid token signature")
+	ErrExpired     = errors.New("token expired")
+	ErrNotYetValid = errors.New("token not yet valid")
+	ErrAudience    = errors.New("token issued for another audience")
+	ErrRevoked     = errors.New("token revoked")
+	ErrType        = errors.New("wrong token type")
+)
+
+// header is the JOSE header of a token.
+type header struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ"`
+	KeyID     string `json:"kid"`
+}
+
+// Claims are the claims of a token. Times are seconds since the Unix epoch.
+type Claims struct {
+	ID        string `json:"jti"`
+	Subject   string `json:"sub"`
+	Role      string `json:"role"`
+	Audience  string `json:"aud"`
+	IssuedAt  int64  `json:"iat"`
+	NotBefore int64  `json:"nbf"`
+	ExpiresAt int64  `json:"exp"`
+	Type      string `json:"typ,omitempty"`
+}
+
+// NewClaims creates the claims of a token for subject and role, valid from now for ttl,
+// with a random token ID.
+func NewClaims(subject, role, audience string, ttl time.Duration) Claims {
+	now := time.Now()
+	return Claims{
+		ID:        randomID(),
+		Subject:   subject,
+		Role:      role,
+		Audience:  audience,
+		IssuedAt:  now.Unix(),
+		NotBefore: now.Unix(),
+		ExpiresAt: now.Add(ttl).Unix(),
+	}
+}
+
+// Validate checks the time claims of a token at now, and that it was issued for audience.
+func (c Claims) Validate(audience string, now time.Time) error {
+	if now.Unix() >= c.ExpiresAt {
+		return ErrExpired
+	}
+	if now.Unix() < c.NotBefore {
+		return ErrNotYetValid
+	}
+	if c.Audience != audience {
+		return ErrAudience
+	}
+	return nil
+}
+
+// Expiry returns the expiration time of the token.
+func (c Claims) Expiry() time.Time {
+	return time.Unix(c.ExpiresAt, 0)
+}
+
+// Key is a signing key. HS256 keys hold a Secret, EdDSA keys an Ed25519 key pair.
+type Key struct {
+	ID         string             `json:"kid"`
+	Algorithm  string             `json:"alg"`
+	Secret     []byte             `json:"secret,omitempty"`
+	PrivateKey ed25519.PrivateKey `json:"privateKey,omitempty"`
+	PublicKey  ed25519.PublicKey  `json:"publicKey,omitempty"`
+}
+
+// GenerateKey creates a random signing key for alg, identified by kid.
+// A random key ID is used if kid is empty.
+func GenerateKey(alg, kid string) (Key, error) {
+	if kid == "" {
+		kid = randomID()
+	}
+
+	switch alg {
+	case AlgHS256:
+		secret := make([]byte, 32)
+		rand.Read(secret)
+		return Key{ID: kid, Algorithm: alg, Secret: secret}, nil
+
+	case AlgEdDSA:
+		publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return Key{}, err
+		}
+		return Key{ID: kid, Algorithm: alg, PrivateKey: privateKey, PublicKey: publicKey}, nil
+	}
+
+	return Key{}, fmt.Errorf("unknown signing algorithm %q, expected %s or %s", alg, AlgHS256, AlgEdDSA)
+}
+
+func (k Key) sign(data []byte) ([]byte, error) {
+	switch k.Algorithm {
+	case AlgHS256:
+		mac := hmac.New(sha256.New, k.Secret)
+		mac.Write(data)
+		return mac.Sum(nil), nil
+
+	case AlgEdDSA:
+		if len(k.PrivateKey) != ed25519.PrivateKeySize {
+			return nil, fmt.Errorf("key %s has no private key", k.ID)
+		}
+		return ed25519.Sign(k.PrivateKey, data), nil
+	}
+	return nil, fmt.Errorf("key %s has unknown signing algorithm %q", k.ID, k.Algorithm)
+}
+
+func (k Key) verify(data, signature []byte) bool {
+	switch k.Algorithm {
+	case AlgHS256:
+		expected, _ := k.sign(data)
+		return hmac.Equal(signature, expected)
+
+	case AlgEdDSA:
+		return len(k.PublicKey) == ed25519.PublicKeySize && ed25519.Verify(k.PublicKey, data, signature)
+	}
+	return false
+}
+
+// Sign encodes and signs the claims as a token, with the active key of the key set.
+func (s *KeySet) Sign(claims Claims) (string, error) {
+	key, ok := s.key(s.Active)
+	if !ok {
+		return "", fmt.Errorf("no active signing key")
+	}
+
+	headerJSON, err := json.Marshal(header{Algorithm: key.Algorithm, Type: "JWT", KeyID: key.ID})
+	if err != nil {
+		return "", err
+	}
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signed := encode(headerJSON) + "." + encode(claimsJSON)
+	signature, err := key.sign([]byte(signed))
+	if err != nil {
+		return "", err
+	}
+	return signed + "." + encode(signature), nil
+}
+
+// Parse verifies the signature of a token with the key set, and returns its claims.
+// Time claims and audience are not validated.
+func (s *KeySet) Parse(token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Claims{}, ErrMalformed
+	}
+
+	var h header
+	if err := decodeJSON(parts[0], &h); err != nil {
+		return Claims{}, ErrMalformed
+	}
+	key, ok := s.key(h.KeyID)
+	if !ok {
+		return Claims{}, ErrUnknownKey
+	}
+	// the algorithm is bound to the key, never chosen by the token
+	if h.Algorithm != key.Algorithm {
+		return Claims{}, ErrSignature
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Claims{}, ErrMalformed
+	}
+	if !key.verify([]byte(parts[0]+"."+parts[1]), signature) {
+		return Claims{}, ErrSignature
+	}
+
+	var claims Claims
+	if err := decodeJSON(parts[1], &claims); err != nil {
+		return Claims{}, ErrMalformed
+	}
+	return claims, nil
+}
+
+func encode(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeJSON(part string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func randomID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return base64.RawURLEncoding.EncodeToString(id)
+}
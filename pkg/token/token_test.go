@@ -0,0 +1,214 @@
+package token
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const testAudience = "jobworker"
+
+func newKeySet(t *testing.T, alg string) *KeySet {
+	t.Helper()
+
+	key, err := GenerateKey(alg, "")
+	if err != nil {
+		t.Fatalf("GenerateKey() error: %s", err.Error())
+	}
+	keys := &KeySet{}
+	keys.Add(key)
+	return keys
+}
+
+func TestSignVerify(t *testing.T) {
+	for _, alg := range []string{AlgHS256, AlgEdDSA} {
+		keys := newKeySet(t, alg)
+		verifier := NewVerifier(keys, nil, testAudience)
+
+		token, err := keys.Sign(NewClaims("user1", "admin", testAudience, time.Hour))
+		if err != nil {
+			t.Fatalf("Sign() error: %s", err.Error())
+		}
+
+		claims, err := verifier.Verify(token)
+		if err != nil {
+			t.Errorf("Verify() %s token error: %s", alg, err.Error())
+		}
+		if claims.Subject != "user1" || claims.Role != "admin" || claims.ID == "" {
+			t.Errorf("Verify() %s token unexpected claims: %+v", alg, claims)
+		}
+
+		// a modified payload does not match the signature
+		parts := strings.Split(token, ".")
+		forged, _ := keys.Sign(NewClaims("user1", "admin", testAudience, 24*time.Hour))
+		_, err = verifier.Verify(parts[0] + "." + strings.Split(forged, ".")[1] + "." + parts[2])
+		if !errors.Is(err, ErrSignature) {
+			t.Errorf("Verify() %s forged token expected error: %s, got: %v", alg, ErrSignature, err)
+		}
+	}
+}
+
+func TestVerifyClaims(t *testing.T) {
+	keys := newKeySet(t, AlgHS256)
+	verifier := NewVerifier(keys, nil, testAudience)
+
+	expired := NewClaims("user1", "user", testAudience, time.Hour)
+	expired.ExpiresAt = time.Now().Add(-time.Minute).Unix()
+	notYetValid := NewClaims("user1", "user", testAudience, time.Hour)
+	notYetValid.NotBefore = time.Now().Add(time.Minute).Unix()
+	// refresh tokens do not authenticate requests
+	refresh := NewClaims("user1", "user", testAudience, time.Hour)
+	refresh.Type = TypeRefresh
+
+	tests := []struct {
+		claims Claims
+		err    error
+	}{
+		{expired, ErrExpired},
+		{notYetValid, ErrNotYetValid},
+		{NewClaims("user1", "user", "another", time.Hour), ErrAudience},
+		{refresh, ErrType},
+	}
+
+	for _, test := range tests {
+		token, _ := keys.Sign(test.claims)
+		if _, err := verifier.Verify(token); !errors.Is(err, test.err) {
+			t.Errorf("Verify() expected error: %s, got: %v", test.err, err)
+		}
+	}
+
+	if _, err := verifier.Verify("not.a.token"); !errors.Is(err, ErrMalformed) {
+		t.Errorf("Verify() expected error: %s, got: %v", ErrMalformed, err)
+	}
+
+	token, _ := keys.Sign(refresh)
+	if _, err := verifier.VerifyRefresh(token); err != nil {
+		t.Errorf("VerifyRefresh() error: %s", err.Error())
+	}
+}
+
+func TestIssueRevoke(t *testing.T) {
+	revocationsPath := filepath.Join(t.TempDir(), "revoked.json")
+	keys := newKeySet(t, AlgEdDSA)
+	keysPath := filepath.Join(t.TempDir(), "keys.json")
+	keys.Save(keysPath)
+
+	verifier, err := LoadVerifier(keysPath, revocationsPath, testAudience)
+	if err != nil {
+		t.Fatalf("LoadVerifier() error: %s", err.Error())
+	}
+
+	token, claims, err := verifier.Issue("user1", "user", TypeRefresh, time.Hour)
+	if err != nil {
+		t.Fatalf("Issue() error: %s", err.Error())
+	}
+	if _, err := verifier.VerifyRefresh(token); err != nil {
+		t.Errorf("VerifyRefresh() error: %s", err.Error())
+	}
+
+	// tokens revoked on use can only be used once
+	if err := verifier.Revoke(claims); err != nil {
+		t.Errorf("Revoke() error: %s", err.Error())
+	}
+	if err := verifier.Revoke(claims); !errors.Is(err, ErrRevoked) {
+		t.Errorf("Revoke() expected error: %s, got: %v", ErrRevoked, err)
+	}
+	if _, err := verifier.VerifyRefresh(token); !errors.Is(err, ErrRevoked) {
+		t.Errorf("VerifyRefresh() expected error: %s, got: %v", ErrRevoked, err)
+	}
+
+	// the revocation is saved for other verifiers
+	revocations, _ := LoadRevocationList(revocationsPath)
+	if !revocations.Contains(claims.ID) {
+		t.Errorf("LoadRevocationList() expected token %s to be revoked", claims.ID)
+	}
+}
+
+func TestUsers(t *testing.T) {
+	passwordCost = bcrypt.MinCost
+	path := filepath.Join(t.TempDir(), "users.json")
+
+	file, _ := LoadUserFile(path)
+	file.Set("user1", "user", "secret")
+	file.Save(path)
+
+	users, err := LoadUsers(path)
+	if err != nil {
+		t.Fatalf("LoadUsers() error: %s", err.Error())
+	}
+
+	if role, err := users.Authenticate("user1", "secret"); err != nil || role != "user" {
+		t.Errorf("Authenticate() expected role user, got: %q, %v", role, err)
+	}
+	for _, credentials := range [][2]string{{"user1", "wrong"}, {"user2", "secret"}} {
+		if _, err := users.Authenticate(credentials[0], credentials[1]); !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("Authenticate() %s expected error: %s, got: %v", credentials[0], ErrInvalidCredentials, err)
+		}
+	}
+
+	// changes of the users file apply to the loaded Users
+	file.Set("user1", "admin", "changed")
+	file.Save(path)
+	if role, err := users.Authenticate("user1", "changed"); err != nil || role != "admin" {
+		t.Errorf("Authenticate() expected role admin, got: %q, %v", role, err)
+	}
+
+	file.Remove("user1")
+	file.Save(path)
+	if _, ok := users.Role("user1"); ok {
+		t.Errorf("Role() expected removed user")
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	dir := t.TempDir()
+	keysPath := filepath.Join(dir, "keys.json")
+	revocationsPath := filepath.Join(dir, "revoked.json")
+
+	keys := newKeySet(t, AlgHS256)
+	keys.Save(keysPath)
+	oldToken, _ := keys.Sign(NewClaims("user1", "user", testAudience, time.Hour))
+
+	verifier, err := LoadVerifier(keysPath, revocationsPath, testAudience)
+	if err != nil {
+		t.Fatalf("LoadVerifier() error: %s", err.Error())
+	}
+
+	// tokens of the new active key are verified once the key set file changed,
+	// along with tokens of the previous key
+	key, _ := GenerateKey(AlgEdDSA, "rotated")
+	keys.Add(key)
+	keys.Save(keysPath)
+	newToken, _ := keys.Sign(NewClaims("user1", "user", testAudience, time.Hour))
+
+	for _, token := range []string{oldToken, newToken} {
+		if _, err := verifier.Verify(token); err != nil {
+			t.Errorf("Verify() error: %s", err.Error())
+		}
+	}
+
+	// HS256 tokens cannot be forged with the public key of an EdDSA key
+	forgedKeys := &KeySet{Active: "rotated", Keys: []Key{{ID: "rotated", Algorithm: AlgHS256, Secret: key.PublicKey}}}
+	forged, _ := forgedKeys.Sign(NewClaims("admin1", "admin", testAudience, time.Hour))
+	if _, err := verifier.Verify(forged); !errors.Is(err, ErrSignature) {
+		t.Errorf("Verify() expected error: %s, got: %v", ErrSignature, err)
+	}
+
+	claims, _ := verifier.Verify(newToken)
+	revocations, _ := LoadRevocationList(revocationsPath)
+	revocations.Revoke(claims.ID, claims.Expiry())
+	revocations.Save(revocationsPath)
+	if _, err := verifier.Verify(newToken); !errors.Is(err, ErrRevoked) {
+		t.Errorf("Verify() expected error: %s, got: %v", ErrRevoked, err)
+	}
+
+	keys.Remove(keys.Keys[0].ID)
+	keys.Save(keysPath)
+	if _, err := verifier.Verify(oldToken); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Verify() expected error: %s, got: %v", ErrUnknownKey, err)
+	}
+}
@@ -0,0 +1,145 @@
+package token
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"teleport-jobworker/internal/fileutil"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrInvalidCredentials = errors.New("invalid user or password")
+
+// passwordCost is the bcrypt cost of password hashes, lowered by tests.
+var passwordCost = bcrypt.DefaultCost
+
+// dummyHash is compared against the password of unknown users,
+// so that logins take as long whether the user exists or not.
+var dummyHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("dummy password"), passwordCost)
+	return hash
+})
+
+// User is an account allowed to log in, with its bcrypt password hash.
+type User struct {
+	Name         string `json:"name"`
+	Role         string `json:"role"`
+	PasswordHash string `json:"passwordHash"`
+}
+
+// UserFile holds the accounts of a users file.
+type UserFile struct {
+	Users []User `json:"users"`
+}
+
+// LoadUserFile reads a users file. A missing file has no users.
+func LoadUserFile(path string) (*UserFile, error) {
+	var users UserFile
+	err := readJSON(path, &users)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return &users, nil
+}
+
+// Save writes the users file, readable only by its owner.
+func (f *UserFile) Save(path string) error {
+	return writeJSON(path, f)
+}
+
+// Set adds the user name with role and password, or replaces its role and password if it exists.
+func (f *UserFile) Set(name, role, password string) error {
+	if name == "" {
+		return errors.New("user name is required")
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), passwordCost)
+	if err != nil {
+		return err
+	}
+
+	user := User{Name: name, Role: role, PasswordHash: string(hash)}
+	for i := range f.Users {
+		if f.Users[i].Name == name {
+			f.Users[i] = user
+			return nil
+		}
+	}
+	f.Users = append(f.Users, user)
+	return nil
+}
+
+// Remove removes the user name.
+func (f *UserFile) Remove(name string) error {
+	for i, user := range f.Users {
+		if user.Name == name {
+			f.Users = append(f.Users[:i], f.Users[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("user %s not found", name)
+}
+
+func (f *UserFile) user(name string) (User, bool) {
+	for _, user := range f.Users {
+		if user.Name == name {
+			return user, true
+		}
+	}
+	return User{}, false
+}
+
+// Users authenticates users by the passwords of a users file, which is reloaded when it changes.
+type Users struct {
+	mutex sync.Mutex
+	users *UserFile
+	file  fileutil.Watched
+}
+
+// LoadUsers creates Users from a users file.
+func LoadUsers(path string) (*Users, error) {
+	users, err := LoadUserFile(path)
+	if err != nil {
+		return nil, err
+	}
+	u := &Users{users: users, file: fileutil.Watched{Path: path}}
+	u.file.Changed()
+	return u, nil
+}
+
+func (u *Users) current() *UserFile {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	// keep the last valid file if a reload fails, eg. while the file is being replaced
+	if u.file.Changed() {
+		if users, err := LoadUserFile(u.file.Path); err == nil {
+			u.users = users
+		} else {
+			u.file.Forget()
+		}
+	}
+	return u.users
+}
+
+// Authenticate returns the role of user if password matches, or ErrInvalidCredentials.
+func (u *Users) Authenticate(name, password string) (string, error) {
+	user, ok := u.current().user(name)
+	hash := []byte(user.PasswordHash)
+	if !ok {
+		hash = dummyHash()
+	}
+
+	if err := bcrypt.CompareHashAndPassword(hash, []byte(password)); err != nil || !ok {
+		return "", ErrInvalidCredentials
+	}
+	return user.Role, nil
+}
+
+// Role returns the current role of user, eg. to refresh its tokens.
+// Returns false if the user was removed.
+func (u *Users) Role(name string) (string, bool) {
+	user, ok := u.current().user(name)
+	return user.Role, ok
+}
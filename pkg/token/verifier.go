@@ -0,0 +1,146 @@
+package token
+
+import (
+	"maps"
+	"sync"
+	"teleport-jobworker/internal/fileutil"
+	"time"
+)
+
+// Verifier verifies the signature, time claims, audience and revocation of tokens.
+type Verifier struct {
+	audience string
+
+	mutex       sync.Mutex
+	keys        *KeySet
+	revocations *RevocationList
+
+	// files are reloaded when they change, eg. after a key rotation or a revocation
+	keysFile        fileutil.Watched
+	revocationsFile fileutil.Watched
+}
+
+// NewVerifier creates a Verifier of tokens issued for audience, signed by keys and not in revocations.
+// revocations may be nil.
+func NewVerifier(keys *KeySet, revocations *RevocationList, audience string) *Verifier {
+	if revocations == nil {
+		revocations = &RevocationList{Revoked: map[string]int64{}}
+	}
+	return &Verifier{audience: audience, keys: keys, revocations: revocations}
+}
+
+// LoadVerifier creates a Verifier from a key set file and a revocation list file,
+// which are reloaded when they change.
+func LoadVerifier(keysPath, revocationsPath, audience string) (*Verifier, error) {
+	v := &Verifier{
+		audience:        audience,
+		keysFile:        fileutil.Watched{Path: keysPath},
+		revocationsFile: fileutil.Watched{Path: revocationsPath},
+	}
+	if err := v.reload(); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// reload reads the files that changed since they were last read. Caller must hold mutex,
+// unless the Verifier is not shared yet.
+func (v *Verifier) reload() error {
+	if v.keysFile.Changed() || v.keys == nil {
+		keys, err := LoadKeySet(v.keysFile.Path)
+		if err != nil {
+			v.keysFile.Forget()
+			return err
+		}
+		v.keys = keys
+	}
+
+	if v.revocationsFile.Changed() || v.revocations == nil {
+		revocations, err := LoadRevocationList(v.revocationsFile.Path)
+		if err != nil {
+			v.revocationsFile.Forget()
+			return err
+		}
+		v.revocations = revocations
+	}
+	return nil
+}
+
+// current returns the key set and revocation list, reloading the files that changed.
+func (v *Verifier) current() (*KeySet, *RevocationList) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	// keep the last valid files if a reload fails, eg. while a file is being replaced
+	v.reload()
+	return v.keys, v.revocations
+}
+
+// Verify returns the claims of a valid access token, or an error matching ErrMalformed, ErrUnknownKey,
+// ErrSignature, ErrExpired, ErrNotYetValid, ErrAudience, ErrRevoked or ErrType.
+func (v *Verifier) Verify(token string) (Claims, error) {
+	return v.verify(token, TypeAccess)
+}
+
+// VerifyRefresh is Verify for refresh tokens.
+func (v *Verifier) VerifyRefresh(token string) (Claims, error) {
+	return v.verify(token, TypeRefresh)
+}
+
+func (v *Verifier) verify(token, tokenType string) (Claims, error) {
+	keys, revocations := v.current()
+
+	claims, err := keys.Parse(token)
+	if err != nil {
+		return Claims{}, err
+	}
+	if err := claims.Validate(v.audience, time.Now()); err != nil {
+		return Claims{}, err
+	}
+	if claims.Type != tokenType {
+		return Claims{}, ErrType
+	}
+	if revocations.Contains(claims.ID) {
+		return Claims{}, ErrRevoked
+	}
+	return claims, nil
+}
+
+// Issue signs a token for subject and role, valid for ttl, with the active key of the key set.
+func (v *Verifier) Issue(subject, role, tokenType string, ttl time.Duration) (string, Claims, error) {
+	keys, _ := v.current()
+
+	claims := NewClaims(subject, role, v.audience, ttl)
+	claims.Type = tokenType
+	signed, err := keys.Sign(claims)
+	if err != nil {
+		return "", Claims{}, err
+	}
+	return signed, claims, nil
+}
+
+// Revoke adds the token of claims to the revocation list, and saves the revocation list file, if any.
+// Returns ErrRevoked if the token was already revoked, so that a token is only used once
+// when it is revoked on use, eg. refresh tokens.
+func (v *Verifier) Revoke(claims Claims) error {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	v.reload()
+	if v.revocations.Contains(claims.ID) {
+		return ErrRevoked
+	}
+	// copy the revocation list, which may be in use by concurrent verifications
+	revocations := &RevocationList{Revoked: maps.Clone(v.revocations.Revoked)}
+	revocations.Revoke(claims.ID, claims.Expiry())
+
+	if v.revocationsFile.Path != "" {
+		if err := revocations.Save(v.revocationsFile.Path); err != nil {
+			return err
+		}
+		// the saved file is already loaded
+		v.revocationsFile.Changed()
+	}
+	v.revocations = revocations
+	return nil
+}
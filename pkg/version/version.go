@@ -0,0 +1,83 @@
+// Package version reports the version of the jobserver and jobctl builds, set at build time with:
+//
+//	go build -ldflags "-X teleport-jobworker/pkg/version.Version=v1.2.0 -X teleport-jobworker/pkg/version.Commit=$(git rev-parse HEAD)"
+package version
+
+import (
+	"runtime/debug"
+	"strconv"
+	"strings"
+)
+
+// Dev is the version of builds without a version set.
+const Dev = "dev"
+
+var (
+	// Version is the semantic version of the build, eg. v1.2.0.
+	Version = Dev
+	// Commit is the VCS revision of the build. Defaults to the revision stamped by go build, if any.
+	Commit = ""
+)
+
+// BuildCommit returns Commit, or the VCS revision stamped by go build, or "unknown".
+func BuildCommit() string {
+	if Commit != "" {
+		return Commit
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				return setting.Value
+			}
+		}
+	}
+	return "unknown"
+}
+
+// String describes the build, eg. "v1.2.0 (commit 1a2b3c4)".
+func String() string {
+	commit := BuildCommit()
+	if len(commit) > 12 {
+		commit = commit[:12]
+	}
+	return Version + " (commit " + commit + ")"
+}
+
+// Compatible reports whether a client and a server of the given versions work together: the API
+// only changes compatibly within a major version, or within a minor version before v1.
+// Development builds and versions which are not semantic versions are assumed compatible.
+func Compatible(client, server string) bool {
+	clientMajor, clientMinor, ok := parse(client)
+	if !ok {
+		return true
+	}
+	serverMajor, serverMinor, ok := parse(server)
+	if !ok {
+		return true
+	}
+
+	if clientMajor != serverMajor {
+		return false
+	}
+	return clientMajor > 0 || clientMinor == serverMinor
+}
+
+// parse returns the major and minor versions of a semantic version, eg. v1.2.0 or 1.2.0-rc.1.
+func parse(version string) (major, minor int, ok bool) {
+	version = strings.TrimPrefix(version, "v")
+	majorPart, rest, found := strings.Cut(version, ".")
+	if !found {
+		return 0, 0, false
+	}
+	minorPart, _, _ := strings.Cut(rest, ".")
+
+	major, err := strconv.Atoi(majorPart)
+	if err != nil {
+		return 0, 0, false
+	}
+	minor, err = strconv.Atoi(minorPart)
+	if err != nil {
+		return 0, 0, false
+	}
+	return major, minor, true
+}
@@ -0,0 +1,25 @@
+package version
+
+import "testing"
+
+func TestCompatible(t *testing.T) {
+	tests := []struct {
+		client, server string
+		compatible     bool
+	}{
+		{"v1.2.0", "v1.5.3", true},
+		{"1.2.0", "v1.0.0-rc.1", true},
+		{"v1.2.0", "v2.0.0", false},
+		{"v0.3.1", "v0.3.0", true},
+		{"v0.3.1", "v0.4.0", false},
+		{Dev, "v2.0.0", true},
+		{"v1.0.0", Dev, true},
+		{"v1", "v2.0.0", true},
+	}
+
+	for _, test := range tests {
+		if got := Compatible(test.client, test.server); got != test.compatible {
+			t.Errorf("Compatible(%q, %q) = %v, expected %v", test.client, test.server, got, test.compatible)
+		}
+	}
+}